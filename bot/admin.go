@@ -0,0 +1,166 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	conf "tutor/config"
+	"tutor/utils"
+)
+
+// allow регистрирует пользователя: /allow <id> [роль] [имя], /allow * открывает бота всем
+func (b *Bot) allow(message *telegram.Message) error {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		b.reply(message, b.text(message.Chat.ID, "invalid_arguments")+"\n"+b.text(message.Chat.ID, "allow_description"))
+		return nil
+	}
+
+	if args[0] == "*" {
+		if err := b.Config.UserRegistry().SetAllowAll(true); err != nil {
+			return err
+		}
+		b.audit(message, "allow_all", 0, "")
+		b.reply(message, b.text(message.Chat.ID, "allow_done"))
+		return nil
+	}
+
+	userID, err := strconv.Atoi(args[0])
+	if err != nil || userID == 0 {
+		b.reply(message, b.text(message.Chat.ID, "invalid_arguments"))
+		return nil
+	}
+
+	user, ok := b.Config.UserRegistry().Lookup(userID)
+	if !ok {
+		user = conf.User{ID: userID, Role: conf.RoleStudent}
+	}
+	if len(args) > 1 {
+		role := conf.Role(args[1])
+		switch role {
+		case conf.RoleAdmin, conf.RoleTeacher, conf.RoleStudent:
+			user.Role = role
+		default:
+			b.reply(message, b.text(message.Chat.ID, "invalid_arguments"))
+			return nil
+		}
+	}
+	if len(args) > 2 {
+		user.Name = strings.Join(args[2:], " ")
+	}
+
+	if err := b.Config.UserRegistry().Put(user); err != nil {
+		return err
+	}
+	b.audit(message, "allow", userID, string(user.Role))
+	b.reply(message, b.text(message.Chat.ID, "allow_done"))
+	return nil
+}
+
+// deny удаляет пользователя из реестра: /deny <id>, /deny * закрывает бота для незарегистрированных
+func (b *Bot) deny(message *telegram.Message) error {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) != 1 {
+		b.reply(message, b.text(message.Chat.ID, "invalid_arguments")+"\n"+b.text(message.Chat.ID, "deny_description"))
+		return nil
+	}
+
+	if args[0] == "*" {
+		if err := b.Config.UserRegistry().SetAllowAll(false); err != nil {
+			return err
+		}
+		b.audit(message, "deny_all", 0, "")
+		b.reply(message, b.text(message.Chat.ID, "deny_done"))
+		return nil
+	}
+
+	userID, err := strconv.Atoi(args[0])
+	if err != nil {
+		b.reply(message, b.text(message.Chat.ID, "invalid_arguments"))
+		return nil
+	}
+	if userID == message.From.ID {
+		b.reply(message, b.text(message.Chat.ID, "not_permitted"))
+		return nil
+	}
+	if _, ok := b.Config.UserRegistry().Lookup(userID); !ok {
+		b.reply(message, b.text(message.Chat.ID, "user_not_found"))
+		return nil
+	}
+
+	if err := b.Config.UserRegistry().Remove(userID); err != nil {
+		return err
+	}
+	b.audit(message, "deny", userID, "")
+	b.reply(message, b.text(message.Chat.ID, "deny_done"))
+	return nil
+}
+
+// resetUsage обнуляет текущие затраты пользователя: /resetusage <id>
+func (b *Bot) resetUsage(message *telegram.Message) error {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) != 1 {
+		b.reply(message, b.text(message.Chat.ID, "invalid_arguments")+"\n"+b.text(message.Chat.ID, "resetusage_description"))
+		return nil
+	}
+
+	userID, err := strconv.Atoi(args[0])
+	if err != nil {
+		b.reply(message, b.text(message.Chat.ID, "invalid_arguments"))
+		return nil
+	}
+
+	user, ok := b.Config.UserRegistry().Lookup(userID)
+	if !ok {
+		b.reply(message, b.text(message.Chat.ID, "user_not_found"))
+		return nil
+	}
+	utils.GetUserUsageTracker(b.Config, b.Usage, userID, user.Name).ResetCurrentCosts()
+	b.audit(message, "resetusage", userID, "")
+	b.reply(message, b.text(message.Chat.ID, "resetusage_done"))
+	return nil
+}
+
+// users выводит зарегистрированных пользователей с ролями, бюджетами и расходами
+func (b *Bot) users(message *telegram.Message) error {
+	registry := b.Config.UserRegistry()
+	lines := []string{fmt.Sprintf("**%s** (%s: %t)", b.text(message.Chat.ID, "users_title"), b.text(message.Chat.ID, "users_allow_all"), registry.AllowAll())}
+
+	for _, user := range registry.List() {
+		budget := "∞"
+		if user.Budget != nil {
+			budget = fmt.Sprintf("$%.2f", *user.Budget)
+		}
+		period := utils.GetUserBudgetPeriod(b.Config, user.ID)
+		cost := utils.GetUserUsageTracker(b.Config, b.Usage, user.ID, user.Name).GetCurrentCost()
+
+		line := fmt.Sprintf("`%d` %s - %s, %s %s, $%.2f %s", user.ID, user.Name, user.Role,
+			budget, b.text(message.Chat.ID, "budget_period_"+period), cost["cost_month"], b.text(message.Chat.ID, "budget_period_monthly"))
+		if user.Model != "" {
+			line += ", " + user.Model
+		}
+		lines = append(lines, line)
+	}
+
+	b.reply(message, strings.Join(lines, "\n"))
+	return nil
+}
+
+// audit записывает действие администратора или учителя в журнал аудита
+func (b *Bot) audit(message *telegram.Message, action string, targetID int, details string) {
+	log.Printf("User %s (id: %d) performed %s on %d %s", message.From.UserName, message.From.ID, action, targetID, details)
+	err := utils.RecordAudit(b.Config, utils.AuditEntry{
+		ActorID:   message.From.ID,
+		ActorName: message.From.UserName,
+		Action:    action,
+		TargetID:  targetID,
+		Details:   details,
+	})
+	if err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
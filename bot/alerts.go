@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	conf "tutor/config"
+	"tutor/utils"
+)
+
+// sendBudgetAlerts уведомляет пользователя и администраторов о пересеченных порогах бюджета
+func (b *Bot) sendBudgetAlerts(alerts []utils.BudgetAlert) {
+	for _, alert := range alerts {
+		if alert.NotifyUser && alert.UserID != 0 {
+			chatID := int64(alert.UserID)
+			b.send(chatID, 0, fmt.Sprintf(b.text(chatID, "budget_alert_user"),
+				alert.Threshold, b.text(chatID, "budget_period_"+alert.Period), alert.Spent, alert.Budget))
+		}
+		if !alert.NotifyAdmins {
+			continue
+		}
+
+		for _, user := range b.Config.UserRegistry().List() {
+			if user.Role != conf.RoleAdmin || user.ID == alert.UserID {
+				continue
+			}
+			chatID := int64(user.ID)
+			period := b.text(chatID, "budget_period_"+alert.Period)
+			if alert.UserID == 0 {
+				b.send(chatID, 0, fmt.Sprintf(b.text(chatID, "budget_alert_org"), alert.Threshold, period, alert.Spent, alert.Budget))
+			} else {
+				b.send(chatID, 0, fmt.Sprintf(b.text(chatID, "budget_alert_admin"), alert.UserID, alert.Threshold, period, alert.Spent, alert.Budget))
+			}
+		}
+	}
+}
+
+// send отправляет сообщение в чат или тему форума threadID без цитирования, например в личный чат с пользователем
+func (b *Bot) send(chatID int64, threadID int, text string) {
+	if _, err := utils.SendMessage(b.API, telegram.NewMessage(chatID, text), threadID); err != nil {
+		log.Printf("Failed to send message to chat %d: %v", chatID, err)
+	}
+}
@@ -0,0 +1,293 @@
+package bot
+
+import (
+	"log"
+	"sync"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	conf "tutor/config"
+	"tutor/helper"
+	"tutor/learning"
+	"tutor/usagetracker"
+	"tutor/utils"
+)
+
+// Bot связывает Telegram, OpenAI и учет расходов пользователей
+type Bot struct {
+	API    *telegram.BotAPI
+	OpenAI *helper.OpenAIHelper
+	Config conf.Config
+	Usage  map[string]*usagetracker.UsageTracker
+
+	Scores       *learning.ScoreStore
+	Cards        *learning.CardStore
+	Progress     *learning.ProgressLog
+	Digests      *learning.DigestLog
+	Lessons      *learning.LessonLibrary
+	LessonStates *learning.LessonStore
+	Exams        *learning.ExamLibrary
+	ExamResults  *learning.ExamResults
+	Vocab        *learning.VocabStore
+	Documents    *learning.DocumentStore
+
+	// mu защищает состояние бота и помощника OpenAI. Цикл обновлений держит его, пока обрабатывает обновление,
+	// горутины - пока обращаются к состоянию
+	mu sync.Mutex
+
+	inlineMu      sync.Mutex
+	inlineQueries map[int]string
+	// inlineRefusals - причины отказа в inline-запросах по пользователям, чтобы не проверять их на каждое нажатие клавиши
+	inlineRefusals map[int]inlineRefusal
+	quizzes        map[string]*learning.Quiz
+	sessions       *learning.Sessions
+	exams          map[int]*learning.ExamSession
+	// documentContext - фрагменты документов, найденные для текущего запроса диалога
+	documentContext map[helper.ConversationKey]string
+}
+
+// New создает бота. Если реестр пользователей не загружен, он конвертируется из старых списков,
+// чтобы изменения во время работы не терялись. Настройки чатов и пресеты без файлов хранятся в памяти
+func New(cfg conf.Config, api *telegram.BotAPI, openAI *helper.OpenAIHelper) *Bot {
+	if cfg.Users == nil {
+		cfg.Users = conf.NewLegacyUserRegistry(cfg)
+	}
+	if cfg.ChatSettings == nil {
+		cfg.ChatSettings = conf.NewChatSettingsStore("")
+	}
+	if cfg.Prompts == nil {
+		cfg.Prompts = cfg.PromptLibrary()
+	}
+	// помощник OpenAI должен видеть те же настройки чатов и пресеты, что и бот
+	openAI.Config.ChatSettings = cfg.ChatSettings
+	openAI.Config.Prompts = cfg.Prompts
+	scores, err := learning.LoadScores(cfg.LogsDir)
+	if err != nil {
+		log.Printf("Error loading quiz scores: %v", err)
+	}
+	digests, err := learning.LoadDigestLog(cfg.LogsDir)
+	if err != nil {
+		log.Printf("Error loading digest state: %v", err)
+	}
+	lessons, err := learning.LoadLessons(cfg.LessonsFile)
+	if err != nil {
+		log.Printf("Error loading lesson plans: %v", err)
+	}
+	exams, err := learning.LoadExams(cfg.ExamsFile)
+	if err != nil {
+		log.Printf("Error loading exam banks: %v", err)
+	}
+	examResults := learning.NewExamResults(cfg.LogsDir)
+	// экзамены продолжаются после перезапуска, а те, время которых вышло, завершит первый tick
+	activeExams, err := examResults.LoadActive()
+	if err != nil {
+		log.Printf("Error loading active exams: %v", err)
+	}
+
+	b := &Bot{
+		API:          api,
+		OpenAI:       openAI,
+		Config:       cfg,
+		Usage:        utils.LoadUsage(cfg),
+		Scores:       scores,
+		Cards:        learning.NewCardStore(cfg.LogsDir),
+		Progress:     learning.NewProgressLog(cfg.LogsDir),
+		Digests:      digests,
+		Lessons:      lessons,
+		LessonStates: learning.NewLessonStore(cfg.LogsDir),
+		Exams:        exams,
+		ExamResults:  examResults,
+		Vocab:        learning.NewVocabStore(cfg.LogsDir),
+		Documents:    learning.NewDocumentStore(cfg.LogsDir),
+
+		inlineQueries:   make(map[int]string),
+		inlineRefusals:  make(map[int]inlineRefusal),
+		quizzes:         make(map[string]*learning.Quiz),
+		sessions:        learning.NewSessions(sessionGap),
+		exams:           activeExams,
+		documentContext: make(map[helper.ConversationKey]string),
+	}
+	if cfg.AutoFlashcards {
+		openAI.OnSummarise = b.autoFlashcards
+	}
+	openAI.SystemContext = b.systemContext
+	openAI.OnHint = b.recordHint
+	return b
+}
+
+// Run получает обновления от Telegram и обрабатывает их по очереди
+func (b *Bot) Run() error {
+	log.Printf("Authorized on account %s", b.API.Self.UserName)
+	b.pollUpdates(60, b.handleUpdate, b.tick)
+	return nil
+}
+
+func (b *Bot) handleUpdate(update telegram.Update) {
+	switch {
+	case update.InlineQuery != nil:
+		b.handleInlineQuery(&update)
+		return
+	case update.ChosenInlineResult != nil:
+		b.handleChosenInlineResult(&update)
+		return
+	case update.CallbackQuery != nil:
+		b.handleCallbackQuery(&update)
+		return
+	}
+
+	if update.Message == nil || update.Message.From == nil {
+		return
+	}
+	if update.Message.IsCommand() {
+		b.handleCommand(&update)
+		return
+	}
+	if update.Message.Document != nil {
+		b.handleDocument(&update)
+		return
+	}
+	b.handlePrompt(&update)
+}
+
+// handlePrompt отвечает на обычное сообщение пользователя
+func (b *Bot) handlePrompt(update *telegram.Update) {
+	message := update.Message
+	if !utils.IsAddressedToBot(b.Config, b.API, message) {
+		return
+	}
+	prompt := utils.StripMention(utils.MessageText(message), b.API.Self.UserName)
+	// начатый экзамен принимает ответы, даже если бюджет закончился во время него
+	if prompt != "" && b.handleExamAnswer(message, prompt) {
+		return
+	}
+	if !b.checkAllowedAndWithinBudget(update, false) {
+		return
+	}
+	if prompt == "" {
+		return
+	}
+	conversation := utils.GetConversationKey(b.Config, message)
+	cfg := b.OpenAI.ChatConfig(conversation)
+
+	log.Printf("New message received from user %s (id: %d)", message.From.UserName, message.From.ID)
+	if b.handleCheckpointAnswer(message, conversation, prompt) {
+		return
+	}
+	b.recordChat(message.From.ID, message.Chat.ID, prompt)
+	b.correctMessage(message, conversation, prompt)
+	b.retrieveDocuments(conversation, message.From.ID, message.Chat, prompt)
+	defer delete(b.documentContext, conversation)
+
+	if cfg.Stream {
+		chunks, errs := b.OpenAI.GetChatResponseStream(conversation, prompt)
+		tokensUsed, err := utils.StreamResponse(b.API, cfg, message, chunks, errs)
+		if err != nil {
+			if tokensUsed > 0 {
+				b.sendBudgetAlerts(utils.AddChatRequestToUsageTracker(b.Usage, b.Config, message.From.ID, message.Chat, cfg.Model, tokensUsed))
+			}
+			utils.ErrorHandler(err)
+			b.reply(message, b.text(message.Chat.ID, "chat_fail")+": "+err.Error())
+			return
+		}
+		alerts := utils.AddChatRequestToUsageTracker(b.Usage, b.Config, message.From.ID, message.Chat, cfg.Model, tokensUsed)
+		b.sendBudgetAlerts(alerts)
+		b.updateVocabulary(message, conversation)
+		return
+	}
+
+	err := utils.WrapWithIndicator(b.API, message.Chat.ID, telegram.ChatTyping, func() error {
+		answer, tokensUsed, err := b.OpenAI.GetChatResponse(conversation, prompt)
+		if err != nil {
+			return err
+		}
+		alerts := utils.AddChatRequestToUsageTracker(b.Usage, b.Config, message.From.ID, message.Chat, cfg.Model, tokensUsed)
+		defer b.sendBudgetAlerts(alerts)
+
+		b.reply(message, answer)
+		return nil
+	})
+	if err != nil {
+		// запросы, выполненные до ошибки, например раунды запуска кода, оплачены
+		if tokensUsed := helper.TokensUsedBy(err); tokensUsed > 0 {
+			b.sendBudgetAlerts(utils.AddChatRequestToUsageTracker(b.Usage, b.Config, message.From.ID, message.Chat, cfg.Model, tokensUsed))
+		}
+		utils.ErrorHandler(err)
+		b.reply(message, b.text(message.Chat.ID, "chat_fail")+": "+err.Error())
+		return
+	}
+	b.updateVocabulary(message, conversation)
+}
+
+// checkAllowedAndWithinBudget проверяет доступ и бюджет пользователя и сообщает ему об отказе
+func (b *Bot) checkAllowedAndWithinBudget(update *telegram.Update, isInline bool) bool {
+	refusal := b.refusal(update, isInline)
+	if refusal != "" {
+		b.reply(update.Message, b.text(update.Message.Chat.ID, refusal))
+		return false
+	}
+	return true
+}
+
+// refusal возвращает ключ перевода с причиной отказа или пустую строку, если пользователь может отправить запрос
+func (b *Bot) refusal(update *telegram.Update, isInline bool) string {
+	user := utils.UpdateUser(update, isInline)
+
+	allowed, err := utils.IsAllowed(b.Config, update, b.API, isInline)
+	if err != nil {
+		utils.ErrorHandler(err)
+	}
+	if !allowed {
+		log.Printf("User %s (id: %d) is not allowed to use the bot", user.UserName, user.ID)
+		return "disallowed"
+	}
+
+	// ответы на экзамен приходят обычными сообщениями, а inline-запросом можно было бы получить подсказку
+	if _, ok := b.exams[user.ID]; ok && isInline {
+		return "exam_in_progress"
+	}
+
+	if !utils.IsWithinBudget(b.Config, b.Usage, update, isInline) {
+		log.Printf("User %s (id: %d) reached their usage limit", user.UserName, user.ID)
+		return "budget_limit"
+	}
+
+	if !utils.IsWithinOrgBudget(b.Config, b.Usage, user.ID) {
+		log.Printf("Organisation budget reached, refusing user %s (id: %d)", user.UserName, user.ID)
+		return "org_budget_limit"
+	}
+	return ""
+}
+
+// reply отправляет ответ в чат сообщения, преобразуя Markdown в HTML Telegram и разбивая длинный текст на сообщения.
+// Если Telegram не принял разметку, сообщение отправляется без нее
+func (b *Bot) reply(message *telegram.Message, text string) {
+	b.sendFormatted(message.Chat.ID, 0, utils.GetReplyToMessageID(b.Config, message), text)
+}
+
+// sendMarkdown отправляет текст с разметкой Markdown в чат или тему форума threadID без цитирования, как reply
+func (b *Bot) sendMarkdown(chatID int64, threadID int, text string) {
+	b.sendFormatted(chatID, threadID, 0, text)
+}
+
+func (b *Bot) sendFormatted(chatID int64, threadID, replyToMessageID int, text string) {
+	for _, chunk := range utils.RenderTelegramHTML(text, 4096) {
+		msg := telegram.NewMessage(chatID, chunk)
+		msg.ReplyToMessageID = replyToMessageID
+		msg.ParseMode = telegram.ModeHTML
+
+		if _, err := utils.SendMessage(b.API, msg, threadID); err != nil {
+			log.Printf("Failed to send formatted message, sending as plain text: %v", err)
+			msg.Text = utils.StripHTML(chunk)
+			msg.ParseMode = ""
+			if _, err := utils.SendMessage(b.API, msg, threadID); err != nil {
+				log.Printf("Failed to send message: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// text возвращает перевод на язык, выбранный в чате
+func (b *Bot) text(chatID int64, key string) string {
+	return helper.LocalizedText(key, b.Config.ForChat(chatID).BotLanguage)
+}
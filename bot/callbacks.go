@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"log"
+	"strings"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	"tutor/utils"
+)
+
+// callbackHandler обрабатывает нажатие кнопки. args - данные кнопки после префикса обработчика.
+// Возвращаемый текст показывается пользователю во всплывающем уведомлении
+type callbackHandler func(b *Bot, query *telegram.CallbackQuery, args string) (string, error)
+
+// callbackHandlers возвращает обработчики кнопок по префиксу данных "<префикс>:<аргументы>"
+func (b *Bot) callbackHandlers() map[string]callbackHandler {
+	return map[string]callbackHandler{
+		"settings": (*Bot).settingsCallback,
+		"quiz":     (*Bot).quizCallback,
+		"review":   (*Bot).reviewCallback,
+		"vocab":    (*Bot).vocabCallback,
+	}
+}
+
+func (b *Bot) handleCallbackQuery(update *telegram.Update) {
+	query := update.CallbackQuery
+	if query.From == nil {
+		return
+	}
+
+	prefix, args, _ := strings.Cut(query.Data, ":")
+	notice := ""
+	if handler, ok := b.callbackHandlers()[prefix]; ok && query.Message != nil {
+		var err error
+		if !b.callbackAllowed(query) {
+			notice = b.text(query.Message.Chat.ID, "disallowed")
+		} else if _, ok := b.exams[query.From.ID]; ok {
+			// тесты, карточки и словарь могут подсказать ответ, а настройки - включить решения вместо подсказок
+			notice = b.text(query.Message.Chat.ID, "exam_in_progress")
+		} else if notice, err = handler(b, query, args); err != nil {
+			utils.ErrorHandler(err)
+			notice = b.text(query.Message.Chat.ID, "error")
+		}
+	}
+
+	// без ответа у пользователя продолжает крутиться индикатор загрузки на кнопке
+	if _, err := b.API.AnswerCallbackQuery(telegram.NewCallback(query.ID, notice)); err != nil {
+		log.Printf("Failed to answer callback query: %v", err)
+	}
+}
+
+// callbackAllowed проверяет доступ к боту так же, как для сообщений: кнопки остаются в чате
+// и после того, как пользователя удалили из реестра
+func (b *Bot) callbackAllowed(query *telegram.CallbackQuery) bool {
+	update := &telegram.Update{Message: &telegram.Message{From: query.From, Chat: query.Message.Chat}}
+	allowed, err := utils.IsAllowed(b.Config, update, b.API, false)
+	if err != nil {
+		utils.ErrorHandler(err)
+	}
+	if !allowed {
+		log.Printf("User %s (id: %d) is not allowed to use the bot", query.From.UserName, query.From.ID)
+	}
+	return allowed
+}
@@ -0,0 +1,173 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	"tutor/helper"
+	"tutor/utils"
+)
+
+// command описывает обработчик команды и право, необходимое для ее вызова
+type command struct {
+	name       string
+	permission utils.Permission
+	handler    func(b *Bot, message *telegram.Message) error
+}
+
+// commands возвращает список команд в порядке вывода в /help
+func (b *Bot) commands() []command {
+	return []command{
+		{"help", utils.PermChat, (*Bot).help},
+		{"reset", utils.PermChat, (*Bot).reset},
+		{"stats", utils.PermChat, (*Bot).stats},
+		{"settings", utils.PermChat, (*Bot).settings},
+		{"mode", utils.PermChat, (*Bot).mode},
+		{"quiz", utils.PermChat, (*Bot).quiz},
+		{"flashcards", utils.PermChat, (*Bot).flashcards},
+		{"review", utils.PermChat, (*Bot).review},
+		{"vocab", utils.PermChat, (*Bot).vocab},
+		{"lesson", utils.PermChat, (*Bot).lesson},
+		{"exam", utils.PermChat, (*Bot).exam},
+		{"docs", utils.PermChat, (*Bot).docs},
+		{"addmode", utils.PermManageUsers, (*Bot).addMode},
+		{"progress", utils.PermManageStudents, (*Bot).progress},
+		{"setbudget", utils.PermManageStudents, (*Bot).setBudget},
+		{"allow", utils.PermManageUsers, (*Bot).allow},
+		{"deny", utils.PermManageUsers, (*Bot).deny},
+		{"resetusage", utils.PermManageUsers, (*Bot).resetUsage},
+		{"users", utils.PermManageUsers, (*Bot).users},
+	}
+}
+
+func (b *Bot) handleCommand(update *telegram.Update) {
+	message := update.Message
+	name := message.Command()
+
+	for _, cmd := range b.commands() {
+		if cmd.name != name {
+			continue
+		}
+
+		allowed, err := utils.IsAllowed(b.Config, update, b.API, false)
+		if err != nil {
+			utils.ErrorHandler(err)
+		}
+		if !allowed {
+			b.reply(message, b.text(message.Chat.ID, "disallowed"))
+			return
+		}
+		if !utils.HasPermission(b.Config, message.From.ID, cmd.permission) {
+			log.Printf("User %s (id: %d) is not permitted to use /%s", message.From.UserName, message.From.ID, name)
+			b.reply(message, b.text(message.Chat.ID, "not_permitted"))
+			return
+		}
+
+		if _, ok := b.exams[message.From.ID]; ok && !examCommands[name] {
+			b.reply(message, b.text(message.Chat.ID, "exam_command_blocked"))
+			return
+		}
+
+		if err := cmd.handler(b, message); err != nil {
+			utils.ErrorHandler(err)
+			b.reply(message, fmt.Sprintf("⚠️ _%s._ ⚠️\n%s", b.text(message.Chat.ID, "error"), err.Error()))
+		}
+		return
+	}
+}
+
+// help показывает команды, доступные пользователю
+func (b *Bot) help(message *telegram.Message) error {
+	lines := []string{b.text(message.Chat.ID, "help_text"), "", "**" + b.text(message.Chat.ID, "commands") + "**"}
+	for _, cmd := range b.commands() {
+		if utils.HasPermission(b.Config, message.From.ID, cmd.permission) {
+			lines = append(lines, fmt.Sprintf("/%s - %s", cmd.name, b.text(message.Chat.ID, cmd.name+"_description")))
+		}
+	}
+	b.reply(message, strings.Join(lines, "\n"))
+	return nil
+}
+
+// reset сбрасывает историю диалога. Учитель может сбросить историю личного чата своего студента
+func (b *Bot) reset(message *telegram.Message) error {
+	conversation := utils.GetConversationKey(b.Config, message)
+	content := utils.MessageText(message)
+
+	targetID := 0
+	if args := strings.Fields(message.CommandArguments()); len(args) > 0 {
+		var ok bool
+		targetID, ok = b.parseManagedUser(message, args[0])
+		if !ok {
+			return nil
+		}
+		// у личного чата с пользователем ID совпадает с ID пользователя
+		conversation = helper.ChatConversation(int64(targetID))
+		content = strings.TrimSpace(strings.Join(args[1:], " "))
+	}
+
+	log.Printf("Resetting the conversation %s on behalf of user %s (id: %d)", conversation, message.From.UserName, message.From.ID)
+	if targetID != 0 {
+		b.audit(message, "reset", targetID, "")
+	}
+	b.OpenAI.ResetChatHistory(conversation, content)
+	b.reply(message, b.text(message.Chat.ID, "reset_done"))
+	return nil
+}
+
+// setBudget меняет бюджет пользователя: /setbudget <id> <сумма|*>
+func (b *Bot) setBudget(message *telegram.Message) error {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) != 2 {
+		b.reply(message, b.text(message.Chat.ID, "invalid_arguments")+"\n"+b.text(message.Chat.ID, "setbudget_description"))
+		return nil
+	}
+
+	targetID, ok := b.parseManagedUser(message, args[0])
+	if !ok {
+		return nil
+	}
+	// свой бюджет может менять только администратор
+	if !utils.CanManageUser(b.Config, message.From.ID, targetID) {
+		b.reply(message, b.text(message.Chat.ID, "not_permitted"))
+		return nil
+	}
+
+	var budget *float64
+	if args[1] != "*" {
+		amount, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || amount < 0 {
+			b.reply(message, b.text(message.Chat.ID, "invalid_arguments"))
+			return nil
+		}
+		budget = &amount
+	}
+
+	if err := b.Config.UserRegistry().SetBudget(targetID, budget); err != nil {
+		return err
+	}
+	b.audit(message, "setbudget", targetID, args[1])
+	b.reply(message, b.text(message.Chat.ID, "setbudget_done"))
+	return nil
+}
+
+// parseManagedUser разбирает ID пользователя из аргумента команды и проверяет, что автор команды может им управлять
+func (b *Bot) parseManagedUser(message *telegram.Message, arg string) (int, bool) {
+	targetID, err := strconv.Atoi(arg)
+	if err != nil {
+		b.reply(message, b.text(message.Chat.ID, "invalid_arguments"))
+		return 0, false
+	}
+	if _, ok := b.Config.UserRegistry().Lookup(targetID); !ok {
+		b.reply(message, b.text(message.Chat.ID, "user_not_found"))
+		return 0, false
+	}
+	if targetID != message.From.ID && !utils.CanManageUser(b.Config, message.From.ID, targetID) {
+		b.reply(message, b.text(message.Chat.ID, "not_permitted"))
+		return 0, false
+	}
+	return targetID, true
+}
@@ -0,0 +1,52 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	"tutor/helper"
+	"tutor/utils"
+)
+
+// correctMessage в режиме исправлений отвечает на сообщение ученика исправлением в виде сравнения по словам
+// со списком правок. Токены учитываются в отдельной категории трекера. Ошибки проверки не мешают диалогу
+func (b *Bot) correctMessage(message *telegram.Message, conversation helper.ConversationKey, text string) {
+	cfg := b.OpenAI.ChatConfig(conversation)
+	if !cfg.CorrectionMode {
+		return
+	}
+
+	correction, tokensUsed, err := b.OpenAI.CorrectText(conversation, text)
+	if tokensUsed > 0 {
+		b.sendBudgetAlerts(utils.AddCorrectionRequestToUsageTracker(b.Usage, b.Config, message.From.ID, message.Chat, cfg.Model, tokensUsed))
+	}
+	if err != nil {
+		log.Printf("Failed to correct the message of user %d: %v", message.From.ID, err)
+		return
+	}
+	if len(correction.Edits) == 0 {
+		return
+	}
+
+	lines := []string{"✏️ " + b.text(message.Chat.ID, "correction_title")}
+	if diff, ok := utils.WordDiff(text, correction.Corrected); ok {
+		lines = append(lines, diff)
+	} else {
+		lines = append(lines, utils.EscapeMarkdown(correction.Corrected))
+	}
+	lines = append(lines, "")
+	for _, edit := range correction.Edits {
+		line := fmt.Sprintf("• ~~%s~~ → **%s**", utils.EscapeMarkdown(edit.Original), utils.EscapeMarkdown(edit.Correction))
+		if edit.Original == "" {
+			line = "• **" + utils.EscapeMarkdown(edit.Correction) + "**"
+		}
+		if edit.Explanation != "" {
+			line += ": " + edit.Explanation
+		}
+		lines = append(lines, line)
+	}
+	b.reply(message, strings.Join(lines, "\n"))
+}
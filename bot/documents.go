@@ -0,0 +1,168 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	"tutor/helper"
+	"tutor/learning"
+	"tutor/utils"
+)
+
+const (
+	// documentMatches - сколько фрагментов документов добавляется к запросу
+	documentMatches = 4
+	// minDocumentScore - минимальная косинусная близость фрагмента к запросу, менее близкие фрагменты не добавляются
+	minDocumentScore = 0.3
+)
+
+// handleDocument добавляет присланный файл в учебные материалы чата. Документы чата меняют те же пользователи,
+// что и его настройки. В группе файл должен быть обращен к боту, например упоминанием в подписи,
+// иначе бот не трогает файлы, которыми участники делятся друг с другом
+func (b *Bot) handleDocument(update *telegram.Update) {
+	message := update.Message
+	document := message.Document
+	chatID := message.Chat.ID
+
+	addressed := *message
+	addressed.Text = message.Caption
+	if !utils.IsAddressedToBot(b.Config, b.API, &addressed) {
+		return
+	}
+	if !b.checkAllowedAndWithinBudget(update, false) {
+		return
+	}
+	if !b.canChangeSettings(message.From.ID, message.Chat) {
+		b.reply(message, b.text(chatID, "not_permitted"))
+		return
+	}
+	if !learning.SupportedDocument(document.FileName) {
+		b.reply(message, b.text(chatID, "document_unsupported"))
+		return
+	}
+	if document.FileSize > utils.MaxDownloadSize {
+		b.reply(message, b.text(chatID, "document_too_large"))
+		return
+	}
+
+	log.Printf("Document %q received from user %s (id: %d)", document.FileName, message.From.UserName, message.From.ID)
+	var added learning.Document
+	err := utils.WrapWithIndicator(b.API, chatID, telegram.ChatTyping, func() error {
+		data, err := utils.DownloadFile(b.API, document.FileID, utils.MaxDownloadSize)
+		if err != nil {
+			return err
+		}
+		chunks, pages, tokens, err := b.OpenAI.IngestDocument(document.FileName, data)
+		if tokens > 0 {
+			b.sendBudgetAlerts(utils.AddEmbeddingRequestToUsageTracker(b.Usage, b.Config, message.From.ID, message.Chat, tokens))
+		}
+		if err != nil {
+			return err
+		}
+		added, err = b.Documents.Add(chatID, learning.Document{
+			Name:       document.FileName,
+			Pages:      pages,
+			Model:      b.Config.EmbeddingModel,
+			UploadedBy: message.From.ID,
+		}, chunks)
+		return err
+	})
+	if err != nil {
+		utils.ErrorHandler(err)
+		b.reply(message, b.text(chatID, "document_fail")+": "+err.Error())
+		return
+	}
+	b.reply(message, fmt.Sprintf(b.text(chatID, "document_added"), added.Name, added.Pages, added.Chunks))
+}
+
+// docs показывает учебные материалы чата: /docs - список, /docs remove <id> - удалить документ
+func (b *Bot) docs(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	command, rest, _ := strings.Cut(strings.TrimSpace(message.CommandArguments()), " ")
+
+	switch command {
+	case "":
+		documents, err := b.Documents.Documents(chatID)
+		if err != nil {
+			return err
+		}
+		if len(documents) == 0 {
+			b.reply(message, b.text(chatID, "docs_empty"))
+			return nil
+		}
+		lines := []string{"**" + b.text(chatID, "docs_title") + "**"}
+		for _, doc := range documents {
+			lines = append(lines, fmt.Sprintf(b.text(chatID, "docs_entry"), doc.ID, doc.Name, doc.Pages, doc.Chunks, doc.Uploaded))
+		}
+		b.reply(message, strings.Join(lines, "\n"))
+		return nil
+	case "remove":
+		if !b.canChangeSettings(message.From.ID, message.Chat) {
+			b.reply(message, b.text(chatID, "not_permitted"))
+			return nil
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(rest))
+		if err != nil {
+			break
+		}
+		removed, err := b.Documents.Remove(chatID, id)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			b.reply(message, b.text(chatID, "docs_not_found"))
+			return nil
+		}
+		b.reply(message, b.text(chatID, "docs_removed"))
+		return nil
+	}
+
+	b.reply(message, b.text(chatID, "invalid_arguments")+"\n"+b.text(chatID, "docs_description"))
+	return nil
+}
+
+// retrieveDocuments находит фрагменты документов чата, близкие к запросу, и добавляет их к следующему запросу
+// диалога через systemContext. Эмбеддинг запроса оплачивает пользователь. Вызывающий удаляет фрагменты
+// из documentContext после ответа
+func (b *Bot) retrieveDocuments(conversation helper.ConversationKey, userID int, chat *telegram.Chat, prompt string) {
+	documents, err := b.Documents.Documents(conversation.ChatID)
+	if err != nil {
+		log.Printf("Error loading documents of chat %d: %v", conversation.ChatID, err)
+		return
+	}
+	if len(documents) == 0 {
+		return
+	}
+
+	embeddings, tokens, err := b.OpenAI.EmbedTexts([]string{prompt})
+	if tokens > 0 {
+		b.sendBudgetAlerts(utils.AddEmbeddingRequestToUsageTracker(b.Usage, b.Config, userID, chat, tokens))
+	}
+	if err != nil {
+		log.Printf("Failed to embed the query in conversation %s: %v", conversation, err)
+		return
+	}
+	matches, err := b.Documents.Search(conversation.ChatID, b.Config.EmbeddingModel, embeddings[0], documentMatches, minDocumentScore)
+	if err != nil {
+		log.Printf("Error searching documents of chat %d: %v", conversation.ChatID, err)
+		return
+	}
+	if len(matches) > 0 {
+		b.documentContext[conversation] = helper.DocumentInstructions(matches)
+	}
+}
+
+// systemContext возвращает дополнительные инструкции диалога: шаг урока и найденные фрагменты документов
+func (b *Bot) systemContext(key helper.ConversationKey) string {
+	var instructions []string
+	for _, text := range []string{b.lessonContext(key), b.documentContext[key]} {
+		if text != "" {
+			instructions = append(instructions, text)
+		}
+	}
+	return strings.Join(instructions, "\n\n")
+}
@@ -0,0 +1,271 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	"tutor/helper"
+	"tutor/learning"
+	"tutor/utils"
+)
+
+const (
+	defaultExamQuestions = 5
+	maxExamQuestions     = 20
+	// examResultsShown - сколько последних результатов выводит /exam results
+	examResultsShown = 5
+)
+
+// examCommands - команды, доступные во время экзамена. Остальные могут подсказать ответ или изменить историю диалога
+var examCommands = map[string]bool{"exam": true, "help": true}
+
+// exam проводит экзамен с ограничением по времени: /exam [число вопросов] <банк|тема> начинает экзамен,
+// /exam finish сдает его досрочно, /exam results показывает последние результаты.
+// Пока идет экзамен, сообщения ученика считаются ответами на вопросы
+func (b *Bot) exam(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	userID := message.From.ID
+	args := strings.Fields(message.CommandArguments())
+
+	session, active := b.exams[userID]
+	if len(args) == 1 && args[0] == "finish" {
+		if !active {
+			b.reply(message, b.text(chatID, "exam_not_active"))
+			return nil
+		}
+		b.finishExam(session)
+		return nil
+	}
+	if active {
+		b.reply(message, b.text(chatID, "exam_in_progress"))
+		return nil
+	}
+	if len(args) == 1 && args[0] == "results" {
+		return b.examResults(message)
+	}
+	if len(args) == 0 {
+		return b.examList(message)
+	}
+
+	conversation := utils.GetConversationKey(b.Config, message)
+	if learner, ok := conversationLearner(conversation); !ok || learner != userID {
+		b.reply(message, b.text(chatID, "exam_private_only"))
+		return nil
+	}
+	if !b.checkAllowedAndWithinBudget(&telegram.Update{Message: message}, false) {
+		return nil
+	}
+
+	count := defaultExamQuestions
+	if n, err := strconv.Atoi(args[0]); err == nil {
+		if n < 1 || n > maxExamQuestions || len(args) == 1 {
+			b.reply(message, b.text(chatID, "invalid_arguments")+"\n"+b.text(chatID, "exam_description"))
+			return nil
+		}
+		count, args = n, args[1:]
+	}
+	topic := strings.Join(args, " ")
+
+	title := topic
+	limit := time.Duration(b.Config.ExamTimeLimitMinutes) * time.Minute
+	var questions []learning.ExamQuestion
+	if bank, ok := b.Exams.Lookup(topic); ok {
+		title = bank.Title
+		questions = bank.Pick(count)
+		if bank.TimeLimitMinutes > 0 {
+			limit = time.Duration(bank.TimeLimitMinutes) * time.Minute
+		}
+	} else {
+		err := utils.WrapWithIndicator(b.API, chatID, telegram.ChatTyping, func() error {
+			var tokensUsed int
+			var err error
+			questions, tokensUsed, err = b.OpenAI.GenerateExam(conversation, topic, count)
+			if tokensUsed > 0 {
+				model := b.OpenAI.ChatConfig(conversation).Model
+				b.sendBudgetAlerts(utils.AddChatRequestToUsageTracker(b.Usage, b.Config, userID, message.Chat, model, tokensUsed))
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	session = learning.NewExamSession(userID, chatID, title, questions, limit, time.Now())
+	session.ThreadID = conversation.ThreadID
+	b.exams[userID] = session
+	b.saveExams()
+	log.Printf("User %s (id: %d) started exam %q with %d questions", message.From.UserName, userID, title, len(questions))
+
+	b.reply(message, fmt.Sprintf(b.text(chatID, "exam_started"), title, len(questions), int(limit.Minutes())))
+	b.sendExamQuestion(session)
+	return nil
+}
+
+// examList выводит банки вопросов
+func (b *Bot) examList(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	lines := []string{b.text(chatID, "exam_description")}
+	if banks := b.Exams.List(); len(banks) > 0 {
+		lines = append(lines, "", "**"+b.text(chatID, "exam_banks")+"**")
+		for _, bank := range banks {
+			lines = append(lines, fmt.Sprintf("`%s` - %s (%d)", bank.ID, bank.Title, len(bank.Questions)))
+		}
+	}
+	b.reply(message, strings.Join(lines, "\n"))
+	return nil
+}
+
+// examResults выводит последние результаты экзаменов ученика
+func (b *Bot) examResults(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	results, err := b.ExamResults.List(message.From.ID)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		b.reply(message, b.text(chatID, "exam_no_results"))
+		return nil
+	}
+	if len(results) > examResultsShown {
+		results = results[len(results)-examResultsShown:]
+	}
+
+	lines := []string{"**" + b.text(chatID, "exam_results_title") + "**"}
+	for i := len(results) - 1; i >= 0; i-- {
+		result := results[i]
+		lines = append(lines, fmt.Sprintf("%s %s: %g/%g", result.Finished.Format("2006-01-02"), result.Title, result.Score, result.Points))
+	}
+	b.reply(message, strings.Join(lines, "\n"))
+	return nil
+}
+
+// sendExamQuestion отправляет текущий вопрос экзамена с оставшимся временем
+func (b *Bot) sendExamQuestion(session *learning.ExamSession) {
+	index := session.Current()
+	question := session.Questions[index]
+	remaining := int(time.Until(session.Deadline).Minutes() + 0.5)
+	b.sendMarkdown(session.ChatID, session.ThreadID, fmt.Sprintf(b.text(session.ChatID, "exam_question"),
+		index+1, len(session.Questions), question.MaxPoints(), question.Question, remaining))
+}
+
+// handleExamAnswer принимает сообщение ученика как ответ на вопрос экзамена.
+// Возвращает false, если у ученика нет экзамена и сообщение нужно обработать как обычный вопрос
+func (b *Bot) handleExamAnswer(message *telegram.Message, answer string) bool {
+	session, ok := b.exams[message.From.ID]
+	if !ok {
+		return false
+	}
+	// во время экзамена тьютор не помогает ни в одном чате
+	if session.ChatID != message.Chat.ID {
+		b.reply(message, b.text(message.Chat.ID, "exam_in_progress"))
+		return true
+	}
+	if session.Expired(time.Now()) {
+		b.finishExam(session)
+		return true
+	}
+
+	session.Answer(answer)
+	b.saveExams()
+	if session.Done() {
+		b.finishExam(session)
+	} else {
+		b.sendExamQuestion(session)
+	}
+	return true
+}
+
+// finishExam завершает экзамен и запускает оценку ответов, см. gradeExam
+func (b *Bot) finishExam(session *learning.ExamSession) {
+	delete(b.exams, session.UserID)
+	b.saveExams()
+	chatID := session.ChatID
+	now := time.Now()
+	if session.Expired(now) {
+		b.send(chatID, session.ThreadID, b.text(chatID, "exam_time_up"))
+	}
+	go b.gradeExam(session, now)
+}
+
+// gradeExam оценивает ответы в отдельной горутине, чтобы запрос к модели не останавливал цикл обновлений,
+// и под b.mu списывает токены, сохраняет результат и отправляет его ученику. Если оценить ответы не удалось,
+// результат сохраняется без баллов, чтобы учитель мог проверить его сам
+func (b *Bot) gradeExam(session *learning.ExamSession, now time.Time) {
+	chatID := session.ChatID
+	var graded []learning.GradedAnswer
+	var summary string
+	var tokensUsed int
+	conversation := helper.ChatConversation(chatID)
+	err := utils.WrapWithIndicator(b.API, chatID, telegram.ChatTyping, func() error {
+		var err error
+		graded, summary, tokensUsed, err = b.OpenAI.GradeExam(conversation, session.Questions, session.Answers)
+		return err
+	})
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if tokensUsed > 0 {
+		model := b.OpenAI.ChatConfig(conversation).Model
+		b.sendBudgetAlerts(utils.AddChatRequestToUsageTracker(b.Usage, b.Config, session.UserID, nil, model, tokensUsed))
+	}
+	if err != nil {
+		utils.ErrorHandler(err)
+		b.send(chatID, session.ThreadID, b.text(chatID, "exam_grading_failed")+": "+err.Error())
+		graded = make([]learning.GradedAnswer, len(session.Questions))
+		for i, question := range session.Questions {
+			graded[i] = learning.GradedAnswer{Question: question.Question, Points: question.MaxPoints()}
+			if i < len(session.Answers) {
+				graded[i].Answer = session.Answers[i]
+			}
+		}
+	}
+
+	result := learning.NewExamResult(session, graded, summary, now)
+	if err := b.ExamResults.Record(session.UserID, result); err != nil {
+		log.Printf("Failed to save exam result of user %d: %v", session.UserID, err)
+	}
+	share := 0.0
+	if result.Points > 0 {
+		share = result.Score / result.Points
+	}
+	b.recordEvent(session.UserID, learning.Event{Type: learning.EventExam, Topic: result.Title,
+		Detail: fmt.Sprintf("%g/%g", result.Score, result.Points), Value: share})
+
+	if err == nil {
+		b.sendMarkdown(chatID, session.ThreadID, b.examReport(chatID, result))
+	}
+}
+
+// examReport описывает результат экзамена для ученика
+func (b *Bot) examReport(chatID int64, result learning.ExamResult) string {
+	lines := []string{fmt.Sprintf(b.text(chatID, "exam_result"), result.Title, result.Score, result.Points)}
+	for i, answer := range result.Answers {
+		lines = append(lines, fmt.Sprintf("**%d.** %g/%g - %s", i+1, answer.Score, answer.Points, answer.Feedback))
+	}
+	if result.Summary != "" {
+		lines = append(lines, "", result.Summary)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// saveExams сохраняет идущие экзамены
+func (b *Bot) saveExams() {
+	if err := b.ExamResults.SaveActive(b.exams); err != nil {
+		log.Printf("Failed to save active exams: %v", err)
+	}
+}
+
+// expireExams завершает экзамены, время которых вышло
+func (b *Bot) expireExams(now time.Time) {
+	for _, session := range b.exams {
+		if session.Expired(now) {
+			b.finishExam(session)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+	openai "github.com/sashabaranov/go-openai"
+
+	"tutor/helper"
+	"tutor/learning"
+	"tutor/utils"
+)
+
+// flashcardContextMessages - из скольких последних сообщений диалога извлекаются карточки по /flashcards make
+const flashcardContextMessages = 20
+
+// flashcards управляет карточками ученика: /flashcards показывает их число,
+// /flashcards make извлекает карточки из диалога, /flashcards export присылает их в CSV для Anki
+func (b *Bot) flashcards(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	switch strings.TrimSpace(message.CommandArguments()) {
+	case "make":
+		return b.makeFlashcards(message)
+	case "export":
+		return b.exportFlashcards(message)
+	case "":
+	default:
+		b.reply(message, b.text(chatID, "invalid_arguments")+"\n"+b.text(chatID, "flashcards_description"))
+		return nil
+	}
+
+	cards, err := b.Cards.Cards(message.From.ID)
+	if err != nil {
+		return err
+	}
+	due, err := b.Cards.Due(message.From.ID, time.Now())
+	if err != nil {
+		return err
+	}
+	b.reply(message, fmt.Sprintf(b.text(chatID, "flashcards_stats"), len(cards), len(due))+"\n\n"+b.text(chatID, "flashcards_description"))
+	return nil
+}
+
+// makeFlashcards извлекает карточки из последних сообщений диалога
+func (b *Bot) makeFlashcards(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	if !b.checkAllowedAndWithinBudget(&telegram.Update{Message: message}, false) {
+		return nil
+	}
+
+	conversation := utils.GetConversationKey(b.Config, message)
+	recent := b.OpenAI.RecentConversation(conversation, flashcardContextMessages)
+	if recent == "" {
+		b.reply(message, b.text(chatID, "flashcards_empty_conversation"))
+		return nil
+	}
+
+	var added int
+	err := utils.WrapWithIndicator(b.API, chatID, telegram.ChatTyping, func() error {
+		var err error
+		added, err = b.addFlashcards(message.From.ID, message.Chat, conversation, recent)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	b.reply(message, fmt.Sprintf(b.text(chatID, "flashcards_added"), added))
+	return nil
+}
+
+// addFlashcards извлекает карточки из текста диалога, списывает токены с пользователя и сохраняет новые карточки
+func (b *Bot) addFlashcards(userID int, chat *telegram.Chat, conversation helper.ConversationKey, text string) (int, error) {
+	cards, tokensUsed, err := b.OpenAI.ExtractFlashcards(conversation, text)
+	if tokensUsed > 0 {
+		model := b.OpenAI.ChatConfig(conversation).Model
+		b.sendBudgetAlerts(utils.AddChatRequestToUsageTracker(b.Usage, b.Config, userID, chat, model, tokensUsed))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return b.Cards.Add(userID, cards)
+}
+
+// autoFlashcards извлекает карточки из сообщений, которые вот-вот заменит краткое содержание диалога.
+// Работает для личных чатов и личных контекстов в группах, если пользователь не исчерпал бюджет
+func (b *Bot) autoFlashcards(conversation helper.ConversationKey, messages []openai.ChatCompletionMessage) {
+	userID := conversation.UserID
+	if userID == 0 && conversation.ChatID > 0 {
+		userID = int(conversation.ChatID)
+	}
+	if userID == 0 || utils.GetRemainingUserBudget(b.Config, b.Usage, userID, "") <= 0 {
+		return
+	}
+
+	added, err := b.addFlashcards(userID, nil, conversation, helper.FormatConversation(messages))
+	if err != nil {
+		log.Printf("Failed to extract flashcards for user %d: %v", userID, err)
+		return
+	}
+	log.Printf("Extracted %d flashcards for user %d from conversation %s", added, userID, conversation)
+	if added > 0 {
+		b.send(conversation.ChatID, conversation.ThreadID, fmt.Sprintf(b.text(conversation.ChatID, "flashcards_auto_added"), added))
+	}
+}
+
+// exportFlashcards присылает карточки ученика файлом CSV, который импортируется в Anki
+func (b *Bot) exportFlashcards(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	cards, err := b.Cards.Cards(message.From.ID)
+	if err != nil {
+		return err
+	}
+	if len(cards) == 0 {
+		b.reply(message, fmt.Sprintf(b.text(chatID, "flashcards_stats"), 0, 0))
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := learning.WriteAnkiCSV(&buf, cards, "tutor"); err != nil {
+		return err
+	}
+	doc := telegram.NewDocumentUpload(chatID, telegram.FileBytes{Name: "flashcards.csv", Bytes: buf.Bytes()})
+	doc.ReplyToMessageID = utils.GetReplyToMessageID(b.Config, message)
+	doc.Caption = b.text(chatID, "flashcards_export_caption")
+	_, err = b.API.Send(doc)
+	return err
+}
+
+// review начинает повторение карточек, которые пора повторить
+func (b *Bot) review(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	due, err := b.Cards.Due(message.From.ID, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(due) == 0 {
+		b.reply(message, b.text(chatID, "review_nothing_due"))
+		return nil
+	}
+
+	text, keyboard := b.reviewCard(chatID, message.From.ID, due[0], len(due), false)
+	msg := telegram.NewMessage(chatID, utils.ToTelegramHTML(text))
+	msg.ParseMode = telegram.ModeHTML
+	msg.ReplyToMessageID = utils.GetReplyToMessageID(b.Config, message)
+	msg.ReplyMarkup = keyboard
+	_, err = b.API.Send(msg)
+	return err
+}
+
+// reviewCard возвращает текст и кнопки карточки: лицевую сторону с кнопкой ответа или обе стороны с кнопками оценки
+func (b *Bot) reviewCard(chatID int64, userID int, card learning.Card, due int, showBack bool) (string, telegram.InlineKeyboardMarkup) {
+	prefix := fmt.Sprintf("review:%d:", userID)
+	text := fmt.Sprintf("**%s** (%s: %d)\n\n%s", b.text(chatID, "review_title"), b.text(chatID, "review_due"), due, card.Front)
+	if !showBack {
+		return text, telegram.NewInlineKeyboardMarkup(telegram.NewInlineKeyboardRow(
+			telegram.NewInlineKeyboardButtonData(b.text(chatID, "review_show"), prefix+fmt.Sprintf("show:%d", card.ID))))
+	}
+
+	text += "\n\n" + card.Back
+	grade := func(key string, grade learning.Grade) telegram.InlineKeyboardButton {
+		return telegram.NewInlineKeyboardButtonData(b.text(chatID, key), prefix+fmt.Sprintf("grade:%d:%d", card.ID, grade))
+	}
+	return text, telegram.NewInlineKeyboardMarkup(telegram.NewInlineKeyboardRow(
+		grade("review_again", learning.GradeAgain),
+		grade("review_hard", learning.GradeHard),
+		grade("review_good", learning.GradeGood),
+		grade("review_easy", learning.GradeEasy),
+	))
+}
+
+// reviewCallback обрабатывает кнопки повторения: "<ученик>:show:<карточка>" и "<ученик>:grade:<карточка>:<оценка>".
+// Нажимать их может только ученик, начавший повторение
+func (b *Bot) reviewCallback(query *telegram.CallbackQuery, args string) (string, error) {
+	chatID := query.Message.Chat.ID
+	parts := strings.Split(args, ":")
+	if len(parts) < 3 {
+		return "", fmt.Errorf("invalid review callback data %q", args)
+	}
+	userID, err1 := strconv.Atoi(parts[0])
+	cardID, err2 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil {
+		return "", fmt.Errorf("invalid review callback data %q", args)
+	}
+	if userID != query.From.ID {
+		return b.text(chatID, "not_permitted"), nil
+	}
+
+	now := time.Now()
+	var text string
+	var keyboard *telegram.InlineKeyboardMarkup
+	switch {
+	case parts[1] == "show":
+		card, ok, err := b.Cards.Get(userID, cardID)
+		if err != nil || !ok {
+			return b.text(chatID, "review_nothing_due"), err
+		}
+		due, err := b.Cards.Due(userID, now)
+		if err != nil {
+			return "", err
+		}
+		var markup telegram.InlineKeyboardMarkup
+		text, markup = b.reviewCard(chatID, userID, card, len(due), true)
+		keyboard = &markup
+	case parts[1] == "grade" && len(parts) == 4:
+		grade, err := strconv.Atoi(parts[3])
+		if err != nil || grade < 0 || grade > 5 {
+			return "", fmt.Errorf("invalid review callback data %q", args)
+		}
+		card, err := b.Cards.Review(userID, cardID, learning.Grade(grade), now)
+		if err != nil {
+			return "", err
+		}
+		b.recordEvent(userID, learning.Event{Time: now, Type: learning.EventFlashcardReview, Topic: card.Front, Value: float64(grade)})
+		due, err := b.Cards.Due(userID, now)
+		if err != nil {
+			return "", err
+		}
+		if len(due) == 0 {
+			text = b.text(chatID, "review_done")
+		} else {
+			var markup telegram.InlineKeyboardMarkup
+			text, markup = b.reviewCard(chatID, userID, due[0], len(due), false)
+			keyboard = &markup
+		}
+	default:
+		return "", fmt.Errorf("invalid review callback data %q", args)
+	}
+
+	edit := telegram.NewEditMessageText(chatID, query.Message.MessageID, utils.ToTelegramHTML(text))
+	edit.ParseMode = telegram.ModeHTML
+	edit.ReplyMarkup = keyboard
+	if _, err := b.API.Send(edit); err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		return "", err
+	}
+	return "", nil
+}
@@ -0,0 +1,171 @@
+package bot
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	"tutor/helper"
+	"tutor/utils"
+)
+
+// inlineQueryDebounce - сколько ждать новых символов, прежде чем отвечать на inline-запрос.
+// Telegram присылает запрос на каждое нажатие клавиши
+const inlineQueryDebounce = 700 * time.Millisecond
+
+const (
+	inlineResultPrompt  = "prompt"
+	inlineResultRefusal = "refusal"
+)
+
+// inlineRefusalTTL - сколько хранится причина отказа в inline-запросах пользователя
+const inlineRefusalTTL = 30 * time.Second
+
+// inlineRefusal - причина отказа в inline-запросе, пустая, если запрос разрешен, и время проверки
+type inlineRefusal struct {
+	reason  string
+	checked time.Time
+}
+
+// handleInlineQuery предлагает ответить на inline-запрос. Сам ответ генерируется только после выбора
+// результата пользователем, в handleChosenInlineResult, поэтому набор запроса ничего не стоит.
+// Для этого в настройках бота у @BotFather должен быть включен inline feedback
+func (b *Bot) handleInlineQuery(update *telegram.Update) {
+	query := update.InlineQuery
+	if query.From == nil || strings.TrimSpace(query.Query) == "" {
+		return
+	}
+
+	b.inlineMu.Lock()
+	b.inlineQueries[query.From.ID] = query.ID
+	b.inlineMu.Unlock()
+
+	go func() {
+		time.Sleep(inlineQueryDebounce)
+
+		b.inlineMu.Lock()
+		latest := b.inlineQueries[query.From.ID] == query.ID
+		if latest {
+			delete(b.inlineQueries, query.From.ID)
+		}
+		b.inlineMu.Unlock()
+		if !latest {
+			return
+		}
+
+		// проверки обращаются к трекерам использования, поэтому выполняются под b.mu
+		b.mu.Lock()
+		result := b.inlineQueryResult(update)
+		b.mu.Unlock()
+
+		_, err := b.API.AnswerInlineQuery(telegram.InlineConfig{
+			InlineQueryID: query.ID,
+			Results:       []interface{}{result},
+			IsPersonal:    true,
+		})
+		if err != nil {
+			log.Printf("Failed to answer inline query: %v", err)
+		}
+	}()
+}
+
+// inlineQueryResult возвращает результат inline-запроса: предложение ответить или причину отказа.
+// Причина отказа проверяется не чаще раза в inlineRefusalTTL, пока пользователь набирает запросы
+func (b *Bot) inlineQueryResult(update *telegram.Update) telegram.InlineQueryResultArticle {
+	query := update.InlineQuery
+	chatID := int64(query.From.ID)
+
+	refusal, ok := b.inlineRefusals[query.From.ID]
+	if !ok || time.Since(refusal.checked) > inlineRefusalTTL {
+		refusal = inlineRefusal{reason: b.refusal(update, true), checked: time.Now()}
+		b.inlineRefusals[query.From.ID] = refusal
+	}
+	if refusal.reason != "" {
+		return telegram.NewInlineQueryResultArticle(inlineResultRefusal, b.text(chatID, refusal.reason), b.text(chatID, refusal.reason))
+	}
+
+	result := telegram.NewInlineQueryResultArticle(inlineResultPrompt, b.text(chatID, "answer_with_tutor"),
+		"❓ "+query.Query+"\n\n⏳ "+b.text(chatID, "inline_loading"))
+	result.Description = query.Query
+	// без клавиатуры Telegram не передает inline_message_id, по которому сообщение редактируется
+	markup := telegram.NewInlineKeyboardMarkup(telegram.NewInlineKeyboardRow(
+		telegram.NewInlineKeyboardButtonData("⏳ "+b.text(chatID, "inline_loading"), inlineResultPrompt)))
+	result.ReplyMarkup = &markup
+	return result
+}
+
+// handleChosenInlineResult генерирует ответ на выбранный inline-запрос и записывает его в отправленное сообщение.
+// Разговор ведется в истории личного чата пользователя, расходы списываются с его бюджета.
+// Запрос к модели отправляется из горутины, чтобы цикл обновлений не ждал ответа
+func (b *Bot) handleChosenInlineResult(update *telegram.Update) {
+	result := update.ChosenInlineResult
+	if result.From == nil || result.ResultID != inlineResultPrompt || result.InlineMessageID == "" {
+		return
+	}
+
+	// бюджет мог закончиться, пока пользователь выбирал результат
+	delete(b.inlineRefusals, result.From.ID)
+	if refusal := b.refusal(update, true); refusal != "" {
+		b.editInline(result.InlineMessageID, b.text(int64(result.From.ID), refusal))
+		return
+	}
+
+	log.Printf("New inline query received from user %s (id: %d)", result.From.UserName, result.From.ID)
+	b.recordChat(result.From.ID, int64(result.From.ID), result.Query)
+
+	conversation := helper.ChatConversation(int64(result.From.ID))
+	b.retrieveDocuments(conversation, result.From.ID, nil, result.Query)
+	chat, err := b.OpenAI.PrepareChatRequest(conversation, result.Query)
+	delete(b.documentContext, conversation)
+	if err != nil {
+		b.inlineFailed(result, conversation, err)
+		return
+	}
+
+	go func() {
+		response, err := b.OpenAI.SendChatRequest(chat)
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if err != nil {
+			b.inlineFailed(result, conversation, err)
+			return
+		}
+		answer, tokensUsed, err := b.OpenAI.FinishChatResponse(chat, response)
+		if err != nil {
+			b.inlineFailed(result, conversation, &helper.UsageError{Err: err, TokensUsed: tokensUsed})
+			return
+		}
+		alerts := utils.AddChatRequestToUsageTracker(b.Usage, b.Config, result.From.ID, nil, b.OpenAI.ChatConfig(conversation).Model, tokensUsed)
+		defer b.sendBudgetAlerts(alerts)
+
+		b.editInline(result.InlineMessageID, "❓ "+result.Query+"\n\n"+answer)
+	}()
+}
+
+// inlineFailed сообщает об ошибке в inline-сообщении и списывает токены, уже потраченные на запрос
+func (b *Bot) inlineFailed(result *telegram.ChosenInlineResult, conversation helper.ConversationKey, err error) {
+	if tokensUsed := helper.TokensUsedBy(err); tokensUsed > 0 {
+		b.sendBudgetAlerts(utils.AddChatRequestToUsageTracker(b.Usage, b.Config, result.From.ID, nil, b.OpenAI.ChatConfig(conversation).Model, tokensUsed))
+	}
+	utils.ErrorHandler(err)
+	b.editInline(result.InlineMessageID, "❓ "+result.Query+"\n\n"+b.text(int64(result.From.ID), "chat_fail")+": "+err.Error())
+}
+
+// editInline заменяет текст inline-сообщения. Сообщение нельзя разбить на части, поэтому ответ обрезается
+func (b *Bot) editInline(inlineMessageID, text string) {
+	// Telegram считает длину отрисованного текста в единицах UTF-16, место для многоточия оставляется заранее
+	parts := utils.RenderTelegramHTML(text, 4095)
+	if len(parts) == 0 {
+		return
+	}
+	html := parts[0]
+	if len(parts) > 1 {
+		html += "…"
+	}
+	if err := utils.EditInlineMessage(b.API, inlineMessageID, html); err != nil {
+		log.Printf("Failed to edit inline message: %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	"tutor/helper"
+	"tutor/learning"
+	"tutor/utils"
+)
+
+// lesson ведет ученика по учебному плану: /lesson - список планов, /lesson <id> - начать или продолжить план,
+// /lesson next - перейти к следующему шагу, /lesson stop - прервать урок
+func (b *Bot) lesson(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	conversation := utils.GetConversationKey(b.Config, message)
+	if learner, ok := conversationLearner(conversation); !ok || learner != message.From.ID {
+		b.reply(message, b.text(chatID, "lesson_private_only"))
+		return nil
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		return b.lessonList(message)
+	}
+
+	userID := message.From.ID
+	switch args[0] {
+	case "next":
+		return b.lessonNext(message)
+	case "stop":
+		if _, err := b.LessonStates.Update(userID, func(state *learning.LessonState) {
+			state.Active, state.Awaiting = "", false
+		}); err != nil {
+			return err
+		}
+		b.reply(message, b.text(chatID, "lesson_stopped"))
+		return nil
+	}
+
+	plan, ok := b.Lessons.Lookup(args[0])
+	if !ok {
+		b.reply(message, b.text(chatID, "lesson_not_found"))
+		return nil
+	}
+	var progress learning.PlanProgress
+	if _, err := b.LessonStates.Update(userID, func(state *learning.LessonState) {
+		progress = *state.Start(plan.ID, time.Now())
+	}); err != nil {
+		return err
+	}
+	log.Printf("User %s (id: %d) started lesson %s at step %d", message.From.UserName, userID, plan.ID, progress.Step)
+	b.reply(message, b.lessonStepText(chatID, plan, progress.Step))
+	return nil
+}
+
+// lessonList выводит планы с прогрессом ученика
+func (b *Bot) lessonList(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	plans := b.Lessons.List()
+	if len(plans) == 0 {
+		b.reply(message, b.text(chatID, "lesson_no_plans"))
+		return nil
+	}
+
+	state, err := b.LessonStates.Get(message.From.ID)
+	if err != nil {
+		return err
+	}
+	lines := []string{"**" + b.text(chatID, "lesson_title") + "**"}
+	for _, plan := range plans {
+		line := fmt.Sprintf("`%s` - %s", plan.ID, plan.Title)
+		if plan.Description != "" {
+			line += ": " + plan.Description
+		}
+		if progress, ok := state.Plans[plan.ID]; ok {
+			if !progress.Finished.IsZero() {
+				line += " ✅"
+			} else {
+				line += fmt.Sprintf(" (%d/%d)", progress.Step, plan.StepCount())
+			}
+		}
+		if plan.ID == state.Active {
+			line += " ◀️"
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "", b.text(chatID, "lesson_description"))
+	b.reply(message, strings.Join(lines, "\n"))
+	return nil
+}
+
+// lessonNext завершает текущий шаг или, если у шага есть контрольный вопрос, задает его.
+// Следующее сообщение ученика в этом диалоге считается ответом на вопрос
+func (b *Bot) lessonNext(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	userID := message.From.ID
+	state, err := b.LessonStates.Get(userID)
+	if err != nil {
+		return err
+	}
+	progress := state.Current()
+	plan, ok := b.Lessons.Lookup(state.Active)
+	if progress == nil || !ok {
+		b.reply(message, b.text(chatID, "lesson_not_active"))
+		return nil
+	}
+	_, step, ok := plan.StepAt(progress.Step)
+	if !ok {
+		b.reply(message, b.text(chatID, "lesson_not_active"))
+		return nil
+	}
+
+	if step.Checkpoint != nil {
+		if _, err := b.LessonStates.Update(userID, func(state *learning.LessonState) {
+			state.Awaiting = true
+		}); err != nil {
+			return err
+		}
+		b.reply(message, fmt.Sprintf(b.text(chatID, "lesson_checkpoint"), step.Checkpoint.Question))
+		return nil
+	}
+	return b.advanceLesson(message, plan, step, "")
+}
+
+// advanceLesson отмечает шаг пройденным и показывает следующий шаг или сообщает об окончании плана
+func (b *Bot) advanceLesson(message *telegram.Message, plan learning.Plan, step learning.Step, feedback string) error {
+	chatID := message.Chat.ID
+	var finished bool
+	var next int
+	if _, err := b.LessonStates.Update(message.From.ID, func(state *learning.LessonState) {
+		finished = state.Advance(plan, time.Now())
+		next = state.Plans[plan.ID].Step
+	}); err != nil {
+		return err
+	}
+	b.recordEvent(message.From.ID, learning.Event{Type: learning.EventLesson, Topic: plan.Title, Detail: step.Title})
+
+	text := b.lessonStepText(chatID, plan, next)
+	if finished {
+		text = fmt.Sprintf(b.text(chatID, "lesson_finished"), plan.Title)
+	}
+	if feedback != "" {
+		text = feedback + "\n\n" + text
+	}
+	b.reply(message, text)
+	return nil
+}
+
+// handleCheckpointAnswer оценивает сообщение ученика, если он отвечает на контрольный вопрос урока.
+// Возвращает false, если сообщение нужно обработать как обычный вопрос
+func (b *Bot) handleCheckpointAnswer(message *telegram.Message, conversation helper.ConversationKey, answer string) bool {
+	userID := message.From.ID
+	if learner, ok := conversationLearner(conversation); !ok || learner != userID {
+		return false
+	}
+	state, err := b.LessonStates.Get(userID)
+	if err != nil {
+		log.Printf("Failed to load lesson state of user %d: %v", userID, err)
+		return false
+	}
+	progress := state.Current()
+	plan, ok := b.Lessons.Lookup(state.Active)
+	if !state.Awaiting || progress == nil || !ok {
+		return false
+	}
+	_, step, ok := plan.StepAt(progress.Step)
+	if !ok || step.Checkpoint == nil {
+		return false
+	}
+
+	chatID := message.Chat.ID
+	err = utils.WrapWithIndicator(b.API, chatID, telegram.ChatTyping, func() error {
+		result, tokensUsed, err := b.OpenAI.EvaluateCheckpoint(conversation, *step.Checkpoint, answer)
+		if tokensUsed > 0 {
+			model := b.OpenAI.ChatConfig(conversation).Model
+			b.sendBudgetAlerts(utils.AddChatRequestToUsageTracker(b.Usage, b.Config, userID, message.Chat, model, tokensUsed))
+		}
+		if err != nil {
+			return err
+		}
+
+		if result.Passed {
+			return b.advanceLesson(message, plan, step, "✅ "+result.Feedback)
+		}
+		if _, err := b.LessonStates.Update(userID, func(state *learning.LessonState) {
+			if current := state.Current(); current != nil {
+				current.Attempts++
+			}
+		}); err != nil {
+			return err
+		}
+		b.reply(message, "❌ "+result.Feedback+"\n\n"+b.text(chatID, "lesson_checkpoint_retry"))
+		return nil
+	})
+	if err != nil {
+		utils.ErrorHandler(err)
+		b.reply(message, b.text(chatID, "chat_fail")+": "+err.Error())
+	}
+	return true
+}
+
+// lessonContext возвращает инструкции текущего шага урока для диалога ученика
+func (b *Bot) lessonContext(conversation helper.ConversationKey) string {
+	userID, ok := conversationLearner(conversation)
+	if !ok {
+		return ""
+	}
+	state, err := b.LessonStates.Get(userID)
+	if err != nil {
+		log.Printf("Failed to load lesson state of user %d: %v", userID, err)
+		return ""
+	}
+	progress := state.Current()
+	plan, ok := b.Lessons.Lookup(state.Active)
+	if progress == nil || !ok {
+		return ""
+	}
+	unit, step, ok := plan.StepAt(progress.Step)
+	if !ok {
+		return ""
+	}
+
+	instructions := fmt.Sprintf("The student is following the lesson plan %q, unit %q, step %d of %d: %q.\n",
+		plan.Title, unit.Title, progress.Step+1, plan.StepCount(), step.Title)
+	if step.Objective != "" {
+		instructions += "Objective of the step: " + step.Objective + "\n"
+	}
+	instructions += "Instructions for this step: " + step.Instructions
+	if step.Checkpoint != nil {
+		instructions += "\nThe step ends with a checkpoint question the student must answer on their own, don't give its answer away."
+	}
+	return instructions
+}
+
+// lessonStepText описывает шаг урока для ученика
+func (b *Bot) lessonStepText(chatID int64, plan learning.Plan, index int) string {
+	unit, step, ok := plan.StepAt(index)
+	if !ok {
+		return fmt.Sprintf(b.text(chatID, "lesson_finished"), plan.Title)
+	}
+	text := fmt.Sprintf("**%s** - %s (%d/%d)\n**%s**", plan.Title, unit.Title, index+1, plan.StepCount(), step.Title)
+	if step.Objective != "" {
+		text += "\n🎯 " + step.Objective
+	}
+	return text + "\n\n" + b.text(chatID, "lesson_step_hint")
+}
+
+// conversationLearner возвращает ученика, которому принадлежит диалог: владельца личного чата или участника группы
+// со своим контекстом. У общего диалога группы ученика нет, поэтому уроков и экзаменов в нем не бывает
+func conversationLearner(conversation helper.ConversationKey) (int, bool) {
+	if conversation.UserID != 0 {
+		return conversation.UserID, true
+	}
+	if conversation.ChatID > 0 {
+		return int(conversation.ChatID), true
+	}
+	return 0, false
+}
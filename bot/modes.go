@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	conf "tutor/config"
+	"tutor/utils"
+)
+
+// mode переключает чат на пресет промпта: /mode <пресет> [переменная=значение ...].
+// Без аргументов выводит список пресетов
+func (b *Bot) mode(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		b.reply(message, b.presetList(chatID))
+		return nil
+	}
+
+	if !b.canChangeSettings(message.From.ID, message.Chat) {
+		b.reply(message, b.text(chatID, "not_permitted"))
+		return nil
+	}
+
+	name := args[0]
+	if !slices.Contains(b.Config.PresetNames(), name) {
+		b.reply(message, b.text(chatID, "invalid_arguments")+"\n\n"+b.presetList(chatID))
+		return nil
+	}
+	vars, ok := parsePresetVars(args[1:])
+	if !ok {
+		b.reply(message, b.text(chatID, "invalid_arguments")+"\n"+b.text(chatID, "mode_description"))
+		return nil
+	}
+	// в личном чате ученик - собеседник бота
+	if _, ok := vars["name"]; !ok && !utils.IsGroupChat(message.Chat) && message.From.FirstName != "" {
+		vars["name"] = message.From.FirstName
+	}
+
+	err := b.updateSettings(chatID, func(s *conf.ChatSettings) {
+		s.Preset = name
+		s.PresetVars = vars
+		if name == conf.DefaultPreset {
+			s.Preset, s.PresetVars = "", nil
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Chat %d switched to preset %s by user %s (id: %d)", chatID, name, message.From.UserName, message.From.ID)
+	b.OpenAI.ResetChat(chatID)
+	b.reply(message, fmt.Sprintf(b.text(chatID, "mode_done"), name))
+	return nil
+}
+
+// addMode добавляет или заменяет пресет промпта: /addmode <пресет> <промпт с {переменными}>
+func (b *Bot) addMode(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	args := strings.Fields(message.CommandArguments())
+	if len(args) < 2 {
+		b.reply(message, b.text(chatID, "invalid_arguments")+"\n"+b.text(chatID, "addmode_description"))
+		return nil
+	}
+
+	name := args[0]
+	prompt := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(message.CommandArguments()), name))
+	preset := conf.Preset{Name: name, Prompt: prompt}
+	if existing, ok := b.Config.PromptLibrary().Lookup(name); ok {
+		preset.Description = existing.Description
+		preset.Variables = existing.Variables
+	}
+
+	if err := b.Config.PromptLibrary().Put(preset); err != nil {
+		b.reply(message, b.text(chatID, "invalid_arguments")+": "+err.Error())
+		return nil
+	}
+	b.audit(message, "addmode", 0, name)
+	b.reply(message, fmt.Sprintf(b.text(chatID, "addmode_done"), name))
+	return nil
+}
+
+// presetList возвращает список пресетов с описаниями и переменными
+func (b *Bot) presetList(chatID int64) string {
+	current := b.Config.ChatSettingsStore().Get(chatID).Preset
+	if current == "" {
+		current = conf.DefaultPreset
+	}
+
+	mark := func(name string) string {
+		if name == current {
+			return "✅ "
+		}
+		return ""
+	}
+
+	lines := []string{"**" + b.text(chatID, "mode_title") + "**",
+		fmt.Sprintf("%s`%s` - %s", mark(conf.DefaultPreset), conf.DefaultPreset, b.text(chatID, "mode_default"))}
+	for _, preset := range b.Config.PromptLibrary().List() {
+		line := fmt.Sprintf("%s`%s`", mark(preset.Name), preset.Name)
+		if preset.Description != "" {
+			line += " - " + preset.Description
+		}
+		if len(preset.Variables) > 0 {
+			var names []string
+			for name := range preset.Variables {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			line += fmt.Sprintf(" (%s: %s)", b.text(chatID, "mode_variables"), strings.Join(names, ", "))
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "", b.text(chatID, "mode_description"))
+	return strings.Join(lines, "\n")
+}
+
+// parsePresetVars разбирает аргументы вида level=B2 name=Анна Мария. Значение продолжается до следующего "ключ="
+func parsePresetVars(args []string) (map[string]string, bool) {
+	vars := make(map[string]string)
+	key := ""
+	for _, arg := range args {
+		if k, v, found := strings.Cut(arg, "="); found && k != "" {
+			key = k
+			vars[key] = v
+			continue
+		}
+		if key == "" {
+			return nil, false
+		}
+		vars[key] += " " + arg
+	}
+	return vars, true
+}
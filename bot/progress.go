@@ -0,0 +1,235 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	conf "tutor/config"
+	"tutor/helper"
+	"tutor/learning"
+	"tutor/utils"
+)
+
+const (
+	defaultProgressDays = 7
+	maxProgressDays     = 90
+	// sessionGap - после какой паузы следующий вопрос начинает новую учебную сессию
+	sessionGap = 30 * time.Minute
+	// maxReportEvents - сколько последних событий попадает в запрос к модели
+	maxReportEvents = 300
+	// eventDetailLength - сколько символов вопроса сохраняется в событии
+	eventDetailLength = 100
+)
+
+// recordEvent записывает учебное событие ученика и закрывает его предыдущую сессию, если она закончилась.
+// События учителей, администраторов и гостей не записываются: отчеты о прогрессе строятся только по ученикам
+func (b *Bot) recordEvent(userID int, event learning.Event) {
+	if utils.GetUserRole(b.Config, userID) != conf.RoleStudent {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if session, ended := b.sessions.Touch(userID, event.Time); ended {
+		b.saveEvent(userID, session)
+	}
+	if runes := []rune(event.Detail); len(runes) > eventDetailLength {
+		event.Detail = string(runes[:eventDetailLength-1]) + "…"
+	}
+	b.saveEvent(userID, event)
+}
+
+func (b *Bot) saveEvent(userID int, event learning.Event) {
+	if err := b.Progress.Record(userID, event); err != nil {
+		log.Printf("Failed to record learning event for user %d: %v", userID, err)
+	}
+}
+
+// recordChat записывает вопрос тьютору. Темой считается пресет чата, если он выбран
+func (b *Bot) recordChat(userID int, chatID int64, prompt string) {
+	topic := b.Config.ChatSettingsStore().Get(chatID).Preset
+	if topic == conf.DefaultPreset {
+		topic = ""
+	}
+	b.recordEvent(userID, learning.Event{Type: learning.EventChat, Topic: topic, Detail: prompt})
+}
+
+// recordHint записывает подсказку к задаче в режиме подсказок, чтобы учитель видел, сколько помощи понадобилось
+func (b *Bot) recordHint(conversation helper.ConversationKey, state helper.HintState) {
+	userID, ok := conversationLearner(conversation)
+	if !ok {
+		return
+	}
+	event := learning.Event{Type: learning.EventHint, Topic: state.Problem, Value: float64(state.Level)}
+	if state.Solved {
+		event.Detail = "solution"
+	}
+	b.recordEvent(userID, event)
+}
+
+// tick выполняет периодические задачи между пачками обновлений: закрывает сессии и экзамены и рассылает отчеты учителям
+func (b *Bot) tick() {
+	now := time.Now()
+	for userID, session := range b.sessions.Expire(now) {
+		b.saveEvent(userID, session)
+	}
+	b.expireExams(now)
+	b.sendDueDigests(now)
+}
+
+// progress показывает учителю отчет о занятиях ученика: /progress <id> [дни]. Отчет оплачивается из общего бюджета
+// отчетов, поэтому команда доступна только тем, кто управляет учениками
+func (b *Bot) progress(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 || len(args) > 2 {
+		b.reply(message, b.text(chatID, "invalid_arguments")+"\n"+b.text(chatID, "progress_description"))
+		return nil
+	}
+
+	userID, ok := b.parseManagedUser(message, args[0])
+	if !ok {
+		return nil
+	}
+	user, _ := b.Config.UserRegistry().Lookup(userID)
+	name := studentName(user)
+
+	days := defaultProgressDays
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 || n > maxProgressDays {
+			b.reply(message, b.text(chatID, "invalid_arguments")+"\n"+b.text(chatID, "progress_description"))
+			return nil
+		}
+		days = n
+	}
+
+	if !utils.IsWithinReportBudget(b.Config, b.Usage) {
+		b.reply(message, b.text(chatID, "report_budget_limit"))
+		return nil
+	}
+
+	var report string
+	var tokensUsed int
+	err := utils.WrapWithIndicator(b.API, chatID, telegram.ChatTyping, func() error {
+		var err error
+		report, tokensUsed, err = b.progressReport(chatID, userID, name, days)
+		return err
+	})
+	if tokensUsed > 0 {
+		utils.AddReportRequestToUsageTracker(b.Usage, b.Config, b.OpenAI.ChatConfig(helper.ChatConversation(chatID)).Model, tokensUsed)
+	}
+	if err != nil {
+		return err
+	}
+	if report == "" {
+		report = fmt.Sprintf(b.text(chatID, "progress_no_events"), name, days)
+	}
+	b.reply(message, report)
+	return nil
+}
+
+// progressReport составляет отчет о занятиях ученика за days дней на языке чата chatID и возвращает токены,
+// которые вызывающий списывает с бюджета отчетов. Если событий нет, возвращает пустую строку.
+// Не обращается к состоянию бота под b.mu, поэтому может вызываться из горутины
+func (b *Bot) progressReport(chatID int64, userID int, name string, days int) (string, int, error) {
+	events, err := b.Progress.Events(userID, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		return "", 0, err
+	}
+	if len(events) == 0 {
+		return "", 0, nil
+	}
+
+	stats := learning.Summarize(events)
+	header := fmt.Sprintf(b.text(chatID, "progress_title"), name, days) + "\n" +
+		fmt.Sprintf(b.text(chatID, "progress_stats"), stats.Questions, stats.Quizzes, stats.QuizScore*100, stats.CardsReviewed, stats.SessionMinutes)
+	if stats.Problems > 0 {
+		header += "\n" + fmt.Sprintf(b.text(chatID, "progress_hints"), stats.Problems, stats.HintLevel, stats.Solutions)
+	}
+
+	if len(events) > maxReportEvents {
+		events = events[len(events)-maxReportEvents:]
+	}
+	conversation := helper.ChatConversation(chatID)
+	summary, tokensUsed, err := b.OpenAI.SummariseProgress(conversation, name, days, learning.FormatEvents(events))
+	if err != nil {
+		return "", tokensUsed, err
+	}
+	return header + "\n\n" + summary, tokensUsed, nil
+}
+
+// sendDueDigests отправляет учителям еженедельный отчет об их студентах в день и час из DIGEST_WEEKDAY и DIGEST_HOUR.
+// Отчеты составляются в горутине, чтобы запросы к модели не останавливали цикл обновлений
+func (b *Bot) sendDueDigests(now time.Time) {
+	users := b.Config.UserRegistry().List()
+	var teachers []conf.User
+	for _, teacher := range users {
+		if teacher.Role != conf.RoleTeacher || !utils.IsDigestDue(b.Config, b.Digests.LastSent(teacher.ID), now) {
+			continue
+		}
+		// отчет отмечается отправленным и при ошибках, чтобы не повторять запросы к модели на каждой пачке обновлений
+		if err := b.Digests.MarkSent(teacher.ID, now); err != nil {
+			log.Printf("Failed to save digest state: %v", err)
+		}
+		teachers = append(teachers, teacher)
+	}
+	if len(teachers) > 0 {
+		go b.sendDigests(teachers, users)
+	}
+}
+
+// sendDigests составляет и отправляет еженедельные отчеты учителям teachers. b.mu берется только для проверки
+// бюджета, списания токенов и отправки
+func (b *Bot) sendDigests(teachers, users []conf.User) {
+	for _, teacher := range teachers {
+		b.mu.Lock()
+		withinBudget := utils.IsWithinReportBudget(b.Config, b.Usage)
+		b.mu.Unlock()
+		if !withinBudget {
+			log.Printf("Report budget reached, skipping the weekly digest for teacher %d", teacher.ID)
+			continue
+		}
+
+		chatID := int64(teacher.ID)
+		model := b.OpenAI.ChatConfig(helper.ChatConversation(chatID)).Model
+		var reports []string
+		for _, student := range users {
+			if student.Role != conf.RoleStudent || !utils.CanManageUser(b.Config, teacher.ID, student.ID) {
+				continue
+			}
+			report, tokensUsed, err := b.progressReport(chatID, student.ID, studentName(student), 7)
+			if tokensUsed > 0 {
+				b.mu.Lock()
+				utils.AddReportRequestToUsageTracker(b.Usage, b.Config, model, tokensUsed)
+				b.mu.Unlock()
+			}
+			if err != nil {
+				log.Printf("Failed to make the weekly report on user %d: %v", student.ID, err)
+				continue
+			}
+			if report != "" {
+				reports = append(reports, report)
+			}
+		}
+		if len(reports) == 0 {
+			continue
+		}
+		log.Printf("Sending the weekly digest on %d students to teacher %d", len(reports), teacher.ID)
+		b.mu.Lock()
+		b.sendMarkdown(chatID, 0, "**"+b.text(chatID, "progress_digest_title")+"**\n\n"+strings.Join(reports, "\n\n"))
+		b.mu.Unlock()
+	}
+}
+
+func studentName(user conf.User) string {
+	if user.Name != "" {
+		return user.Name
+	}
+	return fmt.Sprintf("%d", user.ID)
+}
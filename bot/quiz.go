@@ -0,0 +1,187 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	"tutor/helper"
+	"tutor/learning"
+	"tutor/utils"
+)
+
+const (
+	defaultQuizQuestions = 5
+	maxQuizQuestions     = 10
+	// quizLifetime - сколько тест принимает ответы. Тесты хранятся в памяти и теряются при перезапуске
+	quizLifetime = 24 * time.Hour
+)
+
+// quiz составляет тест и отправляет его вопросы с кнопками ответов: /quiz [число вопросов] [тема].
+// Без темы тест составляется по последним сообщениям диалога
+func (b *Bot) quiz(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	if !b.checkAllowedAndWithinBudget(&telegram.Update{Message: message}, false) {
+		return nil
+	}
+
+	count := defaultQuizQuestions
+	args := strings.Fields(message.CommandArguments())
+	if len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			if n < 1 || n > maxQuizQuestions {
+				b.reply(message, b.text(chatID, "invalid_arguments")+"\n"+b.text(chatID, "quiz_description"))
+				return nil
+			}
+			count, args = n, args[1:]
+		}
+	}
+	topic := strings.Join(args, " ")
+
+	conversation := utils.GetConversationKey(b.Config, message)
+	var questions []learning.Question
+	err := utils.WrapWithIndicator(b.API, chatID, telegram.ChatTyping, func() error {
+		var tokensUsed int
+		var err error
+		questions, tokensUsed, err = b.OpenAI.GenerateQuiz(conversation, topic, count)
+		if tokensUsed > 0 {
+			model := b.OpenAI.ChatConfig(conversation).Model
+			b.sendBudgetAlerts(utils.AddChatRequestToUsageTracker(b.Usage, b.Config, message.From.ID, message.Chat, model, tokensUsed))
+		}
+		return err
+	})
+	if errors.Is(err, helper.ErrEmptyConversation) {
+		b.reply(message, b.text(chatID, "quiz_no_topic"))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if topic == "" {
+		topic = b.text(chatID, "quiz_conversation_topic")
+	}
+	quiz := learning.NewQuiz(chatID, topic, questions)
+	quiz.ThreadID = utils.GetThreadID(message)
+	b.expireQuizzes()
+	b.quizzes[quiz.ID] = quiz
+
+	log.Printf("Quiz %s with %d questions on %q created for chat %d by user %s (id: %d)",
+		quiz.ID, len(questions), topic, chatID, message.From.UserName, message.From.ID)
+	b.reply(message, fmt.Sprintf(b.text(chatID, "quiz_intro"), topic, len(questions)))
+	for i := range questions {
+		if err := b.sendQuizQuestion(message, quiz, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Bot) sendQuizQuestion(message *telegram.Message, quiz *learning.Quiz, index int) error {
+	msg := telegram.NewMessage(quiz.ChatID, utils.ToTelegramHTML(b.quizQuestionText(quiz, index)))
+	msg.ParseMode = telegram.ModeHTML
+	msg.ReplyToMessageID = utils.GetReplyToMessageID(b.Config, message)
+
+	var buttons []telegram.InlineKeyboardButton
+	for option := range quiz.Questions[index].Options {
+		data := fmt.Sprintf("quiz:%s:%d:%d", quiz.ID, index, option)
+		buttons = append(buttons, telegram.NewInlineKeyboardButtonData(learning.OptionLabel(option), data))
+	}
+	msg.ReplyMarkup = telegram.NewInlineKeyboardMarkup(telegram.NewInlineKeyboardRow(buttons...))
+
+	_, err := utils.SendMessage(b.API, msg, quiz.ThreadID)
+	return err
+}
+
+func (b *Bot) quizQuestionText(quiz *learning.Quiz, index int) string {
+	question := quiz.Questions[index]
+	lines := []string{fmt.Sprintf("**%s %d/%d**", b.text(quiz.ChatID, "quiz_question"), index+1, len(quiz.Questions)),
+		question.Question, ""}
+	for option, text := range question.Options {
+		lines = append(lines, fmt.Sprintf("%s) %s", learning.OptionLabel(option), text))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// quizCallback засчитывает ответ на вопрос теста: "<тест>:<вопрос>:<вариант>".
+// В личном чате вопрос заменяется разбором ответа, в группе ответ виден только ответившему
+func (b *Bot) quizCallback(query *telegram.CallbackQuery, args string) (string, error) {
+	chatID := query.Message.Chat.ID
+	parts := strings.Split(args, ":")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("invalid quiz callback data %q", args)
+	}
+	quiz, ok := b.quizzes[parts[0]]
+	if !ok {
+		return b.text(chatID, "quiz_expired"), nil
+	}
+	index, err1 := strconv.Atoi(parts[1])
+	option, err2 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil || index < 0 || index >= len(quiz.Questions) {
+		return "", fmt.Errorf("invalid quiz callback data %q", args)
+	}
+	if !utils.HasPermission(b.Config, query.From.ID, utils.PermChat) {
+		return b.text(chatID, "disallowed"), nil
+	}
+
+	correct, first, done := quiz.Answer(query.From.ID, index, option)
+	if !first {
+		return b.text(chatID, "quiz_already_answered"), nil
+	}
+	if err := b.Scores.RecordAnswer(query.From.ID, userDisplayName(query.From), quiz.Topic, correct, done); err != nil {
+		log.Printf("Failed to save quiz scores: %v", err)
+	}
+
+	question := quiz.Questions[index]
+	answer := fmt.Sprintf("%s) %s", learning.OptionLabel(question.Answer), question.Options[question.Answer])
+	notice := "✅ " + b.text(chatID, "quiz_correct")
+	if !correct {
+		notice = "❌ " + b.text(chatID, "quiz_wrong") + ": " + answer
+	}
+
+	if !utils.IsGroupChat(query.Message.Chat) {
+		text := b.quizQuestionText(quiz, index) + "\n\n" + notice
+		if question.Explanation != "" {
+			text += "\n" + question.Explanation
+		}
+		edit := telegram.NewEditMessageText(chatID, query.Message.MessageID, utils.ToTelegramHTML(text))
+		edit.ParseMode = telegram.ModeHTML
+		if _, err := b.API.Send(edit); err != nil {
+			log.Printf("Failed to edit quiz question: %v", err)
+		}
+	}
+
+	if done {
+		score, total := quiz.Score(query.From.ID)
+		b.recordEvent(query.From.ID, learning.Event{Type: learning.EventQuiz, Topic: quiz.Topic,
+			Detail: fmt.Sprintf("%d/%d", score, total), Value: float64(score) / float64(total)})
+		b.send(chatID, quiz.ThreadID, fmt.Sprintf(b.text(chatID, "quiz_result"), userDisplayName(query.From), score, total, quiz.Topic))
+	}
+
+	// текст уведомления ограничен 200 символами
+	if runes := []rune(notice); len(runes) > 200 {
+		notice = string(runes[:199]) + "…"
+	}
+	return notice, nil
+}
+
+// expireQuizzes удаляет тесты старше quizLifetime
+func (b *Bot) expireQuizzes() {
+	for id, quiz := range b.quizzes {
+		if time.Since(quiz.Created) > quizLifetime {
+			delete(b.quizzes, id)
+		}
+	}
+}
+
+func userDisplayName(user *telegram.User) string {
+	if user.FirstName != "" {
+		return strings.TrimSpace(user.FirstName + " " + user.LastName)
+	}
+	return user.UserName
+}
@@ -0,0 +1,294 @@
+package bot
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	conf "tutor/config"
+	"tutor/helper"
+	"tutor/utils"
+)
+
+// temperatureOptions - значения температуры, предлагаемые в /settings
+var temperatureOptions = []float32{0, 0.3, 0.7, 1, 1.3}
+
+// settings показывает настройки чата с клавиатурой для их изменения.
+// /settings <ID пользователя> открывает настройки личного чата ученика его учителю или администратору
+func (b *Bot) settings(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	target := chatID
+	if args := strings.Fields(message.CommandArguments()); len(args) > 0 {
+		userID, ok := b.parseManagedUser(message, args[0])
+		if !ok {
+			return nil
+		}
+		target = int64(userID)
+	}
+
+	msg := telegram.NewMessage(chatID, utils.ToTelegramHTML(b.settingsText(chatID, target)))
+	msg.ParseMode = telegram.ModeHTML
+	msg.ReplyToMessageID = utils.GetReplyToMessageID(b.Config, message)
+	msg.ReplyMarkup = b.settingsKeyboard(chatID, target, "")
+	_, err := b.API.Send(msg)
+	return err
+}
+
+// settingsCallback обрабатывает кнопки /settings: "<поле>" открывает выбор значения,
+// "<поле>:<значение>" сохраняет его, "menu" возвращает к списку настроек.
+// Кнопки настроек личного чата ученика начинаются с "@<ID ученика>:"
+func (b *Bot) settingsCallback(query *telegram.CallbackQuery, args string) (string, error) {
+	chatID := query.Message.Chat.ID
+	target, args, err := settingsTarget(chatID, args)
+	if err != nil {
+		return "", err
+	}
+	allowed := b.canChangeSettings(query.From.ID, query.Message.Chat)
+	if target != chatID {
+		allowed = utils.CanManageUser(b.Config, query.From.ID, int(target)) ||
+			target == int64(query.From.ID) && utils.HasPermission(b.Config, query.From.ID, utils.PermChat)
+	}
+	if !allowed {
+		return b.text(chatID, "not_permitted"), nil
+	}
+
+	field, value, hasValue := strings.Cut(args, ":")
+	notice := ""
+	switch {
+	case field == "stream":
+		enabled := !b.Config.ForChat(target).Stream
+		if err := b.updateSettings(target, func(s *conf.ChatSettings) { s.Stream = &enabled }); err != nil {
+			return "", err
+		}
+		field, notice = "", b.text(chatID, "settings_saved")
+	case field == "hints":
+		// иначе ученик мог бы сам отключить подсказки вместо решений
+		if !utils.HasPermission(b.Config, query.From.ID, utils.PermManageStudents) {
+			return b.text(chatID, "not_permitted"), nil
+		}
+		enabled := !b.Config.ForChat(target).HintMode
+		if err := b.updateSettings(target, func(s *conf.ChatSettings) { s.HintMode = &enabled }); err != nil {
+			return "", err
+		}
+		field, notice = "", b.text(chatID, "settings_saved")
+	case field == "vocab":
+		enabled := !b.Config.ForChat(target).VocabBuilder
+		if err := b.updateSettings(target, func(s *conf.ChatSettings) { s.Vocabulary = &enabled }); err != nil {
+			return "", err
+		}
+		field, notice = "", b.text(chatID, "settings_saved")
+	case field == "corrections":
+		enabled := !b.Config.ForChat(target).CorrectionMode
+		if err := b.updateSettings(target, func(s *conf.ChatSettings) { s.Corrections = &enabled }); err != nil {
+			return "", err
+		}
+		field, notice = "", b.text(chatID, "settings_saved")
+	case field == "code":
+		// код выполняется на сервере бота, поэтому запуск разрешают только администраторы
+		if !utils.HasPermission(b.Config, query.From.ID, utils.PermManageUsers) {
+			return b.text(chatID, "not_permitted"), nil
+		}
+		enabled := !b.Config.ForChat(target).CodeExecution
+		if err := b.updateSettings(target, func(s *conf.ChatSettings) { s.CodeExecution = &enabled }); err != nil {
+			return "", err
+		}
+		field, notice = "", b.text(chatID, "settings_saved")
+	case field == "reset":
+		// режим подсказок и запуск кода сбрасывает только тот, кто может их менять
+		canHints := utils.HasPermission(b.Config, query.From.ID, utils.PermManageStudents)
+		canCode := utils.HasPermission(b.Config, query.From.ID, utils.PermManageUsers)
+		if err := b.updateSettings(target, func(s *conf.ChatSettings) {
+			kept := conf.ChatSettings{}
+			if !canHints {
+				kept.HintMode = s.HintMode
+			}
+			if !canCode {
+				kept.CodeExecution = s.CodeExecution
+			}
+			*s = kept
+		}); err != nil {
+			return "", err
+		}
+		b.OpenAI.ResetChat(target)
+		field, notice = "", b.text(chatID, "settings_saved")
+	case hasValue:
+		saved, err := b.setSetting(target, field, value)
+		if err != nil || !saved {
+			return b.text(chatID, "invalid_arguments"), err
+		}
+		field, notice = "", b.text(chatID, "settings_saved")
+	case field == "menu":
+		field = ""
+	}
+
+	edit := telegram.NewEditMessageText(chatID, query.Message.MessageID, utils.ToTelegramHTML(b.settingsText(chatID, target)))
+	edit.ParseMode = telegram.ModeHTML
+	keyboard := b.settingsKeyboard(chatID, target, field)
+	edit.ReplyMarkup = &keyboard
+	if _, err := b.API.Send(edit); err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		return "", err
+	}
+	return notice, nil
+}
+
+// settingsTarget возвращает чат, настройки которого меняет кнопка, и данные кнопки без него
+func settingsTarget(chatID int64, args string) (int64, string, error) {
+	if !strings.HasPrefix(args, "@") {
+		return chatID, args, nil
+	}
+	id, rest, _ := strings.Cut(args[1:], ":")
+	target, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid settings callback data %q", args)
+	}
+	return target, rest, nil
+}
+
+// setSetting проверяет и сохраняет значение настройки. Смена пресета начинает диалоги чата заново
+func (b *Bot) setSetting(chatID int64, field, value string) (bool, error) {
+	var update func(s *conf.ChatSettings)
+	switch field {
+	case "model":
+		if !slices.Contains(b.Config.AllowedModelList(), value) {
+			return false, nil
+		}
+		update = func(s *conf.ChatSettings) { s.Model = value }
+	case "preset":
+		if !slices.Contains(b.Config.PresetNames(), value) {
+			return false, nil
+		}
+		// переменные предыдущего пресета к новому не относятся
+		update = func(s *conf.ChatSettings) { s.Preset, s.PresetVars = value, nil }
+	case "temperature":
+		parsed, err := strconv.ParseFloat(value, 32)
+		if err != nil || parsed < 0 || parsed > 2 {
+			return false, nil
+		}
+		temperature := float32(parsed)
+		update = func(s *conf.ChatSettings) { s.Temperature = &temperature }
+	case "language":
+		if !slices.Contains(helper.Languages(), value) {
+			return false, nil
+		}
+		update = func(s *conf.ChatSettings) { s.Language = value }
+	default:
+		return false, nil
+	}
+
+	if err := b.updateSettings(chatID, update); err != nil {
+		return false, err
+	}
+	if field == "preset" {
+		b.OpenAI.ResetChat(chatID)
+	}
+	return true, nil
+}
+
+func (b *Bot) updateSettings(chatID int64, update func(s *conf.ChatSettings)) error {
+	return b.Config.ChatSettingsStore().Update(chatID, update)
+}
+
+// canChangeSettings проверяет, может ли пользователь менять настройки чата.
+// В личном чате это может любой пользователь, в группе - учителя и администраторы
+func (b *Bot) canChangeSettings(userID int, chat *telegram.Chat) bool {
+	if !utils.IsGroupChat(chat) {
+		return utils.HasPermission(b.Config, userID, utils.PermChat)
+	}
+	return utils.HasPermission(b.Config, userID, utils.PermManageStudents)
+}
+
+// settingsText описывает настройки чата target на языке чата chatID, в котором они показаны
+func (b *Bot) settingsText(chatID, target int64) string {
+	cfg := b.Config.ForChat(target)
+	preset := b.Config.ChatSettingsStore().Get(target).Preset
+	if preset == "" {
+		preset = conf.DefaultPreset
+	}
+
+	title := b.text(chatID, "settings_title")
+	if target != chatID {
+		title = fmt.Sprintf(b.text(chatID, "settings_user_title"), target)
+	}
+	lines := []string{
+		"**" + title + "**",
+		fmt.Sprintf("%s: `%s`", b.text(chatID, "settings_model"), cfg.Model),
+		fmt.Sprintf("%s: %s", b.text(chatID, "settings_preset"), preset),
+		fmt.Sprintf("%s: %.1f", b.text(chatID, "settings_temperature"), cfg.Temperature),
+		fmt.Sprintf("%s: %s", b.text(chatID, "settings_language"), cfg.BotLanguage),
+		fmt.Sprintf("%s: %s", b.text(chatID, "settings_stream"), b.onOff(chatID, cfg.Stream)),
+		fmt.Sprintf("%s: %s", b.text(chatID, "settings_hints"), b.onOff(chatID, cfg.HintMode)),
+		fmt.Sprintf("%s: %s", b.text(chatID, "settings_vocab"), b.onOff(chatID, cfg.VocabBuilder)),
+		fmt.Sprintf("%s: %s", b.text(chatID, "settings_corrections"), b.onOff(chatID, cfg.CorrectionMode)),
+		fmt.Sprintf("%s: %s", b.text(chatID, "settings_code"), b.onOff(chatID, cfg.CodeExecution)),
+	}
+	return strings.Join(lines, "\n")
+}
+
+// settingsKeyboard возвращает клавиатуру списка настроек чата target или, если задано field, выбора ее значения
+func (b *Bot) settingsKeyboard(chatID, target int64, field string) telegram.InlineKeyboardMarkup {
+	cfg := b.Config.ForChat(target)
+	prefix := "settings:"
+	if target != chatID {
+		prefix += fmt.Sprintf("@%d:", target)
+	}
+	button := func(text, data string) []telegram.InlineKeyboardButton {
+		return telegram.NewInlineKeyboardRow(telegram.NewInlineKeyboardButtonData(text, prefix+data))
+	}
+	option := func(value, current string) []telegram.InlineKeyboardButton {
+		text := value
+		if value == current {
+			text = "✅ " + value
+		}
+		return button(text, field+":"+value)
+	}
+
+	var rows [][]telegram.InlineKeyboardButton
+	switch field {
+	case "model":
+		for _, model := range b.Config.AllowedModelList() {
+			rows = append(rows, option(model, cfg.Model))
+		}
+	case "preset":
+		current := b.Config.ChatSettingsStore().Get(target).Preset
+		if current == "" {
+			current = conf.DefaultPreset
+		}
+		for _, preset := range b.Config.PresetNames() {
+			rows = append(rows, option(preset, current))
+		}
+	case "temperature":
+		for _, temperature := range temperatureOptions {
+			rows = append(rows, option(strconv.FormatFloat(float64(temperature), 'f', 1, 32),
+				strconv.FormatFloat(float64(cfg.Temperature), 'f', 1, 32)))
+		}
+	case "language":
+		for _, language := range helper.Languages() {
+			rows = append(rows, option(language, cfg.BotLanguage))
+		}
+	default:
+		return telegram.NewInlineKeyboardMarkup(
+			button("🧠 "+b.text(chatID, "settings_model"), "model"),
+			button("🎭 "+b.text(chatID, "settings_preset"), "preset"),
+			button("🌡 "+b.text(chatID, "settings_temperature"), "temperature"),
+			button("🌐 "+b.text(chatID, "settings_language"), "language"),
+			button("⚡ "+b.text(chatID, "settings_stream")+": "+b.onOff(chatID, cfg.Stream), "stream"),
+			button("💡 "+b.text(chatID, "settings_hints")+": "+b.onOff(chatID, cfg.HintMode), "hints"),
+			button("📚 "+b.text(chatID, "settings_vocab")+": "+b.onOff(chatID, cfg.VocabBuilder), "vocab"),
+			button("✏️ "+b.text(chatID, "settings_corrections")+": "+b.onOff(chatID, cfg.CorrectionMode), "corrections"),
+			button("▶️ "+b.text(chatID, "settings_code")+": "+b.onOff(chatID, cfg.CodeExecution), "code"),
+			button("↩️ "+b.text(chatID, "settings_reset"), "reset"),
+		)
+	}
+	rows = append(rows, button("⬅️ "+b.text(chatID, "settings_back"), "menu"))
+	return telegram.NewInlineKeyboardMarkup(rows...)
+}
+
+func (b *Bot) onOff(chatID int64, enabled bool) string {
+	if enabled {
+		return b.text(chatID, "settings_on")
+	}
+	return b.text(chatID, "settings_off")
+}
@@ -0,0 +1,164 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	"tutor/usagetracker"
+	"tutor/utils"
+)
+
+// stats показывает использование и остаток бюджета: /stats - свои, /stats <id> - студента, /stats all - всех пользователей
+func (b *Bot) stats(message *telegram.Message) error {
+	userID, userName := message.From.ID, message.From.UserName
+	if args := strings.Fields(message.CommandArguments()); len(args) > 0 {
+		if args[0] == "all" {
+			if !utils.HasPermission(b.Config, message.From.ID, utils.PermManageUsers) {
+				b.reply(message, b.text(message.Chat.ID, "not_permitted"))
+				return nil
+			}
+			return b.globalStats(message)
+		}
+
+		targetID, ok := b.parseManagedUser(message, args[0])
+		if !ok {
+			return nil
+		}
+		user, _ := b.Config.UserRegistry().Lookup(targetID)
+		userID, userName = user.ID, user.Name
+	}
+
+	tracker := utils.GetUserUsageTracker(b.Config, b.Usage, userID, userName)
+	tokensToday, tokensMonth := tracker.GetCurrentTokenUsage()
+	imagesToday, imagesMonth := tracker.GetCurrentImageCount()
+	minutesToday, secondsToday, minutesMonth, secondsMonth := tracker.GetCurrentTranscriptionDuration()
+	tokensAllTime, imagesAllTime, transcriptionAllTime := tracker.GetAllTimeUsage()
+	cost := tracker.GetCurrentCost()
+
+	lines := []string{
+		fmt.Sprintf("**%s %s (%d)**", b.text(message.Chat.ID, "stats_user"), userName, userID),
+		"",
+		"**" + b.text(message.Chat.ID, "stats_today") + "**",
+		fmt.Sprintf("%d %s", tokensToday, b.text(message.Chat.ID, "stats_tokens")),
+		fmt.Sprintf("%d %s", imagesToday, b.text(message.Chat.ID, "stats_images")),
+		fmt.Sprintf("%d %s %.0f %s", minutesToday, b.text(message.Chat.ID, "stats_transcribe_minutes"), secondsToday, b.text(message.Chat.ID, "stats_transcribe_seconds")),
+		fmt.Sprintf("%s: $%.2f", b.text(message.Chat.ID, "stats_total"), cost["cost_today"]),
+		"",
+		"**" + b.text(message.Chat.ID, "stats_month") + "**",
+		fmt.Sprintf("%d %s", tokensMonth, b.text(message.Chat.ID, "stats_tokens")),
+		fmt.Sprintf("%d %s", imagesMonth, b.text(message.Chat.ID, "stats_images")),
+		fmt.Sprintf("%d %s %.0f %s", minutesMonth, b.text(message.Chat.ID, "stats_transcribe_minutes"), secondsMonth, b.text(message.Chat.ID, "stats_transcribe_seconds")),
+		fmt.Sprintf("%s: $%.2f", b.text(message.Chat.ID, "stats_total"), cost["cost_month"]),
+		"",
+		"**" + b.text(message.Chat.ID, "stats_all_time") + "**",
+		fmt.Sprintf("%d %s", tokensAllTime, b.text(message.Chat.ID, "stats_tokens")),
+		fmt.Sprintf("%d %s", imagesAllTime, b.text(message.Chat.ID, "stats_images")),
+		fmt.Sprintf("%d %s %d %s", transcriptionAllTime/60, b.text(message.Chat.ID, "stats_transcribe_minutes"), transcriptionAllTime%60, b.text(message.Chat.ID, "stats_transcribe_seconds")),
+		fmt.Sprintf("%s: $%.2f", b.text(message.Chat.ID, "stats_total"), cost["cost_all_time"]),
+		"",
+		fmt.Sprintf("%s %s: %s", b.text(message.Chat.ID, "stats_budget"), b.text(message.Chat.ID, "budget_period_"+utils.GetUserBudgetPeriod(b.Config, userID)),
+			formatBudget(utils.GetRemainingUserBudget(b.Config, b.Usage, userID, userName))),
+	}
+	if correctionToday, correctionMonth := tracker.GetCurrentCorrectionTokens(); correctionMonth > 0 {
+		lines = append(lines, b.correctionStats(message.Chat.ID, correctionToday, correctionMonth))
+	}
+	if embeddingToday, embeddingMonth := tracker.GetCurrentEmbeddingTokens(); embeddingMonth > 0 {
+		lines = append(lines, fmt.Sprintf("%s: %d/%d %s ($%.4f/$%.4f)", b.text(message.Chat.ID, "stats_embedding_tokens"),
+			embeddingToday, embeddingMonth, b.text(message.Chat.ID, "stats_tokens"),
+			float64(embeddingToday)*b.Config.EmbeddingPrice/1000, float64(embeddingMonth)*b.Config.EmbeddingPrice/1000))
+	}
+	if remaining, ok := utils.GetRemainingChatBudget(b.Config, b.Usage, message.Chat); ok {
+		lines = append(lines, fmt.Sprintf("%s %s: %s", b.text(message.Chat.ID, "stats_chat_budget"),
+			b.text(message.Chat.ID, "budget_period_"+b.Config.BudgetPeriod), formatBudget(remaining)))
+	}
+
+	b.reply(message, strings.Join(lines, "\n"))
+	return nil
+}
+
+// globalStats суммирует все трекеры из LogsDir: итоги, самые активные пользователи и расходы за 30 дней.
+// Отчеты о прогрессе входят в итоги, но не в число пользователей
+func (b *Bot) globalStats(message *telegram.Message) error {
+	trackers, err := usagetracker.LoadUsageTrackers(b.Config.LogsDir)
+	if err != nil {
+		return err
+	}
+
+	var costToday, costMonth, costAllTime float64
+	var correctionToday, correctionMonth int
+	users := 0
+	for _, tracker := range trackers {
+		if !tracker.IsCountedInTotals() {
+			continue
+		}
+		cost := tracker.GetCurrentCost()
+		costToday += cost["cost_today"]
+		costMonth += cost["cost_month"]
+		costAllTime += cost["cost_all_time"]
+		if !tracker.IsUserTracker() {
+			continue
+		}
+		today, month := tracker.GetCurrentCorrectionTokens()
+		correctionToday += today
+		correctionMonth += month
+		users++
+	}
+
+	lines := []string{
+		fmt.Sprintf("**%s** (%d %s)", b.text(message.Chat.ID, "stats_global"), users, b.text(message.Chat.ID, "stats_users")),
+		fmt.Sprintf("%s: $%.2f", b.text(message.Chat.ID, "stats_costs_today"), costToday),
+		fmt.Sprintf("%s: $%.2f", b.text(message.Chat.ID, "stats_costs_month"), costMonth),
+		fmt.Sprintf("%s: $%.2f", b.text(message.Chat.ID, "stats_costs_all_time"), costAllTime),
+	}
+	if correctionMonth > 0 {
+		lines = append(lines, b.correctionStats(message.Chat.ID, correctionToday, correctionMonth))
+	}
+	if b.Config.OrgMonthlyBudget > 0 {
+		lines = append(lines, fmt.Sprintf("%s: $%.2f / $%.2f", b.text(message.Chat.ID, "stats_org_budget"), costMonth, b.Config.OrgMonthlyBudget))
+	}
+	if b.OpenAI.Billing != nil {
+		billed, err := b.OpenAI.GetBillingCurrentMonth()
+		if err != nil {
+			log.Printf("Billing reconciliation failed: %v", err)
+			lines = append(lines, fmt.Sprintf("%s: %s", b.text(message.Chat.ID, "stats_billed_month"), b.text(message.Chat.ID, "error")))
+		} else {
+			if math.Abs(billed-costMonth) > 0.01 {
+				log.Printf("Billing reconciliation: provider reports $%.2f this month, local trackers $%.2f", billed, costMonth)
+			}
+			lines = append(lines, fmt.Sprintf("%s: $%.2f", b.text(message.Chat.ID, "stats_billed_month"), billed))
+		}
+	}
+	lines = append(lines, "", "**"+b.text(message.Chat.ID, "stats_top_users")+"**")
+	for i, tracker := range usagetracker.TopUsers(trackers, 10) {
+		lines = append(lines, fmt.Sprintf("%d. %s (`%d`) - $%.2f", i+1, tracker, tracker.UserID, tracker.GetCurrentCost()["cost_month"]))
+	}
+
+	lines = append(lines, "", "**"+b.text(message.Chat.ID, "stats_daily_spend")+"**")
+	for _, day := range usagetracker.DailySpend(trackers, 30, b.Config.TokenPrice, b.Config.ImagePrices, b.Config.TranscriptionPrice, b.Config.EmbeddingPrice) {
+		if day.Cost > 0 {
+			lines = append(lines, fmt.Sprintf("%s: $%.2f", day.Date, day.Cost))
+		}
+	}
+
+	b.reply(message, strings.Join(lines, "\n"))
+	return nil
+}
+
+// correctionStats описывает токены исправлений грамматики. Они уже входят в токены и расходы чата,
+// строка показывает их долю
+func (b *Bot) correctionStats(chatID int64, today, month int) string {
+	return fmt.Sprintf("%s: %d/%d %s ($%.4f/$%.4f), %s", b.text(chatID, "stats_correction_tokens"),
+		today, month, b.text(chatID, "stats_tokens"),
+		float64(today)*b.Config.TokenPrice/1000, float64(month)*b.Config.TokenPrice/1000, b.text(chatID, "stats_correction_included"))
+}
+
+func formatBudget(budget float64) string {
+	if math.IsInf(budget, 1) {
+		return "∞"
+	}
+	return fmt.Sprintf("$%.2f", budget)
+}
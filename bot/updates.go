@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	"tutor/utils"
+)
+
+// rawMessage - поля сообщения, которые библиотека Telegram не декодирует
+type rawMessage struct {
+	MessageID       int  `json:"message_id"`
+	MessageThreadID int  `json:"message_thread_id"`
+	IsTopicMessage  bool `json:"is_topic_message"`
+	Chat            struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+}
+
+type rawUpdate struct {
+	Message *rawMessage `json:"message"`
+}
+
+// getUpdates запрашивает обновления, как BotAPI.GetUpdates, и дополнительно запоминает темы форума сообщений
+func (b *Bot) getUpdates(offset, timeout int) ([]telegram.Update, error) {
+	v := url.Values{}
+	if offset != 0 {
+		v.Add("offset", strconv.Itoa(offset))
+	}
+	v.Add("timeout", strconv.Itoa(timeout))
+
+	resp, err := b.API.MakeRequest("getUpdates", v)
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []telegram.Update
+	if err := json.Unmarshal(resp.Result, &updates); err != nil {
+		return nil, err
+	}
+
+	var raw []rawUpdate
+	if err := json.Unmarshal(resp.Result, &raw); err != nil {
+		return nil, err
+	}
+	for _, update := range raw {
+		// message_thread_id есть и у ответов в обычных группах, тема форума - только у is_topic_message
+		if m := update.Message; m != nil && m.IsTopicMessage {
+			utils.SetThreadID(m.Chat.ID, m.MessageID, m.MessageThreadID)
+		}
+	}
+	return updates, nil
+}
+
+// pollUpdates получает обновления в цикле и передает их handle по очереди.
+// Тема сообщения забывается после его обработки. tick вызывается после каждой пачки обновлений,
+// не реже чем раз в timeout секунд, в том же потоке, что и handle. Оба вызываются под b.mu
+func (b *Bot) pollUpdates(timeout int, handle func(telegram.Update), tick func()) {
+	offset := 0
+	for {
+		updates, err := b.getUpdates(offset, timeout)
+		if err != nil {
+			log.Printf("Failed to get updates, retrying in 3 seconds: %v", err)
+			time.Sleep(3 * time.Second)
+			continue
+		}
+
+		for _, update := range updates {
+			if update.UpdateID < offset {
+				continue
+			}
+			offset = update.UpdateID + 1
+			b.mu.Lock()
+			handle(update)
+			b.mu.Unlock()
+			if update.Message != nil {
+				utils.SetThreadID(update.Message.Chat.ID, update.Message.MessageID, 0)
+			}
+		}
+		b.mu.Lock()
+		tick()
+		b.mu.Unlock()
+	}
+}
@@ -0,0 +1,230 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	"tutor/helper"
+	"tutor/learning"
+	"tutor/utils"
+)
+
+const (
+	// vocabDrillOptions - сколько вариантов перевода предлагается в упражнении
+	vocabDrillOptions = 4
+	// vocabListed - сколько последних слов выводит /vocab
+	vocabListed = 30
+)
+
+// vocab управляет словарем ученика: /vocab - последние слова, /vocab drill - упражнение,
+// /vocab add <слово> = <перевод> - добавить слово, /vocab remove <слово> - удалить
+func (b *Bot) vocab(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	userID := message.From.ID
+	command, rest, _ := strings.Cut(strings.TrimSpace(message.CommandArguments()), " ")
+	rest = strings.TrimSpace(rest)
+
+	switch command {
+	case "":
+		return b.vocabList(message)
+	case "drill":
+		words, err := b.Vocab.Words(userID)
+		if err != nil {
+			return err
+		}
+		text, keyboard, ok := b.vocabDrill(chatID, userID, words)
+		if !ok {
+			b.reply(message, b.text(chatID, "vocab_drill_empty"))
+			return nil
+		}
+		msg := telegram.NewMessage(chatID, utils.ToTelegramHTML(text))
+		msg.ParseMode = telegram.ModeHTML
+		msg.ReplyToMessageID = utils.GetReplyToMessageID(b.Config, message)
+		msg.ReplyMarkup = keyboard
+		_, err = b.API.Send(msg)
+		return err
+	case "add":
+		word, translation, ok := strings.Cut(rest, "=")
+		if !ok || strings.TrimSpace(word) == "" || strings.TrimSpace(translation) == "" {
+			b.reply(message, b.text(chatID, "invalid_arguments")+"\n"+b.text(chatID, "vocab_description"))
+			return nil
+		}
+		added, err := b.Vocab.Add(userID, []learning.Word{{Word: word, Translation: translation}})
+		if err != nil {
+			return err
+		}
+		if len(added) == 0 {
+			b.reply(message, b.text(chatID, "vocab_exists"))
+			return nil
+		}
+		b.reply(message, fmt.Sprintf(b.text(chatID, "vocab_added"), added[0].Word))
+		return nil
+	case "remove":
+		removed, err := b.Vocab.Remove(userID, rest)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			b.reply(message, b.text(chatID, "vocab_not_found"))
+			return nil
+		}
+		b.reply(message, b.text(chatID, "vocab_removed"))
+		return nil
+	}
+
+	b.reply(message, b.text(chatID, "invalid_arguments")+"\n"+b.text(chatID, "vocab_description"))
+	return nil
+}
+
+// vocabList выводит последние слова словаря с долей правильных ответов
+func (b *Bot) vocabList(message *telegram.Message) error {
+	chatID := message.Chat.ID
+	words, err := b.Vocab.Words(message.From.ID)
+	if err != nil {
+		return err
+	}
+	if len(words) == 0 {
+		b.reply(message, b.text(chatID, "vocab_empty"))
+		return nil
+	}
+
+	lines := []string{fmt.Sprintf("**%s** (%d)", b.text(chatID, "vocab_title"), len(words))}
+	if len(words) > vocabListed {
+		words = words[len(words)-vocabListed:]
+	}
+	for _, word := range words {
+		line := fmt.Sprintf("%s - %s", word.Word, word.Translation)
+		if word.Drills > 0 {
+			line += fmt.Sprintf(" (%.0f%%)", word.Mastery()*100)
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "", b.text(chatID, "vocab_description"))
+	b.reply(message, strings.Join(lines, "\n"))
+	return nil
+}
+
+// vocabDrill возвращает упражнение: слово и кнопки с вариантами перевода "vocab:<ученик>:<слово>:<вариант>"
+func (b *Bot) vocabDrill(chatID int64, userID int, words []learning.Word) (string, telegram.InlineKeyboardMarkup, bool) {
+	target, choices, ok := learning.Drill(words, vocabDrillOptions)
+	if !ok {
+		return "", telegram.InlineKeyboardMarkup{}, false
+	}
+	text := fmt.Sprintf("**%s**\n\n%s", b.text(chatID, "vocab_drill_title"), fmt.Sprintf(b.text(chatID, "vocab_drill_question"), target.Word))
+
+	var rows [][]telegram.InlineKeyboardButton
+	for _, choice := range choices {
+		data := fmt.Sprintf("vocab:%d:%d:%d", userID, target.ID, choice.ID)
+		rows = append(rows, telegram.NewInlineKeyboardRow(telegram.NewInlineKeyboardButtonData(choice.Translation, data)))
+	}
+	return text, telegram.NewInlineKeyboardMarkup(rows...), true
+}
+
+// vocabCallback обрабатывает кнопки упражнения: "<ученик>:<слово>:<вариант>" и "<ученик>:next".
+// Нажимать их может только ученик, начавший упражнение
+func (b *Bot) vocabCallback(query *telegram.CallbackQuery, args string) (string, error) {
+	chatID := query.Message.Chat.ID
+	parts := strings.Split(args, ":")
+	userID, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) < 2 {
+		return "", fmt.Errorf("invalid vocab callback data %q", args)
+	}
+	if userID != query.From.ID {
+		return b.text(chatID, "not_permitted"), nil
+	}
+
+	words, err := b.Vocab.Words(userID)
+	if err != nil {
+		return "", err
+	}
+
+	var text, notice string
+	var keyboard telegram.InlineKeyboardMarkup
+	switch {
+	case parts[1] == "next":
+		var ok bool
+		if text, keyboard, ok = b.vocabDrill(chatID, userID, words); !ok {
+			text = b.text(chatID, "vocab_drill_empty")
+		}
+	case len(parts) == 3:
+		wordID, err1 := strconv.Atoi(parts[1])
+		choiceID, err2 := strconv.Atoi(parts[2])
+		if err1 != nil || err2 != nil {
+			return "", fmt.Errorf("invalid vocab callback data %q", args)
+		}
+		correct := wordID == choiceID
+		word, err := b.Vocab.RecordDrill(userID, wordID, correct, time.Now())
+		if err != nil {
+			return b.text(chatID, "vocab_not_found"), nil
+		}
+		value := 0.0
+		if correct {
+			value = 1
+		}
+		b.recordEvent(userID, learning.Event{Type: learning.EventVocabDrill, Topic: word.Word, Value: value})
+
+		notice = b.text(chatID, "vocab_drill_wrong")
+		if correct {
+			notice = b.text(chatID, "vocab_drill_correct")
+		}
+		text = fmt.Sprintf("%s\n\n**%s** - %s", notice, word.Word, word.Translation)
+		if word.Example != "" {
+			text += "\n_" + word.Example + "_"
+		}
+		keyboard = telegram.NewInlineKeyboardMarkup(telegram.NewInlineKeyboardRow(
+			telegram.NewInlineKeyboardButtonData(b.text(chatID, "vocab_drill_next"), fmt.Sprintf("vocab:%d:next", userID))))
+	default:
+		return "", fmt.Errorf("invalid vocab callback data %q", args)
+	}
+
+	edit := telegram.NewEditMessageText(chatID, query.Message.MessageID, utils.ToTelegramHTML(text))
+	edit.ParseMode = telegram.ModeHTML
+	if len(keyboard.InlineKeyboard) > 0 {
+		edit.ReplyMarkup = &keyboard
+	}
+	if _, err := b.API.Send(edit); err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		return "", err
+	}
+	return notice, nil
+}
+
+// updateVocabulary выписывает в словарь ученика слова из последнего обмена сообщениями, если в чате включен словарь.
+// Токены списываются с бюджета ученика
+func (b *Bot) updateVocabulary(message *telegram.Message, conversation helper.ConversationKey) {
+	if !b.OpenAI.ChatConfig(conversation).VocabBuilder {
+		return
+	}
+	userID, ok := conversationLearner(conversation)
+	if !ok || userID != message.From.ID {
+		return
+	}
+
+	words, tokensUsed, err := b.OpenAI.ExtractVocabulary(conversation, b.OpenAI.RecentConversation(conversation, 2))
+	if tokensUsed > 0 {
+		model := b.OpenAI.ChatConfig(conversation).Model
+		b.sendBudgetAlerts(utils.AddChatRequestToUsageTracker(b.Usage, b.Config, userID, message.Chat, model, tokensUsed))
+	}
+	if err != nil {
+		log.Printf("Failed to extract vocabulary for user %d: %v", userID, err)
+		return
+	}
+	added, err := b.Vocab.Add(userID, words)
+	if err != nil {
+		log.Printf("Failed to save vocabulary of user %d: %v", userID, err)
+		return
+	}
+	if len(added) == 0 {
+		return
+	}
+
+	terms := make([]string, len(added))
+	for i, word := range added {
+		terms[i] = word.Word
+	}
+	b.reply(message, fmt.Sprintf(b.text(message.Chat.ID, "vocab_added"), strings.Join(terms, ", ")))
+}
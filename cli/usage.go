@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	conf "tutor/config"
+	"tutor/usagetracker"
+)
+
+// RunUsage выполняет подкоманду "tutor usage <команда>"
+func RunUsage(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: tutor usage export|repair [flags]")
+	}
+	switch args[0] {
+	case "export":
+		return runExport(args[1:])
+	case "repair":
+		return runRepair(args[1:])
+	default:
+		return fmt.Errorf("unknown usage command %q", args[0])
+	}
+}
+
+// runExport выгружает использование всех трекеров из LogsDir в CSV или JSON lines
+func runExport(args []string) error {
+	cfg := conf.ReadEnv()
+
+	fs := flag.NewFlagSet("usage export", flag.ContinueOnError)
+	logsDir := fs.String("logs-dir", cfg.LogsDir, "directory with usage tracker files")
+	format := fs.String("format", "csv", "output format: csv or json (JSON lines)")
+	from := fs.String("from", "", "first date to export, YYYY-MM-DD")
+	to := fs.String("to", "", "last date to export, YYYY-MM-DD")
+	userID := fs.Int("user", 0, "export only this user id")
+	all := fs.Bool("all", false, "also export guest and group chat trackers, which duplicate user costs")
+	output := fs.String("o", "", "output file, stdout if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	for _, date := range []string{*from, *to} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+		}
+	}
+
+	trackers, err := usagetracker.LoadUsageTrackers(*logsDir)
+	if err != nil {
+		return err
+	}
+
+	var records []usagetracker.Record
+	for _, tracker := range trackers {
+		if *userID != 0 && tracker.UserID != *userID {
+			continue
+		}
+		if !*all && !tracker.IsCountedInTotals() {
+			continue
+		}
+		records = append(records, tracker.Records(*from, *to, cfg.TokenPrice, cfg.ImagePrices, cfg.TranscriptionPrice, cfg.EmbeddingPrice)...)
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	switch *format {
+	case "csv":
+		return writeCSV(out, records)
+	case "json":
+		return writeJSONLines(out, records)
+	default:
+		return fmt.Errorf("unknown format %q, expected csv or json", *format)
+	}
+}
+
+func writeCSV(out io.Writer, records []usagetracker.Record) error {
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"user_id", "user_name", "date", "category", "model", "amount", "cost", "included_in"}); err != nil {
+		return err
+	}
+	for _, r := range records {
+		row := []string{
+			strconv.Itoa(r.UserID),
+			r.UserName,
+			r.Date,
+			r.Category,
+			r.Model,
+			strconv.Itoa(r.Amount),
+			strconv.FormatFloat(r.Cost, 'f', 6, 64),
+			r.IncludedIn,
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func writeJSONLines(out io.Writer, records []usagetracker.Record) error {
+	enc := json.NewEncoder(out)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runRepair пересчитывает затраты всех трекеров из истории и сообщает о расхождениях с сохраненными значениями
+func runRepair(args []string) error {
+	cfg := conf.ReadEnv()
+
+	fs := flag.NewFlagSet("usage repair", flag.ContinueOnError)
+	logsDir := fs.String("logs-dir", cfg.LogsDir, "directory with usage tracker files")
+	userID := fs.Int("user", 0, "repair only this user id")
+	tolerance := fs.Float64("tolerance", 0.01, "ignore discrepancies up to this amount")
+	write := fs.Bool("write", false, "rewrite tracker files with the recomputed costs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	trackers, err := usagetracker.LoadUsageTrackers(*logsDir)
+	if err != nil {
+		return err
+	}
+
+	found, written := 0, 0
+	for _, tracker := range trackers {
+		if *userID != 0 && tracker.UserID != *userID {
+			continue
+		}
+		result := tracker.Repair(cfg.TokenPrice, cfg.ImagePrices, cfg.TranscriptionPrice, cfg.EmbeddingPrice, *tolerance, *write)
+		if result.Written {
+			written++
+		}
+		for _, key := range result.Discrepancies(*tolerance) {
+			fmt.Printf("%d (%s) %s: stored $%.6f, recomputed $%.6f\n",
+				result.UserID, tracker, key, result.Stored[key], result.Recomputed[key])
+			found++
+		}
+	}
+
+	fmt.Printf("%d trackers checked, %d discrepancies found", len(trackers), found)
+	if *write {
+		fmt.Printf(", %d files rewritten", written)
+	}
+	fmt.Println()
+	return nil
+}
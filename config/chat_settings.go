@@ -0,0 +1,175 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// ChatSettings - настройки, выбранные в чате через /settings. Пустые поля берутся из глобальной конфигурации
+type ChatSettings struct {
+	Model  string `json:"model,omitempty"`
+	Preset string `json:"preset,omitempty"`
+	// PresetVars - значения переменных промпта пресета, например level или name
+	PresetVars  map[string]string `json:"preset_vars,omitempty"`
+	Temperature *float32          `json:"temperature,omitempty"`
+	Language    string            `json:"language,omitempty"`
+	Stream      *bool             `json:"stream,omitempty"`
+	HintMode    *bool             `json:"hint_mode,omitempty"`
+	Vocabulary  *bool             `json:"vocabulary,omitempty"`
+	Corrections *bool             `json:"corrections,omitempty"`
+	// CodeExecution - разрешен ли модели запуск кода в песочнице. Меняют только администраторы
+	CodeExecution *bool `json:"code_execution,omitempty"`
+}
+
+func (s ChatSettings) isZero() bool {
+	return s.Model == "" && s.Preset == "" && len(s.PresetVars) == 0 &&
+		s.Temperature == nil && s.Language == "" && s.Stream == nil && s.HintMode == nil && s.Vocabulary == nil && s.Corrections == nil &&
+		s.CodeExecution == nil
+}
+
+// chatSettingsEntry - формат записи в файле настроек чатов
+type chatSettingsEntry struct {
+	ChatID int64 `json:"chat_id"`
+	ChatSettings
+}
+
+// ChatSettingsStore хранит настройки чатов
+type ChatSettingsStore struct {
+	mu    sync.RWMutex
+	path  string // файл, в который сохраняются изменения; пустой - только в памяти
+	chats map[int64]ChatSettings
+}
+
+// NewChatSettingsStore создает пустое хранилище, которое сохраняется в path
+func NewChatSettingsStore(path string) *ChatSettingsStore {
+	return &ChatSettingsStore{path: path, chats: make(map[int64]ChatSettings)}
+}
+
+// LoadChatSettings читает настройки чатов из JSON-файла. Если файла нет, хранилище создается пустым
+func LoadChatSettings(path string) (*ChatSettingsStore, error) {
+	s := NewChatSettingsStore(path)
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading chat settings file: %v", err)
+	}
+	var entries []chatSettingsEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("error unmarshalling chat settings file: %v", err)
+	}
+	for _, entry := range entries {
+		s.chats[entry.ChatID] = entry.ChatSettings
+	}
+	return s, nil
+}
+
+// ChatSettingsStore возвращает загруженное хранилище настроек чатов или пустое хранилище в памяти
+func (c Config) ChatSettingsStore() *ChatSettingsStore {
+	if c.ChatSettings != nil {
+		return c.ChatSettings
+	}
+	return NewChatSettingsStore("")
+}
+
+// Get возвращает настройки чата
+func (s *ChatSettingsStore) Get(chatID int64) ChatSettings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.chats[chatID]
+}
+
+// Update изменяет настройки чата и сохраняет их
+func (s *ChatSettingsStore) Update(chatID int64, update func(*ChatSettings)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings := s.chats[chatID]
+	update(&settings)
+	if settings.isZero() {
+		delete(s.chats, chatID)
+	} else {
+		s.chats[chatID] = settings
+	}
+	return s.persistLocked()
+}
+
+func (s *ChatSettingsStore) persistLocked() error {
+	if s.path == "" {
+		log.Println("Chat settings file is not configured, settings will be lost on restart")
+		return nil
+	}
+
+	entries := make([]chatSettingsEntry, 0, len(s.chats))
+	for chatID, settings := range s.chats {
+		entries = append(entries, chatSettingsEntry{ChatID: chatID, ChatSettings: settings})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ChatID < entries[j].ChatID })
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+// AllowedModelList возвращает модели, которые чат может выбрать: Model и AllowedModels
+func (c Config) AllowedModelList() []string {
+	models := []string{c.Model}
+	for _, model := range splitList(c.AllowedModels) {
+		if model != c.Model {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// ForChat возвращает конфигурацию с настройками чата поверх глобальных.
+// Модели не из списка разрешенных и неизвестные пресеты игнорируются
+func (c Config) ForChat(chatID int64) Config {
+	settings := c.ChatSettingsStore().Get(chatID)
+
+	if settings.Model != "" && slices.Contains(c.AllowedModelList(), settings.Model) {
+		c.Model = settings.Model
+	}
+	if settings.Preset != "" {
+		if prompt, ok := c.PresetPrompt(settings.Preset, settings.PresetVars); ok {
+			c.AssistantPrompt = prompt
+		}
+	}
+	if settings.Temperature != nil {
+		c.Temperature = *settings.Temperature
+	}
+	if settings.Language != "" {
+		c.BotLanguage = settings.Language
+	}
+	if settings.Stream != nil {
+		c.Stream = *settings.Stream
+	}
+	if settings.HintMode != nil {
+		c.HintMode = *settings.HintMode
+	}
+	if settings.Vocabulary != nil {
+		c.VocabBuilder = *settings.Vocabulary
+	}
+	if settings.Corrections != nil {
+		c.CorrectionMode = *settings.Corrections
+	}
+	if settings.CodeExecution != nil {
+		c.CodeExecution = *settings.CodeExecution
+	}
+	return c
+}
@@ -2,24 +2,62 @@ package config
 
 type Config struct {
 	APIKey                    string
+	TelegramToken             string
 	BotLanguage               string
 	Model                     string
+	AllowedModels             string
 	MaxTokens                 int
 	NChoices                  int
 	Temperature               float32
 	PresencePenalty           float32
 	FrequencyPenalty          float32
 	ShowUsage                 bool
+	Stream                    bool
+	HintMode                  bool
 	AdminUserIDs              string
 	AllowedUserIDs            string
 	UserBudgets               string
 	BudgetPeriod              string
 	GuestBudget               float64
+	ChatBudgets               string
+	GroupBudget               float64
+	BudgetPrecedence          string
+	GroupTrigger              string
+	GroupKeywords             string
+	GroupContext              string
+	GroupPolicies             string
+	BudgetAlertThresholds     string
+	BudgetAlertRecipients     string
+	OrgMonthlyBudget          float64
+	BillingSource             string
+	BillingURL                string
 	EnableQuoting             bool
 	TokenPrice                float64
+	ImagePrices               []float64
+	TranscriptionPrice        float64
+	EmbeddingPrice            float64
+	EmbeddingModel            string
 	MaxHistorySize            int
 	MaxConversationAgeMinutes int
+	AutoFlashcards            bool
+	VocabBuilder              bool
+	CorrectionMode            bool
+	CodeExecution             bool
+	SandboxTimeoutSeconds     int
+	SandboxMemoryMB           int
+	ReportBudget              float64
+	DigestWeekday             string
+	DigestHour                int
+	ExamTimeLimitMinutes      int
 	AssistantPrompt           string
 	ImageSize                 string
 	LogsDir                   string
+	UsersFile                 string
+	Users                     *UserRegistry
+	ChatSettingsFile          string
+	ChatSettings              *ChatSettingsStore
+	PromptsFile               string
+	LessonsFile               string
+	ExamsFile                 string
+	Prompts                   *PromptLibrary
 }
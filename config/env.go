@@ -0,0 +1,166 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+// FromEnv собирает конфигурацию бота из переменных окружения и загружает реестр пользователей, настройки чатов и пресеты промптов
+func FromEnv() (Config, error) {
+	cfg := ReadEnv()
+	if cfg.APIKey == "" || cfg.TelegramToken == "" {
+		return cfg, fmt.Errorf("OPENAI_API_KEY and TELEGRAM_BOT_TOKEN environment variables must be set")
+	}
+
+	users, err := LoadUsers(cfg)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Users = users
+
+	settings, err := LoadChatSettings(cfg.ChatSettingsFile)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.ChatSettings = settings
+
+	prompts, err := LoadPromptLibrary(cfg.PromptsFile)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Prompts = prompts
+
+	return cfg, nil
+}
+
+// ReadEnv читает переменные окружения без проверок, например для офлайн-команд.
+// Значения по умолчанию совпадают с оригинальным ботом
+func ReadEnv() Config {
+	return Config{
+		APIKey:                    os.Getenv("OPENAI_API_KEY"),
+		TelegramToken:             os.Getenv("TELEGRAM_BOT_TOKEN"),
+		BotLanguage:               getEnv("BOT_LANGUAGE", "en"),
+		Model:                     getEnv("OPENAI_MODEL", "gpt-3.5-turbo"),
+		AllowedModels:             os.Getenv("ALLOWED_MODELS"),
+		MaxTokens:                 getEnvInt("MAX_TOKENS", 1200),
+		NChoices:                  getEnvInt("N_CHOICES", 1),
+		Temperature:               float32(getEnvFloat("TEMPERATURE", 1.0)),
+		PresencePenalty:           float32(getEnvFloat("PRESENCE_PENALTY", 0.0)),
+		FrequencyPenalty:          float32(getEnvFloat("FREQUENCY_PENALTY", 0.0)),
+		ShowUsage:                 getEnvBool("SHOW_USAGE", false),
+		Stream:                    getEnvBool("STREAM", true),
+		HintMode:                  getEnvBool("HINT_MODE", false),
+		AdminUserIDs:              getEnv("ADMIN_USER_IDS", "-"),
+		AllowedUserIDs:            getEnv("ALLOWED_TELEGRAM_USER_IDS", "*"),
+		UserBudgets:               getEnv("USER_BUDGETS", "*"),
+		BudgetPeriod:              getEnv("BUDGET_PERIOD", "monthly"),
+		GuestBudget:               getEnvFloat("GUEST_BUDGET", 0.0),
+		ChatBudgets:               os.Getenv("CHAT_BUDGETS"),
+		GroupBudget:               getEnvFloat("GROUP_BUDGET", 0.0),
+		BudgetPrecedence:          getEnv("BUDGET_PRECEDENCE", "both"),
+		GroupTrigger:              getEnv("GROUP_TRIGGER", "mention"),
+		GroupKeywords:             os.Getenv("GROUP_KEYWORDS"),
+		GroupContext:              getEnv("GROUP_CONTEXT", "chat"),
+		GroupPolicies:             os.Getenv("GROUP_POLICIES"),
+		BudgetAlertThresholds:     os.Getenv("BUDGET_ALERT_THRESHOLDS"),
+		BudgetAlertRecipients:     getEnv("BUDGET_ALERT_RECIPIENTS", "user,admins"),
+		OrgMonthlyBudget:          getEnvFloat("ORG_MONTHLY_BUDGET", 0.0),
+		BillingSource:             os.Getenv("BILLING_SOURCE"),
+		BillingURL:                os.Getenv("BILLING_URL"),
+		EnableQuoting:             getEnvBool("ENABLE_QUOTING", true),
+		TokenPrice:                getEnvFloat("TOKEN_PRICE", 0.002),
+		ImagePrices:               getEnvFloatList("IMAGE_PRICES", []float64{0.016, 0.018, 0.02}),
+		TranscriptionPrice:        getEnvFloat("TRANSCRIPTION_PRICE", 0.006),
+		EmbeddingPrice:            getEnvFloat("EMBEDDING_PRICE", 0.00002),
+		EmbeddingModel:            getEnv("EMBEDDING_MODEL", "text-embedding-3-small"),
+		MaxHistorySize:            getEnvInt("MAX_HISTORY_SIZE", 15),
+		MaxConversationAgeMinutes: getEnvInt("MAX_CONVERSATION_AGE_MINUTES", 180),
+		AutoFlashcards:            getEnvBool("AUTO_FLASHCARDS", false),
+		VocabBuilder:              getEnvBool("VOCAB_BUILDER", false),
+		CorrectionMode:            getEnvBool("CORRECTION_MODE", false),
+		CodeExecution:             getEnvBool("CODE_EXECUTION", false),
+		SandboxTimeoutSeconds:     getEnvInt("SANDBOX_TIMEOUT_SECONDS", 10),
+		SandboxMemoryMB:           getEnvInt("SANDBOX_MEMORY_MB", 256),
+		ReportBudget:              getEnvFloat("REPORT_BUDGET", 0.0),
+		DigestWeekday:             getEnv("DIGEST_WEEKDAY", "monday"),
+		DigestHour:                getEnvInt("DIGEST_HOUR", 9),
+		ExamTimeLimitMinutes:      getEnvInt("EXAM_TIME_LIMIT_MINUTES", 30),
+		AssistantPrompt:           getEnv("ASSISTANT_PROMPT", "You are a helpful assistant."),
+		ImageSize:                 getEnv("IMAGE_SIZE", "512x512"),
+		LogsDir:                   getEnv("LOGS_DIR", "usage_logs"),
+		UsersFile:                 os.Getenv("USERS_FILE"),
+		ChatSettingsFile:          getEnv("CHAT_SETTINGS_FILE", "chat_settings.json"),
+		PromptsFile:               getEnv("PROMPTS_FILE", "prompts.json"),
+		LessonsFile:               getEnv("LESSONS_FILE", "lessons.json"),
+		ExamsFile:                 getEnv("EXAMS_FILE", "exams.json"),
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if val, ok := os.LookupEnv(key); ok && val != "" {
+		return val
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	val := getEnv(key, "")
+	if val == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(val)
+	if err != nil {
+		log.Printf("Invalid value '%s' for %s, using default %d", val, key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	val := getEnv(key, "")
+	if val == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		log.Printf("Invalid value '%s' for %s, using default %v", val, key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvFloatList(key string, defaultValue []float64) []float64 {
+	val := getEnv(key, "")
+	if val == "" {
+		return defaultValue
+	}
+	var parsed []float64
+	for _, item := range splitList(val) {
+		f, err := strconv.ParseFloat(item, 64)
+		if err != nil {
+			log.Printf("Invalid value '%s' for %s, using default %v", val, key, defaultValue)
+			return defaultValue
+		}
+		parsed = append(parsed, f)
+	}
+	if len(parsed) != len(defaultValue) {
+		log.Printf("%s must contain %d values, using default %v", key, len(defaultValue), defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	val := getEnv(key, "")
+	if val == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Printf("Invalid value '%s' for %s, using default %v", val, key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
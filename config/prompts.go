@@ -0,0 +1,218 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultPreset - пресет с промптом AssistantPrompt, есть всегда
+const DefaultPreset = "default"
+
+// Preset - именованный системный промпт. Prompt может содержать переменные вида {level},
+// которые заполняются из настроек чата, а если там их нет - из Variables
+type Preset struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Prompt      string            `json:"prompt"`
+	Variables   map[string]string `json:"variables,omitempty"`
+}
+
+// Render подставляет переменные в промпт. Неизвестные переменные остаются как есть
+func (p Preset) Render(vars map[string]string) string {
+	merged := make(map[string]string, len(p.Variables)+len(vars))
+	for k, v := range p.Variables {
+		merged[k] = v
+	}
+	for k, v := range vars {
+		merged[k] = v
+	}
+
+	var pairs []string
+	for k, v := range merged {
+		pairs = append(pairs, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(p.Prompt)
+}
+
+// defaultPresets используются, если файл пресетов еще не создан
+var defaultPresets = []Preset{
+	{
+		Name:        "math",
+		Description: "Math tutor",
+		Prompt: "You are a patient math tutor for {name}, a student at {level} level. Explain concepts step by step, " +
+			"ask the student to try each step before giving the answer and check their reasoning. Answer in {language}.",
+		Variables: map[string]string{"name": "the student", "level": "high school", "language": "the language of the student"},
+	},
+	{
+		Name:        "english",
+		Description: "English conversation partner",
+		Prompt: "You are a friendly English conversation partner for {name}, whose level is {level}. Keep the conversation going " +
+			"with questions, use vocabulary suited to their level and point out mistakes gently at the end of your reply. " +
+			"Explain difficult words in {language}.",
+		Variables: map[string]string{"name": "the student", "level": "B1", "language": "English"},
+	},
+	{
+		Name:        "code",
+		Description: "Code reviewer",
+		Prompt: "You are a code reviewer mentoring {name}, a {level} programmer. Review the code they send for bugs, " +
+			"readability and idiomatic style, explain why each change matters and suggest improvements rather than rewriting everything. " +
+			"Answer in {language}.",
+		Variables: map[string]string{"name": "the student", "level": "junior", "language": "the language of the student"},
+	},
+	{
+		Name:        "exam",
+		Description: "Exam coach",
+		Prompt: "You are an exam coach preparing {name} for {exam} at {level} level. Ask exam-style questions one at a time, " +
+			"grade each answer, explain what the examiner expects and keep track of weak topics. Answer in {language}.",
+		Variables: map[string]string{"name": "the student", "exam": "their exam", "level": "intermediate", "language": "the language of the student"},
+	},
+}
+
+// PromptLibrary хранит пресеты системного промпта
+type PromptLibrary struct {
+	mu      sync.RWMutex
+	path    string // файл, в который сохраняются изменения; пустой - только в памяти
+	presets map[string]Preset
+}
+
+// NewPromptLibrary создает библиотеку из списка пресетов
+func NewPromptLibrary(presets []Preset) *PromptLibrary {
+	l := &PromptLibrary{presets: make(map[string]Preset)}
+	for _, preset := range presets {
+		l.presets[preset.Name] = preset
+	}
+	return l
+}
+
+// LoadPromptLibrary читает пресеты из JSON-файла. Если файла нет, библиотека заполняется пресетами
+// по умолчанию и сохраняется в него при первом изменении
+func LoadPromptLibrary(path string) (*PromptLibrary, error) {
+	if path == "" {
+		return NewPromptLibrary(defaultPresets), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("Prompts file %s not found, using default presets", path)
+		l := NewPromptLibrary(defaultPresets)
+		l.path = path
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading prompts file: %v", err)
+	}
+
+	var presets []Preset
+	if err := json.Unmarshal(data, &presets); err != nil {
+		return nil, fmt.Errorf("error unmarshalling prompts file: %v", err)
+	}
+	for _, preset := range presets {
+		if err := validatePreset(preset); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	l := NewPromptLibrary(presets)
+	l.path = path
+	return l, nil
+}
+
+func validatePreset(preset Preset) error {
+	if preset.Name == "" || strings.ContainsAny(preset.Name, " :") {
+		return fmt.Errorf("invalid preset name %q", preset.Name)
+	}
+	if preset.Name == DefaultPreset {
+		return fmt.Errorf("preset name %q is reserved for ASSISTANT_PROMPT", DefaultPreset)
+	}
+	if strings.TrimSpace(preset.Prompt) == "" {
+		return fmt.Errorf("preset %q has no prompt", preset.Name)
+	}
+	return nil
+}
+
+// PromptLibrary возвращает загруженную библиотеку пресетов или библиотеку пресетов по умолчанию
+func (c Config) PromptLibrary() *PromptLibrary {
+	if c.Prompts != nil {
+		return c.Prompts
+	}
+	return NewPromptLibrary(defaultPresets)
+}
+
+// Lookup возвращает пресет по имени
+func (l *PromptLibrary) Lookup(name string) (Preset, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	preset, ok := l.presets[name]
+	return preset, ok
+}
+
+// List возвращает пресеты, отсортированные по имени
+func (l *PromptLibrary) List() []Preset {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	presets := make([]Preset, 0, len(l.presets))
+	for _, preset := range l.presets {
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	return presets
+}
+
+// Put добавляет или заменяет пресет и сохраняет библиотеку
+func (l *PromptLibrary) Put(preset Preset) error {
+	if err := validatePreset(preset); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.presets[preset.Name] = preset
+	return l.persistLocked()
+}
+
+func (l *PromptLibrary) persistLocked() error {
+	if l.path == "" {
+		log.Println("Prompts file is not configured, presets will be lost on restart")
+		return nil
+	}
+
+	presets := make([]Preset, 0, len(l.presets))
+	for _, preset := range l.presets {
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+
+	data, err := json.MarshalIndent(presets, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := l.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, l.path)
+}
+
+// PresetNames возвращает названия пресетов системного промпта, первым - DefaultPreset
+func (c Config) PresetNames() []string {
+	names := []string{DefaultPreset}
+	for _, preset := range c.PromptLibrary().List() {
+		names = append(names, preset.Name)
+	}
+	return names
+}
+
+// PresetPrompt возвращает системный промпт пресета с подставленными переменными
+func (c Config) PresetPrompt(name string, vars map[string]string) (string, bool) {
+	if name == DefaultPreset {
+		return c.AssistantPrompt, true
+	}
+	preset, ok := c.PromptLibrary().Lookup(name)
+	if !ok {
+		return "", false
+	}
+	return preset.Render(vars), true
+}
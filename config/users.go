@@ -0,0 +1,307 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Role определяет набор прав пользователя
+type Role string
+
+const (
+	RoleAdmin   Role = "admin"
+	RoleTeacher Role = "teacher"
+	RoleStudent Role = "student"
+	RoleGuest   Role = "guest" // незарегистрированные пользователи, в реестре не хранится
+)
+
+// User описывает пользователя бота в реестре
+type User struct {
+	ID           int      `json:"id"`
+	Name         string   `json:"name,omitempty"`
+	Role         Role     `json:"role"`
+	Budget       *float64 `json:"budget,omitempty"` // nil - без ограничений
+	BudgetPeriod string   `json:"budget_period,omitempty"`
+	Model        string   `json:"model,omitempty"`
+	Teacher      int      `json:"teacher,omitempty"` // ID учителя студента, 0 - любой учитель
+}
+
+// userRegistryFile - формат файла реестра пользователей
+type userRegistryFile struct {
+	AllowAll      bool     `json:"allow_all"`
+	DefaultBudget *float64 `json:"default_budget,omitempty"` // бюджет незарегистрированных пользователей при allow_all, nil - без ограничений
+	Users         []User   `json:"users"`
+}
+
+// UserRegistry хранит список пользователей с ролями, бюджетами и переопределениями модели
+type UserRegistry struct {
+	mu       sync.RWMutex
+	path     string // файл, в который сохраняются изменения; пустой - только в памяти
+	allowAll bool
+	// defaultBudget - бюджет незарегистрированных пользователей, когда доступ разрешен всем
+	defaultBudget *float64
+	users         map[int]User
+}
+
+// NewUserRegistry создает реестр из списка пользователей
+func NewUserRegistry(allowAll bool, users []User) *UserRegistry {
+	r := &UserRegistry{allowAll: allowAll, users: make(map[int]User)}
+	for _, user := range users {
+		// "user" - роль из первой версии реестра
+		if user.Role == "" || user.Role == "user" {
+			user.Role = RoleStudent
+		}
+		r.users[user.ID] = user
+	}
+	return r
+}
+
+// LoadUserRegistry читает реестр пользователей из JSON-файла
+func LoadUserRegistry(path string) (*UserRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading users file: %v", err)
+	}
+	var file userRegistryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error unmarshalling users file: %v", err)
+	}
+	for _, user := range file.Users {
+		if user.ID == 0 {
+			return nil, fmt.Errorf("user %q in %s has no id", user.Name, path)
+		}
+		switch user.Role {
+		case "", "user", RoleAdmin, RoleTeacher, RoleStudent:
+		default:
+			return nil, fmt.Errorf("user %d in %s has unknown role %q", user.ID, path, user.Role)
+		}
+	}
+	r := NewUserRegistry(file.AllowAll, file.Users)
+	r.defaultBudget = file.DefaultBudget
+	r.path = path
+	return r, nil
+}
+
+// NewLegacyUserRegistry конвертирует старые параллельные списки AdminUserIDs, AllowedUserIDs и UserBudgets в реестр
+func NewLegacyUserRegistry(cfg Config) *UserRegistry {
+	var users []User
+	seen := make(map[int]int)
+
+	allowedUserIDs := splitList(cfg.AllowedUserIDs)
+	allowAll := len(allowedUserIDs) == 1 && allowedUserIDs[0] == "*"
+	var defaultBudget *float64
+	if allowAll && cfg.UserBudgets != "*" {
+		// при ALLOWED_TELEGRAM_USER_IDS="*" у всех пользователей один бюджет - первый в списке
+		budget, userBudgets := 0.0, splitList(cfg.UserBudgets)
+		var err error
+		if len(userBudgets) == 0 {
+			log.Printf("No budget set for users. Budget list is empty.")
+		} else if budget, err = strconv.ParseFloat(userBudgets[0], 64); err != nil {
+			log.Printf("Error parsing budget for all users")
+			budget = 0.0
+		}
+		defaultBudget = &budget
+	}
+	if !allowAll {
+		userBudgets := splitList(cfg.UserBudgets)
+		for idx, id := range allowedUserIDs {
+			userID, err := strconv.Atoi(id)
+			if err != nil {
+				log.Printf("Skipping invalid user id '%s' in allowed user ids", id)
+				continue
+			}
+			user := User{ID: userID, Role: RoleStudent}
+			if cfg.UserBudgets != "*" {
+				budget := 0.0
+				if idx >= len(userBudgets) {
+					log.Printf("No budget set for user id: %d. Budget list shorter than user list.", userID)
+				} else if budget, err = strconv.ParseFloat(userBudgets[idx], 64); err != nil {
+					log.Printf("Error parsing budget for user id: %d", userID)
+					budget = 0.0
+				}
+				user.Budget = &budget
+			}
+			seen[userID] = len(users)
+			users = append(users, user)
+		}
+	}
+
+	if cfg.AdminUserIDs != "-" {
+		for _, id := range splitList(cfg.AdminUserIDs) {
+			userID, err := strconv.Atoi(id)
+			if err != nil {
+				log.Printf("Skipping invalid user id '%s' in admin user ids", id)
+				continue
+			}
+			if idx, ok := seen[userID]; ok {
+				users[idx].Role = RoleAdmin
+				continue
+			}
+			seen[userID] = len(users)
+			users = append(users, User{ID: userID, Role: RoleAdmin})
+		}
+	}
+
+	r := NewUserRegistry(allowAll, users)
+	r.defaultBudget = defaultBudget
+	return r
+}
+
+// LoadUsers возвращает реестр из UsersFile, а если он не задан - конвертирует старые списки из конфигурации.
+// Если UsersFile задан, но еще не существует, он создается из старых списков
+func LoadUsers(cfg Config) (*UserRegistry, error) {
+	if cfg.UsersFile == "" {
+		return NewLegacyUserRegistry(cfg), nil
+	}
+	if _, err := os.Stat(cfg.UsersFile); os.IsNotExist(err) {
+		log.Printf("Users file %s not found, converting legacy user lists", cfg.UsersFile)
+		r := NewLegacyUserRegistry(cfg)
+		r.path = cfg.UsersFile
+		if err := r.Save(cfg.UsersFile); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	return LoadUserRegistry(cfg.UsersFile)
+}
+
+// UserRegistry возвращает реестр пользователей. Реестр загружается один раз в FromEnv или bot.New,
+// конфигурация без реестра, например из ReadEnv, считается пустым реестром без доступа
+func (c Config) UserRegistry() *UserRegistry {
+	if c.Users != nil {
+		return c.Users
+	}
+	return emptyRegistry
+}
+
+var emptyRegistry = NewUserRegistry(false, nil)
+
+// AllowAll сообщает, разрешен ли доступ любому пользователю
+func (r *UserRegistry) AllowAll() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.allowAll
+}
+
+// DefaultBudget возвращает бюджет незарегистрированных пользователей при разрешенном всем доступе, nil - без ограничений
+func (r *UserRegistry) DefaultBudget() *float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.defaultBudget
+}
+
+// Lookup ищет пользователя по точному совпадению ID
+func (r *UserRegistry) Lookup(userID int) (User, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	user, ok := r.users[userID]
+	return user, ok
+}
+
+// List возвращает всех пользователей, отсортированных по ID
+func (r *UserRegistry) List() []User {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	users := make([]User, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+// SetBudget меняет бюджет зарегистрированного пользователя, nil снимает ограничение
+func (r *UserRegistry) SetBudget(userID int, budget *float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[userID]
+	if !ok {
+		return fmt.Errorf("user %d is not registered", userID)
+	}
+	user.Budget = budget
+	r.users[userID] = user
+	return r.persistLocked()
+}
+
+// Put добавляет пользователя или заменяет существующего с тем же ID
+func (r *UserRegistry) Put(user User) error {
+	if user.ID == 0 {
+		return fmt.Errorf("user has no id")
+	}
+	if user.Role == "" {
+		user.Role = RoleStudent
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[user.ID] = user
+	return r.persistLocked()
+}
+
+// Remove удаляет пользователя из реестра
+func (r *UserRegistry) Remove(userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[userID]; !ok {
+		return fmt.Errorf("user %d is not registered", userID)
+	}
+	delete(r.users, userID)
+	return r.persistLocked()
+}
+
+// SetAllowAll разрешает или запрещает доступ незарегистрированным пользователям
+func (r *UserRegistry) SetAllowAll(allowAll bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.allowAll = allowAll
+	return r.persistLocked()
+}
+
+// Save записывает реестр в JSON-файл, например после конвертации старых списков
+func (r *UserRegistry) Save(path string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.saveLocked(path)
+}
+
+// persistLocked сохраняет изменения в файл реестра, если он есть. Вызывается под блокировкой
+func (r *UserRegistry) persistLocked() error {
+	if r.path == "" {
+		log.Println("Users file is not configured, registry changes will be lost on restart")
+		return nil
+	}
+	return r.saveLocked(r.path)
+}
+
+func (r *UserRegistry) saveLocked(path string) error {
+	file := userRegistryFile{AllowAll: r.allowAll, DefaultBudget: r.defaultBudget, Users: make([]User, 0, len(r.users))}
+	for _, user := range r.users {
+		file.Users = append(file.Users, user)
+	}
+	sort.Slice(file.Users, func(i, j int) bool { return file.Users[i].ID < file.Users[j].ID })
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
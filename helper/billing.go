@@ -0,0 +1,93 @@
+package helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	conf "tutor/config"
+)
+
+const defaultBillingURL = "https://api.openai.com"
+
+// BillingSource возвращает расходы организации за текущий месяц в долларах.
+// Используется для сверки с локальными трекерами, поэтому реализацию можно подменить
+type BillingSource interface {
+	CurrentMonthUsage() (float64, error)
+}
+
+// NewBillingSource создает источник биллинга по Config.BillingSource, nil - сверка отключена
+func NewBillingSource(config conf.Config) BillingSource {
+	switch config.BillingSource {
+	case "":
+		return nil
+	case "openai":
+		return NewOpenAIBillingSource(config.APIKey, config.BillingURL)
+	default:
+		log.Printf("Unknown billing source '%s', billing reconciliation is disabled", config.BillingSource)
+		return nil
+	}
+}
+
+// OpenAIBillingSource читает расходы из устаревшего эндпоинта /dashboard/billing/usage
+type OpenAIBillingSource struct {
+	APIKey  string
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewOpenAIBillingSource создает источник биллинга OpenAI, пустой baseURL - api.openai.com
+func NewOpenAIBillingSource(apiKey, baseURL string) *OpenAIBillingSource {
+	if baseURL == "" {
+		baseURL = defaultBillingURL
+	}
+	return &OpenAIBillingSource{
+		APIKey:  apiKey,
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *OpenAIBillingSource) CurrentMonthUsage() (float64, error) {
+	today := time.Now()
+	firstDay := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location())
+	lastDay := firstDay.AddDate(0, 1, -1)
+
+	params := fmt.Sprintf("?start_date=%s&end_date=%s", firstDay.Format("2006-01-02"), lastDay.Format("2006-01-02"))
+
+	req, err := http.NewRequest("GET", s.BaseURL+"/dashboard/billing/usage"+params, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.APIKey)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("billing request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var billingData struct {
+		TotalUsage *float64 `json:"total_usage"`
+	}
+	if err := json.Unmarshal(body, &billingData); err != nil {
+		return 0, fmt.Errorf("error unmarshalling billing response: %v", err)
+	}
+	if billingData.TotalUsage == nil {
+		return 0, fmt.Errorf("billing response has no total_usage")
+	}
+
+	return *billingData.TotalUsage / 100, nil // convert cent amount to dollars
+}
@@ -0,0 +1,70 @@
+package helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenAIBillingSourceCurrentMonthUsage(t *testing.T) {
+	var gotPath, gotAuth, gotStart, gotEnd string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		gotStart = r.URL.Query().Get("start_date")
+		gotEnd = r.URL.Query().Get("end_date")
+		w.Write([]byte(`{"object": "list", "total_usage": 1234.5}`))
+	}))
+	defer server.Close()
+
+	usage, err := NewOpenAIBillingSource("test-key", server.URL+"/").CurrentMonthUsage()
+	if err != nil {
+		t.Fatalf("CurrentMonthUsage: %v", err)
+	}
+	if usage != 12.345 {
+		t.Errorf("usage = %v, want 12.345", usage)
+	}
+	if gotPath != "/dashboard/billing/usage" {
+		t.Errorf("path = %q", gotPath)
+	}
+	if gotAuth != "Bearer test-key" {
+		t.Errorf("Authorization = %q", gotAuth)
+	}
+	now := time.Now()
+	firstDay := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	if want := firstDay.Format("2006-01-02"); gotStart != want {
+		t.Errorf("start_date = %q, want %q", gotStart, want)
+	}
+	if want := firstDay.AddDate(0, 1, -1).Format("2006-01-02"); gotEnd != want {
+		t.Errorf("end_date = %q, want %q", gotEnd, want)
+	}
+}
+
+func TestOpenAIBillingSourceErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"http error", http.StatusUnauthorized, `{"error": "invalid key"}`, "status 401"},
+		{"invalid json", http.StatusOK, `not json`, "unmarshalling"},
+		{"no total usage", http.StatusOK, `{"object": "list"}`, "no total_usage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			_, err := NewOpenAIBillingSource("test-key", server.URL).CurrentMonthUsage()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"tutor/sandbox"
+)
+
+const (
+	// runCodeTool - имя функции запуска кода, которую может вызвать модель
+	runCodeTool = "run_code"
+	// maxToolRounds - сколько раз подряд модель может запускать код, прежде чем ей придется ответить
+	maxToolRounds = 3
+	// sandboxOutputBytes - сколько байт stdout и stderr запуска получает модель
+	sandboxOutputBytes = 4000
+)
+
+var runCodeParameters = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"language": {"type": "string", "enum": ["go", "python"]},
+		"code": {"type": "string", "description": "A complete program: package main with func main for Go, a script for Python. It can't read input or use the network."}
+	},
+	"required": ["language", "code"]
+}`)
+
+// runCodeRequest - аргументы вызова run_code
+type runCodeRequest struct {
+	Language string `json:"language"`
+	Code     string `json:"code"`
+}
+
+// tools возвращает инструменты, которые модель может вызвать в диалоге: запуск кода, если он разрешен в чате
+func (o *OpenAIHelper) tools(key ConversationKey) []openai.Tool {
+	if !o.ChatConfig(key).CodeExecution {
+		return nil
+	}
+	return []openai.Tool{{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name: runCodeTool,
+			Description: "Run a short Go or Python program in a sandbox without network access and with CPU, memory and time limits. " +
+				"Returns stdout, stderr and the exit code. Use it to check code before explaining what it does or prints.",
+			Parameters: runCodeParameters,
+		},
+	}}
+}
+
+// completeToolCalls выполняет вызовы инструментов из ответа модели и повторяет запрос с их результатами,
+// пока модель не ответит текстом. Возвращает последний ответ с токенами всех запросов. Если повторный запрос
+// не удался, ошибка - UsageError с токенами уже выполненных запросов
+func (o *OpenAIHelper) completeToolCalls(ctx context.Context, chat *ChatRequest, response openai.ChatCompletionResponse) (openai.ChatCompletionResponse, error) {
+	tokens := response.Usage.TotalTokens
+	req := chat.request
+	// копия, чтобы сообщения инструментов не попали в общий с историей массив
+	req.Messages = append([]openai.ChatCompletionMessage(nil), req.Messages...)
+	for round := 1; len(response.Choices) > 0 && len(response.Choices[0].Message.ToolCalls) > 0; round++ {
+		message := response.Choices[0].Message
+		req.Messages = append(req.Messages, message)
+		for _, call := range message.ToolCalls {
+			req.Messages = append(req.Messages, openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				ToolCallID: call.ID,
+				Content:    o.runToolCall(chat, call),
+			})
+		}
+		if round >= maxToolRounds {
+			req.ToolChoice = "none"
+		}
+
+		var err error
+		if response, err = o.Client.CreateChatCompletion(ctx, req); err != nil {
+			return response, withUsage(err, tokens)
+		}
+		tokens += response.Usage.TotalTokens
+	}
+	response.Usage.TotalTokens = tokens
+	return response, nil
+}
+
+// runToolCall запускает код из вызова run_code и возвращает результат для модели в JSON.
+// В историю диалога запуск записывается системной заметкой вместе с ответом: API не принимает сообщения tool
+// в запросах без описания инструментов, а запуск кода в чате могут выключить
+func (o *OpenAIHelper) runToolCall(chat *ChatRequest, call openai.ToolCall) string {
+	key := chat.key
+	var request runCodeRequest
+	if call.Function.Name != runCodeTool {
+		return toolError(fmt.Errorf("unknown tool %q", call.Function.Name))
+	}
+	if err := json.Unmarshal([]byte(call.Function.Arguments), &request); err != nil {
+		return toolError(fmt.Errorf("invalid arguments: %v", err))
+	}
+
+	cfg := o.ChatConfig(key)
+	log.Printf("Running %s code in conversation %s", request.Language, key)
+	result, err := sandbox.Run(request.Language, request.Code, sandbox.Limits{
+		Timeout:     time.Duration(cfg.SandboxTimeoutSeconds) * time.Second,
+		MemoryMB:    cfg.SandboxMemoryMB,
+		OutputBytes: sandboxOutputBytes,
+	})
+	if err != nil {
+		log.Printf("Code execution failed in conversation %s: %v", key, err)
+		return toolError(err)
+	}
+
+	chat.notes = append(chat.notes, codeRunNote(request, result))
+	data, err := json.Marshal(result)
+	if err != nil {
+		return toolError(err)
+	}
+	return string(data)
+}
+
+func toolError(err error) string {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(data)
+}
+
+// codeRunNote описывает запуск кода для истории диалога
+func codeRunNote(request runCodeRequest, result sandbox.Result) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The assistant ran this %s code in the sandbox:\n```%s\n%s\n```\n", request.Language, request.Language, request.Code)
+	if result.TimedOut {
+		b.WriteString("It was stopped by the time limit.\n")
+	} else {
+		fmt.Fprintf(&b, "Exit code: %d\n", result.ExitCode)
+	}
+	if result.Stdout != "" {
+		fmt.Fprintf(&b, "stdout:\n```\n%s\n```\n", result.Stdout)
+	}
+	if result.Stderr != "" {
+		fmt.Fprintf(&b, "stderr:\n```\n%s\n```\n", result.Stderr)
+	}
+	if result.Truncated {
+		b.WriteString("The output was truncated.\n")
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,41 @@
+package helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	conf "tutor/config"
+)
+
+func TestSendChatRequestChargesFailedToolRounds(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests > 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error": {"message": "model unavailable"}}`))
+			return
+		}
+		// the unknown tool is answered with an error without running the sandbox
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "tool_calls": [{"id": "call", "type": "function",
+			"function": {"name": "unknown", "arguments": "{}"}}]}}], "usage": {"total_tokens": 10}}`))
+	}))
+	defer server.Close()
+
+	clientConfig := openai.DefaultConfig("test-key")
+	clientConfig.BaseURL = server.URL + "/v1"
+	o := NewOpenAIHelper(conf.Config{CodeExecution: true, Model: "gpt-4o"})
+	o.Client = openai.NewClientWithConfig(clientConfig)
+
+	chat := &ChatRequest{key: ChatConversation(1), hintTokens: 5, request: openai.ChatCompletionRequest{Model: "gpt-4o"}}
+	_, err := o.SendChatRequest(chat)
+	if err == nil {
+		t.Fatal("expected the error of the third request")
+	}
+	if got := TokensUsedBy(err); got != 25 {
+		t.Errorf("TokensUsedBy = %d, want 25 for two tool rounds and the hint classifier", got)
+	}
+}
@@ -0,0 +1,27 @@
+package helper
+
+import "fmt"
+
+// ConversationKey идентифицирует историю диалога. В личном чате это только ID чата,
+// в группе диалог может вестись отдельно в каждой теме форума и для каждого участника
+type ConversationKey struct {
+	ChatID   int64
+	ThreadID int // тема форума, 0 - общий чат
+	UserID   int // участник группы со своим контекстом, 0 - общий контекст чата
+}
+
+// ChatConversation возвращает ключ общего диалога чата
+func ChatConversation(chatID int64) ConversationKey {
+	return ConversationKey{ChatID: chatID}
+}
+
+func (k ConversationKey) String() string {
+	s := fmt.Sprint(k.ChatID)
+	if k.ThreadID != 0 {
+		s += fmt.Sprintf("/%d", k.ThreadID)
+	}
+	if k.UserID != 0 {
+		s += fmt.Sprintf(":%d", k.UserID)
+	}
+	return s
+}
@@ -0,0 +1,57 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Correction - исправленный текст ученика и список правок
+type Correction struct {
+	Corrected string `json:"corrected"`
+	Edits     []Edit `json:"edits"`
+}
+
+// Edit - одна правка: исходный фрагмент, исправление и короткое объяснение
+type Edit struct {
+	Original    string `json:"original"`
+	Correction  string `json:"correction"`
+	Explanation string `json:"explanation"`
+}
+
+// CorrectText просит модель исправить грамматические, орфографические и лексические ошибки в сообщении ученика.
+// Объяснения пишутся на языке чата. Ответ запрашивается в JSON-режиме. Возвращает исправление и потраченные токены
+func (o *OpenAIHelper) CorrectText(key ConversationKey, text string) (Correction, int, error) {
+	cfg := o.ChatConfig(key)
+	messages := []openai.ChatCompletionMessage{
+		{Role: "system", Content: fmt.Sprintf("You correct the messages of a student practising a language. "+
+			"Fix grammar, spelling, word choice and punctuation mistakes, keep the meaning and style and don't rewrite correct text. "+
+			"Reply with a JSON object {\"corrected\": string, \"edits\": [{\"original\": string, \"correction\": string, \"explanation\": string}]}, "+
+			"where corrected is the whole corrected message and every edit is one fix with a very short explanation in the language with the code %q. "+
+			"If the message has no mistakes, return it unchanged with an empty list of edits.", cfg.BotLanguage)},
+		{Role: "user", Content: text},
+	}
+
+	response, err := o.Client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:          cfg.Model,
+		Messages:       messages,
+		Temperature:    0,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return Correction{}, 0, err
+	}
+	if len(response.Choices) == 0 {
+		return Correction{}, response.Usage.TotalTokens, fmt.Errorf("no correction in the response")
+	}
+
+	var correction Correction
+	content := strings.TrimSpace(response.Choices[0].Message.Content)
+	if err := json.Unmarshal([]byte(content), &correction); err != nil {
+		return Correction{}, response.Usage.TotalTokens, fmt.Errorf("error unmarshalling correction: %v", err)
+	}
+	return correction, response.Usage.TotalTokens, nil
+}
@@ -0,0 +1,193 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkoukk/tiktoken-go"
+	openai "github.com/sashabaranov/go-openai"
+
+	"tutor/learning"
+)
+
+const (
+	// documentChunkTokens - размер фрагмента документа в токенах
+	documentChunkTokens = 400
+	// documentChunkOverlap - сколько токенов конца фрагмента повторяется в начале следующего,
+	// чтобы мысль на границе фрагментов не терялась
+	documentChunkOverlap = 60
+	// embeddingBatchSize - сколько фрагментов отправляется в одном запросе эмбеддингов
+	embeddingBatchSize = 100
+)
+
+// IngestDocument извлекает текст документа, разбивает страницы на фрагменты и вычисляет их эмбеддинги.
+// Возвращает фрагменты, число страниц и потраченные токены. Токены возвращаются и при ошибке,
+// если часть эмбеддингов уже была получена
+func (o *OpenAIHelper) IngestDocument(name string, data []byte) ([]learning.Chunk, int, int, error) {
+	pages, err := learning.ExtractPages(name, data)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	chunks, err := ChunkPages(pages)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+	embeddings, tokens, err := o.EmbedTexts(texts)
+	if err != nil {
+		return nil, len(pages), tokens, err
+	}
+	for i := range chunks {
+		chunks[i].Embedding = embeddings[i]
+	}
+	return chunks, len(pages), tokens, nil
+}
+
+// EmbedTexts возвращает эмбеддинги текстов моделью из EmbeddingModel и потраченные токены
+func (o *OpenAIHelper) EmbedTexts(texts []string) ([][]float32, int, error) {
+	embeddings := make([][]float32, 0, len(texts))
+	tokens := 0
+	for start := 0; start < len(texts); start += embeddingBatchSize {
+		batch := texts[start:min(start+embeddingBatchSize, len(texts))]
+		response, err := o.Client.CreateEmbeddings(context.Background(), openai.EmbeddingRequest{
+			Input: batch,
+			Model: openai.EmbeddingModel(o.Config.EmbeddingModel),
+		})
+		if err != nil {
+			return nil, tokens, err
+		}
+		tokens += response.Usage.TotalTokens
+		if len(response.Data) != len(batch) {
+			return nil, tokens, fmt.Errorf("expected %d embeddings, got %d", len(batch), len(response.Data))
+		}
+		sort.Slice(response.Data, func(i, j int) bool { return response.Data[i].Index < response.Data[j].Index })
+		for _, data := range response.Data {
+			embeddings = append(embeddings, data.Embedding)
+		}
+	}
+	return embeddings, tokens, nil
+}
+
+// documentUnit - абзац или слово страницы с разделителем, который идет после него
+type documentUnit struct {
+	text   string
+	tokens int
+}
+
+// ChunkPages разбивает страницы на фрагменты примерно по documentChunkTokens токенов, не разрывая абзацы,
+// если они помещаются во фрагмент. Соседние фрагменты страницы перекрываются на documentChunkOverlap токенов
+func ChunkPages(pages []string) ([]learning.Chunk, error) {
+	// эту кодировку используют модели эмбеддингов OpenAI
+	encoding, err := tiktoken.GetEncoding("cl100k_base")
+	if err != nil {
+		return nil, err
+	}
+	return chunkPages(pages, func(text string) int { return len(encoding.Encode(text, nil, nil)) }), nil
+}
+
+func chunkPages(pages []string, count func(text string) int) []learning.Chunk {
+	var chunks []learning.Chunk
+	for page, text := range pages {
+		var units []documentUnit
+		for _, paragraph := range strings.Split(text, "\n\n") {
+			units = appendUnits(units, strings.TrimSpace(paragraph), "\n\n", count)
+		}
+
+		var current []documentUnit
+		size, carried := 0, 0
+		flush := func() {
+			if len(current) <= carried {
+				return
+			}
+			var b strings.Builder
+			for _, unit := range current {
+				b.WriteString(unit.text)
+			}
+			chunks = append(chunks, learning.Chunk{Page: page + 1, Text: strings.TrimSpace(b.String())})
+
+			carried, size = 0, 0
+			for i := len(current) - 1; i > 0 && size+current[i].tokens <= documentChunkOverlap; i-- {
+				size += current[i].tokens
+				carried++
+			}
+			current = append([]documentUnit(nil), current[len(current)-carried:]...)
+		}
+		for _, unit := range units {
+			if size+unit.tokens > documentChunkTokens {
+				flush()
+			}
+			current = append(current, unit)
+			size += unit.tokens
+		}
+		flush()
+	}
+	return chunks
+}
+
+// appendUnits добавляет абзац одной единицей, если он помещается во фрагмент, иначе - построчно,
+// слишком длинные строки - по словам, а слишком длинные слова, например ссылки или формулы, - по символам
+func appendUnits(units []documentUnit, paragraph, separator string, count func(text string) int) []documentUnit {
+	if paragraph == "" {
+		return units
+	}
+	if tokens := count(paragraph); tokens <= documentChunkTokens {
+		return append(units, documentUnit{text: paragraph + separator, tokens: tokens})
+	}
+
+	if lines := strings.Split(paragraph, "\n"); len(lines) > 1 {
+		for i, line := range lines {
+			lineSeparator := "\n"
+			if i == len(lines)-1 {
+				lineSeparator = separator
+			}
+			units = appendUnits(units, strings.TrimSpace(line), lineSeparator, count)
+		}
+		return units
+	}
+
+	words := strings.Fields(paragraph)
+	for i, word := range words {
+		wordSeparator := " "
+		if i == len(words)-1 {
+			wordSeparator = separator
+		}
+		if tokens := count(" " + word); tokens <= documentChunkTokens {
+			units = append(units, documentUnit{text: word + wordSeparator, tokens: tokens})
+			continue
+		}
+		// символ UTF-8 занимает не больше 4 байт и не дает больше токенов, чем байт
+		runes := []rune(word)
+		for len(runes) > 0 {
+			piece := runes[:min(len(runes), documentChunkTokens/4)]
+			runes = runes[len(piece):]
+			pieceSeparator := ""
+			if len(runes) == 0 {
+				pieceSeparator = wordSeparator
+			}
+			units = append(units, documentUnit{text: string(piece) + pieceSeparator, tokens: count(string(piece))})
+		}
+	}
+	return units
+}
+
+// DocumentInstructions возвращает инструкции с найденными фрагментами документов для системного сообщения
+func DocumentInstructions(matches []learning.DocumentMatch) string {
+	if len(matches) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("Excerpts from the course materials uploaded by the teacher are given below. " +
+		"Base your answer on them when they are relevant and cite every fact taken from them right after it " +
+		"in the form [document, p. N], using the reference given before the excerpt. " +
+		"If the excerpts don't cover the question, say so briefly and answer from general knowledge without citations.")
+	for _, match := range matches {
+		fmt.Fprintf(&b, "\n\n[%s]\n%s", match.Citation(), match.Chunk.Text)
+	}
+	return b.String()
+}
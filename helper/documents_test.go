@@ -0,0 +1,101 @@
+package helper
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"tutor/learning"
+)
+
+// countStub counts a token for every started 10 bytes of a word, so short words are one token each.
+func countStub(text string) int {
+	tokens := 0
+	for _, word := range strings.Fields(text) {
+		tokens += (len(word) + 9) / 10
+	}
+	return tokens
+}
+
+// words returns the words w<from> to w<to-1> joined with sep.
+func words(from, to int, sep string) string {
+	var w []string
+	for i := from; i < to; i++ {
+		w = append(w, fmt.Sprintf("w%d", i))
+	}
+	return strings.Join(w, sep)
+}
+
+func TestChunkPages(t *testing.T) {
+	overlap := documentChunkOverlap
+	tests := []struct {
+		name  string
+		pages []string
+		want  []learning.Chunk
+	}{
+		{
+			name:  "short pages",
+			pages: []string{"Hello world", "", "Page  three\n\n\n"},
+			want:  []learning.Chunk{{Page: 1, Text: "Hello world"}, {Page: 3, Text: "Page  three"}},
+		},
+		{
+			name: "paragraphs are kept whole",
+			pages: []string{strings.Join([]string{
+				words(0, 100, " "), words(100, 200, " "), words(200, 300, " "), words(300, 400, " "), words(400, 500, " "),
+			}, "\n\n")},
+			want: []learning.Chunk{
+				{Page: 1, Text: strings.Join([]string{words(0, 100, " "), words(100, 200, " "), words(200, 300, " "), words(300, 400, " ")}, "\n\n")},
+				{Page: 1, Text: words(400, 500, " ")},
+			},
+		},
+		{
+			name:  "long paragraph is split by lines",
+			pages: []string{words(0, 200, " ") + "\n" + words(200, 400, " ") + "\n" + words(400, 600, " ")},
+			want: []learning.Chunk{
+				{Page: 1, Text: words(0, 200, " ") + "\n" + words(200, 400, " ")},
+				{Page: 1, Text: words(400, 600, " ")},
+			},
+		},
+		{
+			name:  "long line is split by words with overlap",
+			pages: []string{words(0, 1000, " ")},
+			want: []learning.Chunk{
+				{Page: 1, Text: words(0, 400, " ")},
+				{Page: 1, Text: words(400-overlap, 800-overlap, " ")},
+				{Page: 1, Text: words(800-2*overlap, 1000, " ")},
+			},
+		},
+		{
+			name:  "overlap stays on its page",
+			pages: []string{words(0, 500, " "), words(500, 510, " ")},
+			want: []learning.Chunk{
+				{Page: 1, Text: words(0, 400, " ")},
+				{Page: 1, Text: words(400-overlap, 500, " ")},
+				{Page: 2, Text: words(500, 510, " ")},
+			},
+		},
+		{
+			name:  "long word is split by characters",
+			pages: []string{"see " + strings.Repeat("x", 6000) + " end"},
+			want: []learning.Chunk{
+				// pieces of 100 characters are 10 tokens
+				{Page: 1, Text: "see " + strings.Repeat("x", 3900)},
+				{Page: 1, Text: strings.Repeat("x", 2700) + " end"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chunkPages(tt.pages, countStub)
+			for i, chunk := range got {
+				if tokens := countStub(chunk.Text); tokens > documentChunkTokens {
+					t.Errorf("chunk %d has %d tokens, limit %d", i+1, tokens, documentChunkTokens)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %d chunks:\n%+v\nwant %d chunks:\n%+v", len(got), got, len(tt.want), tt.want)
+			}
+		})
+	}
+}
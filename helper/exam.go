@@ -0,0 +1,130 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"tutor/learning"
+)
+
+// GenerateExam просит модель составить count открытых вопросов по теме с критериями оценки.
+// Ответ запрашивается в JSON-режиме. Возвращает вопросы и потраченные токены
+func (o *OpenAIHelper) GenerateExam(key ConversationKey, topic string, count int) ([]learning.ExamQuestion, int, error) {
+	cfg := o.ChatConfig(key)
+	messages := []openai.ChatCompletionMessage{
+		{Role: "system", Content: fmt.Sprintf("You write exams for students. Reply with a JSON object "+
+			"{\"questions\": [{\"question\": string, \"rubric\": string, \"points\": number}]} with exactly %d open questions. "+
+			"The rubric tells the grader what a full answer must contain and how to give partial points, points is between 5 and 20. "+
+			"Write in the language with the code %q.", count, cfg.BotLanguage)},
+		{Role: "user", Content: "Topic: " + topic},
+	}
+
+	response, err := o.Client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:          cfg.Model,
+		Messages:       messages,
+		Temperature:    0.7,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(response.Choices) == 0 {
+		return nil, response.Usage.TotalTokens, fmt.Errorf("no exam in the response")
+	}
+
+	var result struct {
+		Questions []learning.ExamQuestion `json:"questions"`
+	}
+	content := strings.TrimSpace(response.Choices[0].Message.Content)
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return nil, response.Usage.TotalTokens, fmt.Errorf("error unmarshalling exam: %v", err)
+	}
+
+	var questions []learning.ExamQuestion
+	for _, question := range result.Questions {
+		if question.Question != "" && question.Rubric != "" {
+			questions = append(questions, question)
+		}
+	}
+	if len(questions) == 0 {
+		return nil, response.Usage.TotalTokens, fmt.Errorf("no valid exam questions in the response")
+	}
+	if len(questions) > count {
+		questions = questions[:count]
+	}
+	return questions, response.Usage.TotalTokens, nil
+}
+
+// GradeExam просит модель оценить ответы экзамена по критериям вопросов. Вопросы без ответа получают 0 баллов.
+// Ответ запрашивается в JSON-режиме. Возвращает оценки, общий отзыв и потраченные токены
+func (o *OpenAIHelper) GradeExam(key ConversationKey, questions []learning.ExamQuestion, answers []string) ([]learning.GradedAnswer, string, int, error) {
+	cfg := o.ChatConfig(key)
+
+	var sb strings.Builder
+	for i, question := range questions {
+		answer := "(no answer)"
+		if i < len(answers) && strings.TrimSpace(answers[i]) != "" {
+			answer = answers[i]
+		}
+		fmt.Fprintf(&sb, "Question %d (max %g points): %s\nRubric: %s\nAnswer: %s\n\n", i+1, question.MaxPoints(), question.Question, question.Rubric, answer)
+	}
+
+	messages := []openai.ChatCompletionMessage{
+		{Role: "system", Content: fmt.Sprintf("You are a strict but fair examiner. Grade every answer against its rubric only, "+
+			"an answer that is missing gets 0 points. Reply with a JSON object {\"grades\": [{\"score\": number, \"feedback\": string}], \"summary\": string} "+
+			"with one grade per question in the same order, where score is between 0 and the max points of the question, feedback briefly "+
+			"explains the score and summary gives the student overall advice. Write in the language with the code %q.", cfg.BotLanguage)},
+		{Role: "user", Content: sb.String()},
+	}
+
+	response, err := o.Client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:          cfg.Model,
+		Messages:       messages,
+		Temperature:    0,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if len(response.Choices) == 0 {
+		return nil, "", response.Usage.TotalTokens, fmt.Errorf("no grades in the response")
+	}
+
+	var result struct {
+		Grades []struct {
+			Score    float64 `json:"score"`
+			Feedback string  `json:"feedback"`
+		} `json:"grades"`
+		Summary string `json:"summary"`
+	}
+	content := strings.TrimSpace(response.Choices[0].Message.Content)
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return nil, "", response.Usage.TotalTokens, fmt.Errorf("error unmarshalling exam grades: %v", err)
+	}
+	if len(result.Grades) != len(questions) {
+		return nil, "", response.Usage.TotalTokens, fmt.Errorf("expected %d exam grades, got %d", len(questions), len(result.Grades))
+	}
+
+	graded := make([]learning.GradedAnswer, len(questions))
+	for i, question := range questions {
+		graded[i] = learning.GradedAnswer{
+			Question: question.Question,
+			Points:   question.MaxPoints(),
+			Score:    math.Max(0, math.Min(result.Grades[i].Score, question.MaxPoints())),
+			Feedback: result.Grades[i].Feedback,
+		}
+		if i < len(answers) {
+			graded[i].Answer = answers[i]
+		}
+		// модель не должна давать баллы за пропущенный вопрос
+		if strings.TrimSpace(graded[i].Answer) == "" {
+			graded[i].Score = 0
+		}
+	}
+	return graded, result.Summary, response.Usage.TotalTokens, nil
+}
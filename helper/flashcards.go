@@ -0,0 +1,65 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"tutor/learning"
+)
+
+// maxFlashcards - сколько карточек модель может извлечь за раз
+const maxFlashcards = 15
+
+// ExtractFlashcards просит модель выписать из диалога термины с определениями, которые стоит запомнить ученику.
+// Ответ запрашивается в JSON-режиме. Возвращает карточки без состояния повторения и потраченные токены
+func (o *OpenAIHelper) ExtractFlashcards(key ConversationKey, conversation string) ([]learning.Card, int, error) {
+	cfg := o.ChatConfig(key)
+	messages := []openai.ChatCompletionMessage{
+		{Role: "system", Content: fmt.Sprintf("You make flashcards for a student from a tutoring session. "+
+			"Pick up to %d terms, facts or words the student should remember and reply with a JSON object "+
+			"{\"cards\": [{\"front\": string, \"back\": string}]}, where front is a term or question and back a short definition or answer. "+
+			"Reply with an empty list if there is nothing worth remembering. Write in the language of the conversation.", maxFlashcards)},
+		{Role: "user", Content: conversation},
+	}
+
+	response, err := o.Client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:          cfg.Model,
+		Messages:       messages,
+		Temperature:    0.3,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(response.Choices) == 0 {
+		return nil, response.Usage.TotalTokens, fmt.Errorf("no flashcards in the response")
+	}
+
+	var result struct {
+		Cards []learning.Card `json:"cards"`
+	}
+	content := strings.TrimSpace(response.Choices[0].Message.Content)
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return nil, response.Usage.TotalTokens, fmt.Errorf("error unmarshalling flashcards: %v", err)
+	}
+	if len(result.Cards) > maxFlashcards {
+		result.Cards = result.Cards[:maxFlashcards]
+	}
+	return result.Cards, response.Usage.TotalTokens, nil
+}
+
+// FormatConversation превращает сообщения диалога без системного промпта в текст для запросов к модели
+func FormatConversation(messages []openai.ChatCompletionMessage) string {
+	var lines []string
+	for _, message := range messages {
+		if message.Role == "system" {
+			continue
+		}
+		lines = append(lines, message.Role+": "+message.Content)
+	}
+	return strings.Join(lines, "\n\n")
+}
@@ -0,0 +1,152 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// MaxHintLevel - сколько подсказок дается перед решением. Решение дается только по явной просьбе ученика,
+// получившего все подсказки
+const MaxHintLevel = 3
+
+// hintProblemLength - сколько символов сообщения описывают задачу, если классификатор не ответил
+const hintProblemLength = 100
+
+// HintState - задача, над которой ученик работает в режиме подсказок, и достигнутый уровень помощи.
+// Level от 1 до MaxHintLevel - номер подсказки, Solved - ученику показано решение
+type HintState struct {
+	Problem string
+	Level   int
+	Solved  bool
+	Started time.Time
+}
+
+// hintClassification - ответ классификатора на сообщение ученика
+type hintClassification struct {
+	Homework      bool   `json:"homework"`
+	SameProblem   bool   `json:"same_problem"`
+	WantsSolution bool   `json:"wants_solution"`
+	Problem       string `json:"problem"`
+}
+
+// applyHintPolicy решает, как отвечать на сообщение в режиме подсказок. Классификатор определяет, задача ли это
+// из домашнего задания и та ли это задача, что и раньше; каждый следующий вопрос по задаче поднимает уровень подсказки.
+// Возвращает токены, потраченные на классификацию. Если режим выключен, ничего не делает.
+// Если классификатор не сработал, ответ все равно ограничивается подсказкой, а ошибка возвращается для журнала
+func (o *OpenAIHelper) applyHintPolicy(key ConversationKey, query string) (int, error) {
+	cfg := o.ChatConfig(key)
+	if !cfg.HintMode {
+		delete(o.Hints, key)
+		return 0, nil
+	}
+
+	state := o.Hints[key]
+	class, tokensUsed, err := o.classifyHint(cfg.Model, state, query)
+	if err != nil {
+		o.keepHintLevel(key, query)
+		return tokensUsed, err
+	}
+
+	sameProblem := state != nil && class.SameProblem
+	switch {
+	case !class.Homework && !sameProblem:
+		delete(o.Hints, key)
+		return tokensUsed, nil
+	case !sameProblem:
+		state = &HintState{Problem: class.Problem, Started: time.Now()}
+		o.Hints[key] = state
+	}
+
+	// решение показывается только после всех подсказок, до этого просьба о нем дает следующую подсказку
+	if class.WantsSolution && state.Level >= MaxHintLevel {
+		state.Solved = true
+	} else if state.Level < MaxHintLevel {
+		state.Level++
+	}
+	log.Printf("Hint mode in conversation %s: problem %q, level %d, solved %t", key, state.Problem, state.Level, state.Solved)
+	if o.OnHint != nil {
+		o.OnHint(key, *state)
+	}
+	return tokensUsed, nil
+}
+
+// keepHintLevel оставляет подсказку, достигнутую по текущей задаче, когда сообщение не удалось классифицировать.
+// Без задачи или после показанного решения ответ ограничивается первой подсказкой к этому сообщению
+func (o *OpenAIHelper) keepHintLevel(key ConversationKey, query string) {
+	if state := o.Hints[key]; state != nil && !state.Solved {
+		return
+	}
+	problem, _, _ := strings.Cut(strings.TrimSpace(query), "\n")
+	if runes := []rune(problem); len(runes) > hintProblemLength {
+		problem = string(runes[:hintProblemLength-1]) + "…"
+	}
+	o.Hints[key] = &HintState{Problem: problem, Level: 1, Started: time.Now()}
+}
+
+// classifyHint спрашивает классификатор, задача ли это, та ли это задача, что и state, и просит ли ученик решение
+func (o *OpenAIHelper) classifyHint(model string, state *HintState, query string) (hintClassification, int, error) {
+	current := "none"
+	if state != nil {
+		current = state.Problem
+	}
+	messages := []openai.ChatCompletionMessage{
+		{Role: "system", Content: "You classify messages a student sends to a tutor. Reply with a JSON object " +
+			"{\"homework\": boolean, \"same_problem\": boolean, \"wants_solution\": boolean, \"problem\": string}. " +
+			"homework is true if the message is or continues a problem to solve, such as an exercise, a task or a test question, " +
+			"and false for general questions about a concept. same_problem is true if it is about the current problem. " +
+			"wants_solution is true only if the student explicitly asks for the full solution or answer. " +
+			"problem is a one-line summary of the problem the message is about."},
+		{Role: "user", Content: fmt.Sprintf("Current problem: %s\n\nMessage: %s", current, query)},
+	}
+
+	var class hintClassification
+	response, err := o.Client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:          model,
+		Messages:       messages,
+		Temperature:    0,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return class, 0, err
+	}
+	tokensUsed := response.Usage.TotalTokens
+	if len(response.Choices) == 0 {
+		return class, tokensUsed, fmt.Errorf("no classification in the response")
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(response.Choices[0].Message.Content)), &class); err != nil {
+		return class, tokensUsed, fmt.Errorf("error unmarshalling hint classification: %v", err)
+	}
+	return class, tokensUsed, nil
+}
+
+// hintInstructions возвращает указания модели для текущего уровня подсказки или пустую строку вне режима подсказок
+func (o *OpenAIHelper) hintInstructions(key ConversationKey) string {
+	state := o.Hints[key]
+	if state == nil || !o.ChatConfig(key).HintMode {
+		return ""
+	}
+	if state.Solved {
+		return "The student explicitly asked for the solution of the problem \"" + state.Problem + "\". " +
+			"Give the full worked solution and explain every step."
+	}
+
+	var hint string
+	switch state.Level {
+	case 1:
+		hint = "Give only a small nudge: point out which concept or first step matters, or ask a guiding question."
+	case 2:
+		hint = "Give a more specific hint: outline the method and help with the step the student is stuck on, " +
+			"but leave the remaining steps and the final answer to them."
+	default:
+		hint = "Give a strong hint: walk through most of the reasoning but still let the student do the last step, " +
+			"and tell them they can ask for the full solution if they are still stuck."
+	}
+	return fmt.Sprintf("Hint mode: the student is working on the problem \"%s\". Never give the final answer or a complete solution. "+
+		"This is hint %d of %d. %s Check the student's own attempts and ask them to try.", state.Problem, state.Level, MaxHintLevel, hint)
+}
@@ -0,0 +1,91 @@
+package helper
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	conf "tutor/config"
+)
+
+// newHintHelper returns a helper in hint mode whose classifier answers with the next of replies,
+// an empty reply is answered with a server error.
+func newHintHelper(t *testing.T, replies ...string) *OpenAIHelper {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(replies) == 0 {
+			t.Error("unexpected classifier request")
+			replies = []string{""}
+		}
+		reply := replies[0]
+		replies = replies[1:]
+		if reply == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error": {"message": "classifier unavailable"}}`))
+			return
+		}
+		fmt.Fprintf(w, `{"choices": [{"message": {"role": "assistant", "content": %q}}], "usage": {"total_tokens": 10}}`, reply)
+	}))
+	t.Cleanup(server.Close)
+
+	clientConfig := openai.DefaultConfig("test-key")
+	clientConfig.BaseURL = server.URL + "/v1"
+	o := NewOpenAIHelper(conf.Config{HintMode: true, Model: "gpt-4o"})
+	o.Client = openai.NewClientWithConfig(clientConfig)
+	return o
+}
+
+const (
+	newProblem     = `{"homework": true, "same_problem": false, "wants_solution": false, "problem": "2x = 4"}`
+	sameProblem    = `{"homework": true, "same_problem": true, "wants_solution": false, "problem": "2x = 4"}`
+	solutionPlease = `{"homework": true, "same_problem": true, "wants_solution": true, "problem": "2x = 4"}`
+)
+
+func TestApplyHintPolicySolutionOnlyAfterAllHints(t *testing.T) {
+	key := ChatConversation(1)
+	o := newHintHelper(t, newProblem, solutionPlease, sameProblem, solutionPlease)
+
+	wantLevels := []struct {
+		level  int
+		solved bool
+	}{{1, false}, {2, false}, {3, false}, {3, true}}
+	for i, want := range wantLevels {
+		if _, err := o.applyHintPolicy(key, "solve 2x = 4"); err != nil {
+			t.Fatalf("message %d: %v", i+1, err)
+		}
+		state := o.Hints[key]
+		if state == nil || state.Level != want.level || state.Solved != want.solved {
+			t.Fatalf("message %d: state = %+v, want level %d, solved %t", i+1, state, want.level, want.solved)
+		}
+	}
+}
+
+func TestApplyHintPolicyClassifierError(t *testing.T) {
+	key := ChatConversation(1)
+
+	t.Run("keeps the level", func(t *testing.T) {
+		o := newHintHelper(t, newProblem, sameProblem, "")
+		for i := 0; i < 3; i++ {
+			o.applyHintPolicy(key, "solve 2x = 4")
+		}
+		if state := o.Hints[key]; state == nil || state.Level != 2 || state.Solved {
+			t.Errorf("state = %+v, want level 2 of the previous problem", state)
+		}
+	})
+
+	t.Run("defaults to the first hint", func(t *testing.T) {
+		o := newHintHelper(t, "")
+		if _, err := o.applyHintPolicy(key, "solve 3x = 9\nshow all steps"); err == nil {
+			t.Error("expected the classifier error")
+		}
+		state := o.Hints[key]
+		if state == nil || state.Level != 1 || state.Solved || state.Problem != "solve 3x = 9" {
+			t.Errorf("state = %+v, want the first hint for the message", state)
+		}
+		if o.hintInstructions(key) == "" {
+			t.Error("the answer is not limited to a hint")
+		}
+	})
+}
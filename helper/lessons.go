@@ -0,0 +1,51 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"tutor/learning"
+)
+
+// CheckpointResult - оценка ответа на контрольный вопрос урока
+type CheckpointResult struct {
+	Passed   bool   `json:"passed"`
+	Feedback string `json:"feedback"`
+}
+
+// EvaluateCheckpoint просит модель оценить ответ ученика на контрольный вопрос по критериям из плана урока.
+// Ответ запрашивается в JSON-режиме. Возвращает оценку и потраченные токены
+func (o *OpenAIHelper) EvaluateCheckpoint(key ConversationKey, checkpoint learning.Checkpoint, answer string) (CheckpointResult, int, error) {
+	cfg := o.ChatConfig(key)
+	messages := []openai.ChatCompletionMessage{
+		{Role: "system", Content: fmt.Sprintf("You grade a student's answer to a checkpoint question of a lesson. "+
+			"Decide if the answer meets the rubric and reply with a JSON object {\"passed\": boolean, \"feedback\": string}. "+
+			"The feedback speaks to the student: say what is right, and if the answer fails, give a hint without revealing the full answer. "+
+			"Write the feedback in the language with the code %q.", cfg.BotLanguage)},
+		{Role: "user", Content: fmt.Sprintf("Question: %s\n\nRubric: %s\n\nStudent's answer: %s", checkpoint.Question, checkpoint.Rubric, answer)},
+	}
+
+	response, err := o.Client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:          cfg.Model,
+		Messages:       messages,
+		Temperature:    0.2,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return CheckpointResult{}, 0, err
+	}
+	if len(response.Choices) == 0 {
+		return CheckpointResult{}, response.Usage.TotalTokens, fmt.Errorf("no evaluation in the response")
+	}
+
+	var result CheckpointResult
+	content := strings.TrimSpace(response.Choices[0].Message.Content)
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return CheckpointResult{}, response.Usage.TotalTokens, fmt.Errorf("error unmarshalling checkpoint evaluation: %v", err)
+	}
+	return result, response.Usage.TotalTokens, nil
+}
@@ -3,13 +3,15 @@ package helper
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/pkoukk/tiktoken-go"
-	"io/ioutil"
+	"io"
 	"log"
-	"net/http"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/pkoukk/tiktoken-go"
@@ -26,11 +28,14 @@ var (
 	GPT_ALL_MODELS   = append(GPT_3_MODELS, append(GPT_3_16K_MODELS, append(GPT_4_MODELS, GPT_4_32K_MODELS...)...)...)
 )
 
-var translations map[string]map[string]string
+var (
+	translations     map[string]map[string]string
+	translationsOnce sync.Once
+)
 
-func init() {
-	parentDirPath := ".."
-	translationsFilePath := parentDirPath + "/translations.json"
+// loadTranslations читает translations.json из рабочего каталога при первом обращении к переводам
+func loadTranslations() {
+	translationsFilePath := "translations.json"
 	data, err := os.ReadFile(translationsFilePath)
 	if err != nil {
 		log.Fatalf("Error reading translations file: %v", err)
@@ -41,7 +46,20 @@ func init() {
 	}
 }
 
-func localizedText(key, botLanguage string) string {
+// Languages возвращает языки, для которых есть переводы
+func Languages() []string {
+	translationsOnce.Do(loadTranslations)
+	languages := make([]string, 0, len(translations))
+	for language := range translations {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// LocalizedText возвращает перевод ключа на язык бота, с откатом на английский
+func LocalizedText(key, botLanguage string) string {
+	translationsOnce.Do(loadTranslations)
 	if val, ok := translations[botLanguage][key]; ok {
 		return val
 	}
@@ -53,21 +71,21 @@ func localizedText(key, botLanguage string) string {
 	return key
 }
 
-func (o *OpenAIHelper) MaxModelTokens() int {
+func MaxModelTokens(model string) int {
 	base := 4096
-	if contains(GPT_3_MODELS, o.Config.Model) {
+	if contains(GPT_3_MODELS, model) {
 		return base
-	} else if contains(GPT_3_16K_MODELS, o.Config.Model) {
+	} else if contains(GPT_3_16K_MODELS, model) {
 		return base * 4
-	} else if contains(GPT_4_MODELS, o.Config.Model) {
+	} else if contains(GPT_4_MODELS, model) {
 		return base * 2
-	} else if contains(GPT_4_32K_MODELS, o.Config.Model) {
+	} else if contains(GPT_4_32K_MODELS, model) {
 		return base * 8
 	}
 	return base
 }
 
-func (o *OpenAIHelper) Summarise(conversation []openai.ChatCompletionMessage) (string, error) {
+func (o *OpenAIHelper) Summarise(model string, conversation []openai.ChatCompletionMessage) (string, error) {
 	// Преобразование массива сообщений в строку
 	conversationContent, err := json.Marshal(conversation)
 	if err != nil {
@@ -80,7 +98,7 @@ func (o *OpenAIHelper) Summarise(conversation []openai.ChatCompletionMessage) (s
 	}
 
 	req := openai.ChatCompletionRequest{
-		Model:       o.Config.Model,
+		Model:       model,
 		Messages:    messages,
 		Temperature: 0.4,
 	}
@@ -107,8 +125,18 @@ func contains(s []string, str string) bool {
 type OpenAIHelper struct {
 	Client        *openai.Client
 	Config        conf.Config
-	Conversations map[int][]openai.ChatCompletionMessage
-	LastUpdated   map[int]time.Time
+	Conversations map[ConversationKey][]openai.ChatCompletionMessage
+	LastUpdated   map[ConversationKey]time.Time
+	Billing       BillingSource
+	// OnSummarise вызывается с сообщениями диалога перед тем, как они будут заменены кратким содержанием
+	OnSummarise func(key ConversationKey, messages []openai.ChatCompletionMessage)
+	// SystemContext возвращает дополнительные инструкции для диалога, например шаг урока.
+	// Они добавляются к запросу вторым системным сообщением и не сохраняются в истории
+	SystemContext func(key ConversationKey) string
+	// Hints - задачи диалогов в режиме подсказок
+	Hints map[ConversationKey]*HintState
+	// OnHint вызывается, когда в режиме подсказок ученик получает очередную подсказку или решение
+	OnHint func(key ConversationKey, state HintState)
 }
 
 func NewOpenAIHelper(config conf.Config) *OpenAIHelper {
@@ -116,43 +144,62 @@ func NewOpenAIHelper(config conf.Config) *OpenAIHelper {
 	return &OpenAIHelper{
 		Client:        client,
 		Config:        config,
-		Conversations: make(map[int][]openai.ChatCompletionMessage),
-		LastUpdated:   make(map[int]time.Time),
+		Conversations: make(map[ConversationKey][]openai.ChatCompletionMessage),
+		LastUpdated:   make(map[ConversationKey]time.Time),
+		Hints:         make(map[ConversationKey]*HintState),
+		Billing:       NewBillingSource(config),
 	}
 }
 
-func (o *OpenAIHelper) ResetChatHistory(chatID int, content string) {
+// ChatConfig возвращает конфигурацию диалога: глобальную с настройками его чата
+func (o *OpenAIHelper) ChatConfig(key ConversationKey) conf.Config {
+	return o.Config.ForChat(key.ChatID)
+}
+
+func (o *OpenAIHelper) ResetChatHistory(key ConversationKey, content string) {
 	if content == "" {
-		content = o.Config.AssistantPrompt
+		content = o.ChatConfig(key).AssistantPrompt
 	}
-	o.Conversations[chatID] = []openai.ChatCompletionMessage{{Role: "system", Content: content}}
+	o.Conversations[key] = []openai.ChatCompletionMessage{{Role: "system", Content: content}}
+	delete(o.Hints, key)
 }
 
-func (o *OpenAIHelper) MaxAgeReached(chatID int) bool {
-	lastUpdated, ok := o.LastUpdated[chatID]
+// ResetChat удаляет все диалоги чата, включая темы форума и контексты участников.
+// Следующий запрос начнет диалог с актуальным системным промптом
+func (o *OpenAIHelper) ResetChat(chatID int64) {
+	for key := range o.Conversations {
+		if key.ChatID == chatID {
+			delete(o.Conversations, key)
+			delete(o.LastUpdated, key)
+			delete(o.Hints, key)
+		}
+	}
+}
+
+func (o *OpenAIHelper) MaxAgeReached(key ConversationKey) bool {
+	lastUpdated, ok := o.LastUpdated[key]
 	if !ok {
 		return false
 	}
 	return lastUpdated.Before(time.Now().Add(-time.Duration(o.Config.MaxConversationAgeMinutes) * time.Minute))
 }
 
-func (o *OpenAIHelper) AddToHistory(chatID int, role, content string) {
-	o.Conversations[chatID] = append(o.Conversations[chatID], openai.ChatCompletionMessage{Role: role, Content: content})
+func (o *OpenAIHelper) AddToHistory(key ConversationKey, role, content string) {
+	o.Conversations[key] = append(o.Conversations[key], openai.ChatCompletionMessage{Role: role, Content: content})
 }
 
-func (o *OpenAIHelper) GetConversationStats(chatID int) (int, int, error) {
-	if _, ok := o.Conversations[chatID]; !ok {
-		o.ResetChatHistory(chatID, "")
+func (o *OpenAIHelper) GetConversationStats(key ConversationKey) (int, int, error) {
+	if _, ok := o.Conversations[key]; !ok {
+		o.ResetChatHistory(key, "")
 	}
-	tokenCount, err := o.CountTokens(o.Conversations[chatID])
+	tokenCount, err := o.CountTokens(o.ChatConfig(key).Model, o.Conversations[key])
 	if err != nil {
 		return 0, 0, err
 	}
-	return len(o.Conversations[chatID]), tokenCount, nil
+	return len(o.Conversations[key]), tokenCount, nil
 }
 
-func (o *OpenAIHelper) CountTokens(messages []openai.ChatCompletionMessage) (int, error) {
-	model := o.Config.Model
+func (o *OpenAIHelper) CountTokens(model string, messages []openai.ChatCompletionMessage) (int, error) {
 	var encoding *tiktoken.Tiktoken
 	var err error
 
@@ -197,72 +244,174 @@ func (o *OpenAIHelper) CountTokens(messages []openai.ChatCompletionMessage) (int
 	return numTokens, nil
 }
 
-func (o *OpenAIHelper) CommonGetChatResponse(chatID int, query string, stream bool) (*openai.ChatCompletionResponse, error) {
-	if _, ok := o.Conversations[chatID]; !ok || o.MaxAgeReached(chatID) {
-		o.ResetChatHistory(chatID, "")
+// prepareConversation добавляет запрос в историю чата, сбрасывая устаревшую и сокращая слишком длинную историю
+func (o *OpenAIHelper) prepareConversation(key ConversationKey, query string) error {
+	cfg := o.ChatConfig(key)
+	if _, ok := o.Conversations[key]; !ok || o.MaxAgeReached(key) {
+		o.ResetChatHistory(key, "")
 	}
 
-	o.LastUpdated[chatID] = time.Now()
-	o.AddToHistory(chatID, "user", query)
+	o.LastUpdated[key] = time.Now()
+	o.AddToHistory(key, "user", query)
 
-	tokenCount, err := o.CountTokens(o.Conversations[chatID])
+	tokenCount, err := o.CountTokens(cfg.Model, o.Conversations[key])
 	if err != nil {
-		return nil, fmt.Errorf("error counting tokens: %v", err)
+		return fmt.Errorf("error counting tokens: %v", err)
 	}
 
-	exceededMaxTokens := tokenCount+o.Config.MaxTokens > o.MaxModelTokens()
-	exceededMaxHistorySize := len(o.Conversations[chatID]) > o.Config.MaxHistorySize
+	exceededMaxTokens := tokenCount+o.Config.MaxTokens > MaxModelTokens(cfg.Model)
+	exceededMaxHistorySize := len(o.Conversations[key]) > o.Config.MaxHistorySize
 
 	if exceededMaxTokens || exceededMaxHistorySize {
-		log.Printf("Chat history for chat ID %d is too long. Summarising...", chatID)
-		summary, err := o.Summarise(o.Conversations[chatID][:len(o.Conversations[chatID])-1])
+		log.Printf("Chat history for conversation %s is too long. Summarising...", key)
+		if o.OnSummarise != nil {
+			o.OnSummarise(key, o.Conversations[key][:len(o.Conversations[key])-1])
+		}
+		summary, err := o.Summarise(cfg.Model, o.Conversations[key][:len(o.Conversations[key])-1])
 		if err != nil {
 			log.Printf("Error while summarising chat history: %v. Popping elements instead...", err)
-			o.Conversations[chatID] = o.Conversations[chatID][len(o.Conversations[chatID])-o.Config.MaxHistorySize:]
+			o.Conversations[key] = o.Conversations[key][len(o.Conversations[key])-o.Config.MaxHistorySize:]
 		} else {
-			o.ResetChatHistory(chatID, summary)
-			o.AddToHistory(chatID, "user", query)
+			o.ResetChatHistory(key, summary)
+			o.AddToHistory(key, "user", query)
 		}
 	}
 
-	req := openai.ChatCompletionRequest{
-		Model:            o.Config.Model,
-		Messages:         o.Conversations[chatID],
-		MaxTokens:        o.Config.MaxTokens,
-		N:                o.Config.NChoices,
-		Temperature:      float32(o.Config.Temperature),
-		PresencePenalty:  float32(o.Config.PresencePenalty),
-		FrequencyPenalty: float32(o.Config.FrequencyPenalty),
+	return nil
+}
+
+// chatCompletionRequest собирает запрос по истории диалога с параметрами из глобальной конфигурации и настроек чата
+func (o *OpenAIHelper) chatCompletionRequest(key ConversationKey, stream bool) openai.ChatCompletionRequest {
+	cfg := o.ChatConfig(key)
+	messages := o.Conversations[key]
+	var instructions []string
+	if o.SystemContext != nil {
+		instructions = append(instructions, o.SystemContext(key))
+	}
+	instructions = append(instructions, o.hintInstructions(key))
+	for i := len(instructions) - 1; i >= 0; i-- {
+		if instructions[i] != "" && len(messages) > 0 {
+			// системный промпт остается первым, инструкции идут перед сообщениями диалога
+			messages = append([]openai.ChatCompletionMessage{messages[0], {Role: "system", Content: instructions[i]}}, messages[1:]...)
+		}
+	}
+	return openai.ChatCompletionRequest{
+		Model:            cfg.Model,
+		Messages:         messages,
+		MaxTokens:        cfg.MaxTokens,
+		N:                cfg.NChoices,
+		Temperature:      float32(cfg.Temperature),
+		PresencePenalty:  float32(cfg.PresencePenalty),
+		FrequencyPenalty: float32(cfg.FrequencyPenalty),
 		Stream:           stream,
+		Tools:            o.tools(key),
 	}
+}
+
+// ChatRequest - запрос к модели, подготовленный по истории диалога. Запрос подготавливается и ответ записывается
+// в историю там же, где меняется остальное состояние бота, а отправить его можно из другой горутины:
+// SendChatRequest не обращается к истории диалогов
+type ChatRequest struct {
+	key        ConversationKey
+	request    openai.ChatCompletionRequest
+	hintTokens int
+	// notes - заметки о запусках кода, которые попадут в историю вместе с ответом
+	notes []string
+}
 
+// PrepareChatRequest добавляет запрос в историю диалога и собирает запрос к модели. В режиме подсказок ответ
+// ограничивается подсказкой текущего уровня, а токены классификатора добавляются к использованию ответа
+func (o *OpenAIHelper) PrepareChatRequest(key ConversationKey, query string) (*ChatRequest, error) {
+	hintTokens, err := o.applyHintPolicy(key, query)
+	if err != nil {
+		log.Printf("Hint mode classification failed in conversation %s: %v", key, err)
+	}
+	if err := o.prepareConversation(key, query); err != nil {
+		return nil, withUsage(err, hintTokens)
+	}
+	return &ChatRequest{key: key, request: o.chatCompletionRequest(key, false), hintTokens: hintTokens}, nil
+}
+
+// SendChatRequest отправляет подготовленный запрос. Если модель запускает код, запросы повторяются
+// с результатами запуска, и их токены тоже добавляются к использованию ответа. Токены, потраченные
+// до ошибки, возвращаются в UsageError
+func (o *OpenAIHelper) SendChatRequest(chat *ChatRequest) (*openai.ChatCompletionResponse, error) {
 	ctx := context.Background()
+	response, err := o.Client.CreateChatCompletion(ctx, chat.request)
+	if err != nil {
+		return nil, withUsage(err, chat.hintTokens)
+	}
+	if response, err = o.completeToolCalls(ctx, chat, response); err != nil {
+		return nil, withUsage(err, chat.hintTokens)
+	}
+	response.Usage.TotalTokens += chat.hintTokens
+	return &response, nil
+}
 
-	if stream {
-		stream, err := o.Client.CreateChatCompletionStream(ctx, req)
-		if err != nil {
-			return nil, err
-		}
-		defer stream.Close()
+// FinishChatResponse записывает ответ модели в историю диалога и возвращает его текст и потраченные токены
+func (o *OpenAIHelper) FinishChatResponse(chat *ChatRequest, response *openai.ChatCompletionResponse) (string, int, error) {
+	key := chat.key
+	for _, note := range chat.notes {
+		o.AddToHistory(key, "system", note)
+	}
+	botLanguage := o.ChatConfig(key).BotLanguage
+	if len(response.Choices) == 0 {
+		return "", response.Usage.TotalTokens, fmt.Errorf("⚠️ _%s._ ⚠️\n%s.",
+			LocalizedText("error", botLanguage),
+			LocalizedText("try_again", botLanguage))
+	}
 
-		for {
-			response, err := stream.Recv()
-			if err != nil {
-				return nil, err
-			}
-			log.Printf("Stream response: %v", response)
-			if response.Choices[0].FinishReason != "" {
-				break
+	answer := ""
+	if len(response.Choices) > 1 && o.Config.NChoices > 1 {
+		for index, choice := range response.Choices {
+			content := strings.TrimSpace(choice.Message.Content)
+			if index == 0 {
+				o.AddToHistory(key, "assistant", content)
 			}
+			answer += fmt.Sprintf("%d\u20e3\n%s\n\n", index+1, content)
 		}
-		return nil, nil
 	} else {
-		response, err := o.Client.CreateChatCompletion(ctx, req)
-		if err != nil {
-			return nil, err
-		}
-		return &response, nil
+		answer = strings.TrimSpace(response.Choices[0].Message.Content)
+		o.AddToHistory(key, "assistant", answer)
 	}
+
+	tokensUsed := response.Usage.TotalTokens
+	if o.Config.ShowUsage {
+		answer += fmt.Sprintf("\n\n---\n💰 %d %s", tokensUsed, LocalizedText("stats_tokens", botLanguage))
+	}
+
+	return answer, tokensUsed, nil
+}
+
+// CommonGetChatResponse запрашивает ответ модели на запрос, см. PrepareChatRequest и SendChatRequest.
+// Ответ в историю не записывается
+func (o *OpenAIHelper) CommonGetChatResponse(key ConversationKey, query string, stream bool) (*openai.ChatCompletionResponse, error) {
+	if stream {
+		return nil, fmt.Errorf("use GetChatResponseStream for streamed responses")
+	}
+	chat, err := o.PrepareChatRequest(key, query)
+	if err != nil {
+		return nil, err
+	}
+	response, err := o.SendChatRequest(chat)
+	for _, note := range chat.notes {
+		o.AddToHistory(key, "system", note)
+	}
+	return response, err
+}
+
+// GetChatResponse возвращает ответ модели, добавляя его в историю, и количество потраченных токенов.
+// При ошибке токены, потраченные до нее, возвращаются и в UsageError
+func (o *OpenAIHelper) GetChatResponse(key ConversationKey, query string) (string, int, error) {
+	chat, err := o.PrepareChatRequest(key, query)
+	if err != nil {
+		return "", 0, err
+	}
+	response, err := o.SendChatRequest(chat)
+	if err != nil {
+		return "", TokensUsedBy(err), err
+	}
+	return o.FinishChatResponse(chat, response)
 }
 
 func (o *OpenAIHelper) GenerateImage(prompt string) (string, string, error) {
@@ -279,36 +428,89 @@ func (o *OpenAIHelper) GenerateImage(prompt string) (string, string, error) {
 	if len(response.Data) == 0 {
 		log.Printf("No response from GPT: %v", response)
 		return "", "", fmt.Errorf("⚠️ _%s._ ⚠️\n%s.",
-			localizedText("error", botLanguage),
-			localizedText("try_again", botLanguage))
+			LocalizedText("error", botLanguage),
+			LocalizedText("try_again", botLanguage))
 	}
 
 	return response.Data[0].URL, o.Config.ImageSize, nil
 }
 
-func (o *OpenAIHelper) GetChatResponseStream(chatID int, query string) (<-chan string, <-chan error) {
-	responseChan := make(chan string)
-	errorChan := make(chan error)
+// StreamChunk - накопленный ответ модели при потоковой генерации. TokensUsed заполняется только в последнем куске
+type StreamChunk struct {
+	Content    string
+	TokensUsed int
+	Done       bool
+}
+
+// UsageError - ошибка запроса, на который уже потрачены токены, например оборванного потока.
+// Вызывающий списывает TokensUsed с бюджета так же, как токены успешного ответа
+type UsageError struct {
+	Err        error
+	TokensUsed int
+}
+
+func (e *UsageError) Error() string { return e.Err.Error() }
+
+func (e *UsageError) Unwrap() error { return e.Err }
+
+// withUsage добавляет к ошибке потраченные токены, если они есть. К токенам UsageError они прибавляются
+func withUsage(err error, tokensUsed int) error {
+	if tokensUsed <= 0 {
+		return err
+	}
+	if usageErr, ok := err.(*UsageError); ok {
+		return &UsageError{Err: usageErr.Err, TokensUsed: usageErr.TokensUsed + tokensUsed}
+	}
+	return &UsageError{Err: err, TokensUsed: tokensUsed}
+}
+
+// TokensUsedBy возвращает токены, потраченные запросом, который завершился ошибкой err
+func TokensUsedBy(err error) int {
+	var usageErr *UsageError
+	if errors.As(err, &usageErr) {
+		return usageErr.TokensUsed
+	}
+	return 0
+}
+
+// GetChatResponseStream отправляет в канал накопленный ответ по мере генерации, последним - ответ с Done.
+// Канал ошибок буферизован, поэтому горутина не блокируется, если ошибку читают после закрытия канала ответов.
+// Если поток оборвался, ошибка - UsageError с токенами запроса и полученной части ответа.
+// Вызывающий должен дочитать оба канала, иначе горутина не запишет ответ в историю
+func (o *OpenAIHelper) GetChatResponseStream(key ConversationKey, query string) (<-chan StreamChunk, <-chan error) {
+	responseChan := make(chan StreamChunk)
+	errorChan := make(chan error, 1)
 
 	go func() {
 		defer close(responseChan)
 		defer close(errorChan)
 
-		ctx := context.Background()
-		req := openai.ChatCompletionRequest{
-			Model:            o.Config.Model,
-			Messages:         o.Conversations[chatID],
-			MaxTokens:        o.Config.MaxTokens,
-			N:                o.Config.NChoices,
-			Temperature:      float32(o.Config.Temperature),
-			PresencePenalty:  float32(o.Config.PresencePenalty),
-			FrequencyPenalty: float32(o.Config.FrequencyPenalty),
-			Stream:           true,
+		// вызовы инструментов приходят в потоке по частям, поэтому при запуске кода ответ генерируется целиком
+		if o.ChatConfig(key).CodeExecution {
+			answer, tokensUsed, err := o.GetChatResponse(key, query)
+			if err != nil {
+				errorChan <- err
+				return
+			}
+			responseChan <- StreamChunk{Content: answer, TokensUsed: tokensUsed, Done: true}
+			return
 		}
 
+		hintTokens, err := o.applyHintPolicy(key, query)
+		if err != nil {
+			log.Printf("Hint mode classification failed in conversation %s: %v", key, err)
+		}
+		if err := o.prepareConversation(key, query); err != nil {
+			errorChan <- withUsage(err, hintTokens)
+			return
+		}
+
+		ctx := context.Background()
+		req := o.chatCompletionRequest(key, true)
+
 		stream, err := o.Client.CreateChatCompletionStream(ctx, req)
 		if err != nil {
-			errorChan <- err
+			errorChan <- withUsage(err, hintTokens)
 			return
 		}
 		defer stream.Close()
@@ -316,8 +518,17 @@ func (o *OpenAIHelper) GetChatResponseStream(chatID int, query string) (<-chan s
 		answer := ""
 		for {
 			response, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
 			if err != nil {
-				errorChan <- err
+				// запрос и уже полученная часть ответа оплачены, даже если поток оборвался
+				partial := append(req.Messages[:len(req.Messages):len(req.Messages)], openai.ChatCompletionMessage{Role: "assistant", Content: answer})
+				tokensUsed, countErr := o.CountTokens(req.Model, partial)
+				if countErr != nil {
+					log.Printf("Failed to count tokens of the interrupted stream in conversation %s: %v", key, countErr)
+				}
+				errorChan <- withUsage(err, tokensUsed+hintTokens)
 				return
 			}
 			if len(response.Choices) == 0 {
@@ -326,7 +537,7 @@ func (o *OpenAIHelper) GetChatResponseStream(chatID int, query string) (<-chan s
 			delta := response.Choices[0].Delta
 			if content := delta.Content; content != "" {
 				answer += content
-				responseChan <- answer
+				responseChan <- StreamChunk{Content: answer}
 			}
 			if response.Choices[0].FinishReason != "" {
 				break
@@ -334,59 +545,27 @@ func (o *OpenAIHelper) GetChatResponseStream(chatID int, query string) (<-chan s
 		}
 
 		answer = strings.TrimSpace(answer)
-		o.AddToHistory(chatID, "assistant", answer)
-		tokensUsed, err := o.CountTokens(o.Conversations[chatID])
+		o.AddToHistory(key, "assistant", answer)
+		tokensUsed, err := o.CountTokens(req.Model, o.Conversations[key])
 		if err != nil {
 			errorChan <- err
 			return
 		}
+		tokensUsed += hintTokens
 
 		if o.Config.ShowUsage {
-			responseChan <- fmt.Sprintf("%s\n\n---\n💰 %d %s", answer, tokensUsed, localizedText("stats_tokens", o.Config.BotLanguage))
-		} else {
-			responseChan <- answer
+			answer = fmt.Sprintf("%s\n\n---\n💰 %d %s", answer, tokensUsed, LocalizedText("stats_tokens", o.ChatConfig(key).BotLanguage))
 		}
+		responseChan <- StreamChunk{Content: answer, TokensUsed: tokensUsed, Done: true}
 	}()
 
 	return responseChan, errorChan
 }
 
+// GetBillingCurrentMonth возвращает расходы за текущий месяц по данным источника биллинга
 func (o *OpenAIHelper) GetBillingCurrentMonth() (float64, error) {
-	headers := map[string]string{
-		"Authorization": "Bearer " + o.Config.APIKey,
-	}
-	today := time.Now()
-	firstDay := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location())
-	lastDay := firstDay.AddDate(0, 1, -1)
-
-	params := fmt.Sprintf("?start_date=%s&end_date=%s", firstDay.Format("2006-01-02"), lastDay.Format("2006-01-02"))
-
-	req, err := http.NewRequest("GET", "https://api.openai.com/dashboard/billing/usage"+params, nil)
-	if err != nil {
-		return 0, err
+	if o.Billing == nil {
+		return 0, fmt.Errorf("billing source is not configured")
 	}
-	for key, value := range headers {
-		req.Header.Set(key, value)
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return 0, err
-	}
-
-	var billingData map[string]interface{}
-	err = json.Unmarshal(body, &billingData)
-	if err != nil {
-		return 0, err
-	}
-
-	usageMonth := billingData["total_usage"].(float64) / 100 // convert cent amount to dollars
-	return usageMonth, nil
+	return o.Billing.CurrentMonthUsage()
 }
@@ -0,0 +1,37 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// SummariseProgress просит модель составить для учителя отчет о занятиях ученика по его учебным событиям.
+// key - чат учителя, из него берутся модель и язык отчета. Возвращает отчет и потраченные токены
+func (o *OpenAIHelper) SummariseProgress(key ConversationKey, studentName string, days int, events string) (string, int, error) {
+	cfg := o.ChatConfig(key)
+	messages := []openai.ChatCompletionMessage{
+		{Role: "system", Content: fmt.Sprintf("You write short progress reports on a student for their teacher. "+
+			"You get the student's learning events for the last %d days: questions asked to the tutor, quiz results, "+
+			"flashcard reviews with a self-assessed grade from 1 to 5 and study sessions. Summarise the topics the student worked on, "+
+			"their strengths, what they struggle with and what the teacher could focus on next. "+
+			"Be concise, use a few bullet points and don't list the events one by one. Write in the language with the code %q.", days, cfg.BotLanguage)},
+		{Role: "user", Content: fmt.Sprintf("Student: %s\n\n%s", studentName, events)},
+	}
+
+	response, err := o.Client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:       cfg.Model,
+		Messages:    messages,
+		Temperature: 0.4,
+		MaxTokens:   cfg.MaxTokens,
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	if len(response.Choices) == 0 {
+		return "", response.Usage.TotalTokens, fmt.Errorf("no report in the response")
+	}
+	return strings.TrimSpace(response.Choices[0].Message.Content), response.Usage.TotalTokens, nil
+}
@@ -0,0 +1,99 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"tutor/learning"
+)
+
+// ErrEmptyConversation возвращается, если тест нужно составить по диалогу, а он пуст
+var ErrEmptyConversation = errors.New("the conversation is empty")
+
+// recentMessages - сколько последних сообщений диалога используется для теста без темы
+const recentMessages = 10
+
+// GenerateQuiz просит модель составить count вопросов с вариантами ответа по теме или, если тема пустая,
+// по последним сообщениям диалога. Ответ запрашивается в JSON-режиме. Возвращает вопросы и потраченные токены
+func (o *OpenAIHelper) GenerateQuiz(key ConversationKey, topic string, count int) ([]learning.Question, int, error) {
+	cfg := o.ChatConfig(key)
+
+	source := "Topic: " + topic
+	if topic == "" {
+		recent := o.RecentConversation(key, recentMessages)
+		if recent == "" {
+			return nil, 0, ErrEmptyConversation
+		}
+		source = "Write the questions about this conversation between a student and a tutor:\n\n" + recent
+	}
+
+	messages := []openai.ChatCompletionMessage{
+		{Role: "system", Content: fmt.Sprintf("You write multiple-choice quizzes for students. "+
+			"Reply with a JSON object {\"questions\": [{\"question\": string, \"options\": [string], \"answer\": number, \"explanation\": string}]} "+
+			"with exactly %d questions. Every question has 4 options, answer is the index of the correct option starting at 0 "+
+			"and explanation briefly says why it is correct. Write in the language with the code %q.", count, cfg.BotLanguage)},
+		{Role: "user", Content: source},
+	}
+
+	response, err := o.Client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:          cfg.Model,
+		Messages:       messages,
+		Temperature:    0.7,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(response.Choices) == 0 {
+		return nil, response.Usage.TotalTokens, fmt.Errorf("no quiz in the response")
+	}
+
+	questions, err := parseQuiz(response.Choices[0].Message.Content)
+	return questions, response.Usage.TotalTokens, err
+}
+
+// parseQuiz разбирает ответ модели и отбрасывает некорректные вопросы
+func parseQuiz(content string) ([]learning.Question, error) {
+	content = strings.TrimSpace(content)
+	content = strings.TrimPrefix(strings.TrimSuffix(content, "```"), "```json")
+
+	var quiz struct {
+		Questions []learning.Question `json:"questions"`
+	}
+	if err := json.Unmarshal([]byte(content), &quiz); err != nil {
+		return nil, fmt.Errorf("error unmarshalling quiz: %v", err)
+	}
+
+	var questions []learning.Question
+	for _, question := range quiz.Questions {
+		if err := question.Validate(); err != nil {
+			log.Printf("Skipping invalid quiz question: %v", err)
+			continue
+		}
+		questions = append(questions, question)
+	}
+	if len(questions) == 0 {
+		return nil, fmt.Errorf("the quiz has no valid questions")
+	}
+	return questions, nil
+}
+
+// RecentConversation возвращает последние limit сообщений диалога без системного промпта в виде текста
+func (o *OpenAIHelper) RecentConversation(key ConversationKey, limit int) string {
+	var messages []openai.ChatCompletionMessage
+	for _, message := range o.Conversations[key] {
+		if message.Role != "system" {
+			messages = append(messages, message)
+		}
+	}
+	if len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	return FormatConversation(messages)
+}
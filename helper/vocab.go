@@ -0,0 +1,56 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"tutor/learning"
+)
+
+// maxVocabWords - сколько слов модель может выписать из одного обмена сообщениями
+const maxVocabWords = 5
+
+// ExtractVocabulary просит модель выписать из последнего обмена сообщениями слова изучаемого языка,
+// которые ученик употребил неправильно или о которых спросил. Перевод и пояснение пишутся на языке чата.
+// Ответ запрашивается в JSON-режиме. Возвращает слова и потраченные токены
+func (o *OpenAIHelper) ExtractVocabulary(key ConversationKey, exchange string) ([]learning.Word, int, error) {
+	cfg := o.ChatConfig(key)
+	messages := []openai.ChatCompletionMessage{
+		{Role: "system", Content: fmt.Sprintf("You maintain a vocabulary list for a student practising a foreign language with a tutor. "+
+			"From the exchange below pick up to %d words or short phrases of the language being practised that the student used incorrectly "+
+			"or explicitly asked about. Reply with a JSON object {\"words\": [{\"word\": string, \"translation\": string, \"example\": string, \"note\": string}]}, "+
+			"where word is the correct dictionary form, translation is its translation into the language with the code %q, example is a short "+
+			"sentence using the word correctly and note briefly says what the student got wrong or asked, in the language with the code %q. "+
+			"Reply with an empty list if the exchange is not language practice or there are no such words.", maxVocabWords, cfg.BotLanguage, cfg.BotLanguage)},
+		{Role: "user", Content: exchange},
+	}
+
+	response, err := o.Client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+		Model:          cfg.Model,
+		Messages:       messages,
+		Temperature:    0,
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(response.Choices) == 0 {
+		return nil, response.Usage.TotalTokens, fmt.Errorf("no vocabulary in the response")
+	}
+
+	var result struct {
+		Words []learning.Word `json:"words"`
+	}
+	content := strings.TrimSpace(response.Choices[0].Message.Content)
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return nil, response.Usage.TotalTokens, fmt.Errorf("error unmarshalling vocabulary: %v", err)
+	}
+	if len(result.Words) > maxVocabWords {
+		result.Words = result.Words[:maxVocabWords]
+	}
+	return result.Words, response.Usage.TotalTokens, nil
+}
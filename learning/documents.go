@@ -0,0 +1,240 @@
+package learning
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Document - учебный материал, загруженный в чат
+type Document struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Pages  int    `json:"pages"`
+	Chunks int    `json:"chunks"`
+	// Model - модель эмбеддингов фрагментов. При смене модели документ нужно загрузить заново
+	Model      string `json:"model"`
+	UploadedBy int    `json:"uploaded_by"`
+	Uploaded   string `json:"uploaded"`
+}
+
+// Chunk - фрагмент документа с эмбеддингом
+type Chunk struct {
+	Document  int       `json:"document"`
+	Page      int       `json:"page"`
+	Text      string    `json:"text"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// DocumentMatch - фрагмент документа, найденный по запросу, и его близость к запросу
+type DocumentMatch struct {
+	Document Document
+	Chunk    Chunk
+	Score    float64
+}
+
+// Citation возвращает ссылку на документ и страницу фрагмента
+func (m DocumentMatch) Citation() string {
+	return fmt.Sprintf("%s, p. %d", m.Document.Name, m.Chunk.Page)
+}
+
+// SupportedDocument сообщает, можно ли извлечь текст из файла с таким именем
+func SupportedDocument(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".pdf", ".txt", ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+// ExtractPages возвращает текст страниц документа. Текстовые файлы и Markdown делятся на страницы
+// символом перевода страницы, без него весь файл считается первой страницей
+func ExtractPages(name string, data []byte) ([]string, error) {
+	var pages []string
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".pdf":
+		var err error
+		if pages, err = ExtractPDFText(data); err != nil {
+			return nil, err
+		}
+	case ".txt", ".md", ".markdown":
+		if !utf8.Valid(data) {
+			return nil, fmt.Errorf("text file is not in UTF-8")
+		}
+		pages = strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\f")
+	default:
+		return nil, fmt.Errorf("unsupported document type %q", filepath.Ext(name))
+	}
+
+	for _, page := range pages {
+		if strings.TrimSpace(page) != "" {
+			return pages, nil
+		}
+	}
+	return nil, fmt.Errorf("no text found in the document")
+}
+
+// documentIndex - файл документов одного чата с векторным индексом их фрагментов
+type documentIndex struct {
+	ChatID    int64      `json:"chat_id"`
+	NextID    int        `json:"next_id"`
+	Documents []Document `json:"documents"`
+	Chunks    []Chunk    `json:"chunks"`
+}
+
+// DocumentStore хранит документы чатов и эмбеддинги их фрагментов в каталоге documents каталога логов, по файлу на чат
+type DocumentStore struct {
+	mu      sync.Mutex
+	dir     string
+	indexes map[int64]*documentIndex
+}
+
+// NewDocumentStore создает хранилище документов. Индексы читаются с диска при первом обращении
+func NewDocumentStore(logsDir string) *DocumentStore {
+	return &DocumentStore{dir: filepath.Join(logsDir, "documents"), indexes: make(map[int64]*documentIndex)}
+}
+
+// Add добавляет документ чата с его фрагментами. Документ с тем же именем заменяется новой версией
+func (s *DocumentStore) Add(chatID int64, doc Document, chunks []Chunk) (Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, err := s.indexLocked(chatID)
+	if err != nil {
+		return Document{}, err
+	}
+
+	for _, existing := range index.Documents {
+		if existing.Name == doc.Name {
+			index.removeDocument(existing.ID)
+			break
+		}
+	}
+
+	index.NextID++
+	doc.ID = index.NextID
+	doc.Chunks = len(chunks)
+	if doc.Uploaded == "" {
+		doc.Uploaded = time.Now().Format(dateLayout)
+	}
+	index.Documents = append(index.Documents, doc)
+	for _, chunk := range chunks {
+		chunk.Document = doc.ID
+		index.Chunks = append(index.Chunks, chunk)
+	}
+	return doc, s.saveLocked(index)
+}
+
+// Remove удаляет документ чата по ID. Возвращает false, если такого документа нет
+func (s *DocumentStore) Remove(chatID int64, id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, err := s.indexLocked(chatID)
+	if err != nil {
+		return false, err
+	}
+	if !index.removeDocument(id) {
+		return false, nil
+	}
+	return true, s.saveLocked(index)
+}
+
+// Documents возвращает документы чата в порядке загрузки
+func (s *DocumentStore) Documents(chatID int64) ([]Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, err := s.indexLocked(chatID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]Document(nil), index.Documents...), nil
+}
+
+// Search возвращает до limit фрагментов документов чата, ближайших к эмбеддингу запроса по косинусной мере,
+// начиная с самого близкого. Фрагменты с близостью меньше minScore и эмбеддингами другой модели пропускаются
+func (s *DocumentStore) Search(chatID int64, model string, query []float32, limit int, minScore float64) ([]DocumentMatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, err := s.indexLocked(chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	documents := make(map[int]Document)
+	for _, doc := range index.Documents {
+		if doc.Model == model {
+			documents[doc.ID] = doc
+		}
+	}
+
+	var matches []DocumentMatch
+	for _, chunk := range index.Chunks {
+		doc, ok := documents[chunk.Document]
+		if !ok || len(chunk.Embedding) != len(query) {
+			continue
+		}
+		if score := cosineSimilarity(query, chunk.Embedding); score >= minScore {
+			matches = append(matches, DocumentMatch{Document: doc, Chunk: chunk, Score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+func (index *documentIndex) removeDocument(id int) bool {
+	for i, doc := range index.Documents {
+		if doc.ID != id {
+			continue
+		}
+		index.Documents = append(index.Documents[:i], index.Documents[i+1:]...)
+		chunks := index.Chunks[:0]
+		for _, chunk := range index.Chunks {
+			if chunk.Document != id {
+				chunks = append(chunks, chunk)
+			}
+		}
+		index.Chunks = chunks
+		return true
+	}
+	return false
+}
+
+func (s *DocumentStore) indexLocked(chatID int64) (*documentIndex, error) {
+	if index, ok := s.indexes[chatID]; ok {
+		return index, nil
+	}
+	index := &documentIndex{ChatID: chatID}
+	if err := loadJSON(s.path(chatID), index); err != nil {
+		return nil, err
+	}
+	s.indexes[chatID] = index
+	return index, nil
+}
+
+func (s *DocumentStore) saveLocked(index *documentIndex) error {
+	return saveJSON(s.path(index.ChatID), index)
+}
+
+func (s *DocumentStore) path(chatID int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%d.json", chatID))
+}
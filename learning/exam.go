@@ -0,0 +1,278 @@
+package learning
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultExamPoints - максимальный балл вопроса экзамена, если он не указан
+const DefaultExamPoints = 10
+
+// ExamQuestion - открытый вопрос экзамена. Ответ оценивается моделью по критериям Rubric
+type ExamQuestion struct {
+	Question string  `json:"question"`
+	Rubric   string  `json:"rubric"`
+	Points   float64 `json:"points,omitempty"`
+}
+
+// MaxPoints возвращает максимальный балл вопроса
+func (q ExamQuestion) MaxPoints() float64 {
+	if q.Points > 0 {
+		return q.Points
+	}
+	return DefaultExamPoints
+}
+
+// ExamBank - банк вопросов экзамена
+type ExamBank struct {
+	ID               string         `json:"id"`
+	Title            string         `json:"title"`
+	TimeLimitMinutes int            `json:"time_limit_minutes,omitempty"`
+	Questions        []ExamQuestion `json:"questions"`
+}
+
+// Pick возвращает count случайных вопросов банка в случайном порядке
+func (b ExamBank) Pick(count int) []ExamQuestion {
+	if count <= 0 || count > len(b.Questions) {
+		count = len(b.Questions)
+	}
+	questions := make([]ExamQuestion, 0, count)
+	for _, i := range rand.Perm(len(b.Questions))[:count] {
+		questions = append(questions, b.Questions[i])
+	}
+	return questions
+}
+
+// Validate проверяет, что у банка есть ID и вопросы с критериями оценки
+func (b ExamBank) Validate() error {
+	if b.ID == "" || b.Title == "" {
+		return fmt.Errorf("exam bank must have an id and a title")
+	}
+	if len(b.Questions) == 0 {
+		return fmt.Errorf("exam bank %q has no questions", b.ID)
+	}
+	for _, question := range b.Questions {
+		if question.Question == "" || question.Rubric == "" {
+			return fmt.Errorf("every question of exam bank %q must have a question and a rubric", b.ID)
+		}
+	}
+	return nil
+}
+
+// ExamLibrary - банки вопросов из файла EXAMS_FILE
+type ExamLibrary struct {
+	banks map[string]ExamBank
+}
+
+// LoadExams читает банки вопросов из JSON-файла со списком банков. Отсутствующий файл дает пустую библиотеку
+func LoadExams(path string) (*ExamLibrary, error) {
+	l := &ExamLibrary{banks: make(map[string]ExamBank)}
+	if path == "" {
+		return l, nil
+	}
+
+	var banks []ExamBank
+	if err := loadJSON(path, &banks); err != nil {
+		return l, err
+	}
+	for _, bank := range banks {
+		if err := bank.Validate(); err != nil {
+			return l, fmt.Errorf("%s: %v", path, err)
+		}
+		l.banks[bank.ID] = bank
+	}
+	return l, nil
+}
+
+// Lookup возвращает банк по ID
+func (l *ExamLibrary) Lookup(id string) (ExamBank, bool) {
+	bank, ok := l.banks[id]
+	return bank, ok
+}
+
+// List возвращает банки, отсортированные по ID
+func (l *ExamLibrary) List() []ExamBank {
+	banks := make([]ExamBank, 0, len(l.banks))
+	for _, bank := range l.banks {
+		banks = append(banks, bank)
+	}
+	sort.Slice(banks, func(i, j int) bool { return banks[i].ID < banks[j].ID })
+	return banks
+}
+
+// ExamSession - идущий экзамен ученика. Ответы принимаются по порядку до Deadline
+type ExamSession struct {
+	UserID    int            `json:"user_id"`
+	ChatID    int64          `json:"chat_id"`
+	ThreadID  int            `json:"thread_id,omitempty"` // тема форума, в которой идет экзамен, 0 вне тем
+	Title     string         `json:"title"`
+	Questions []ExamQuestion `json:"questions"`
+	Answers   []string       `json:"answers"`
+	Started   time.Time      `json:"started"`
+	Deadline  time.Time      `json:"deadline"`
+}
+
+// NewExamSession начинает экзамен с ограничением по времени
+func NewExamSession(userID int, chatID int64, title string, questions []ExamQuestion, limit time.Duration, now time.Time) *ExamSession {
+	return &ExamSession{
+		UserID:    userID,
+		ChatID:    chatID,
+		Title:     title,
+		Questions: questions,
+		Started:   now,
+		Deadline:  now.Add(limit),
+	}
+}
+
+// Current возвращает номер вопроса, на который ожидается ответ
+func (s *ExamSession) Current() int {
+	return len(s.Answers)
+}
+
+// Done сообщает, что на все вопросы даны ответы
+func (s *ExamSession) Done() bool {
+	return len(s.Answers) >= len(s.Questions)
+}
+
+// Expired сообщает, что время экзамена вышло
+func (s *ExamSession) Expired(now time.Time) bool {
+	return now.After(s.Deadline)
+}
+
+// Answer записывает ответ на текущий вопрос
+func (s *ExamSession) Answer(text string) {
+	if !s.Done() {
+		s.Answers = append(s.Answers, text)
+	}
+}
+
+// GradedAnswer - оценка ответа на вопрос экзамена
+type GradedAnswer struct {
+	Question string  `json:"question"`
+	Answer   string  `json:"answer"`
+	Score    float64 `json:"score"`
+	Points   float64 `json:"points"`
+	Feedback string  `json:"feedback"`
+}
+
+// ExamResult - результат экзамена
+type ExamResult struct {
+	Title    string         `json:"title"`
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished"`
+	TimedOut bool           `json:"timed_out,omitempty"`
+	Answers  []GradedAnswer `json:"answers"`
+	Score    float64        `json:"score"`
+	Points   float64        `json:"points"`
+	Summary  string         `json:"summary,omitempty"`
+}
+
+// NewExamResult подсчитывает итог экзамена по оценкам ответов
+func NewExamResult(session *ExamSession, answers []GradedAnswer, summary string, now time.Time) ExamResult {
+	result := ExamResult{
+		Title:    session.Title,
+		Started:  session.Started,
+		Finished: now,
+		TimedOut: !session.Done(),
+		Answers:  answers,
+		Summary:  summary,
+	}
+	for _, answer := range answers {
+		result.Score += answer.Score
+		result.Points += answer.Points
+	}
+	return result
+}
+
+// ExamResults хранит результаты экзаменов в каталоге exams каталога логов, по файлу JSON lines на ученика,
+// и идущие экзамены в файле active.json
+type ExamResults struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewExamResults создает хранилище результатов экзаменов
+func NewExamResults(logsDir string) *ExamResults {
+	return &ExamResults{dir: filepath.Join(logsDir, "exams")}
+}
+
+// Record сохраняет результат экзамена ученика
+func (r *ExamResults) Record(userID int, result ExamResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := os.MkdirAll(r.dir, os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.path(userID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// List возвращает результаты экзаменов ученика от старых к новым
+func (r *ExamResults) List(userID int) ([]ExamResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file, err := os.Open(r.path(userID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var results []ExamResult
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var result ExamResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, scanner.Err()
+}
+
+// SaveActive сохраняет идущие экзамены, чтобы они продолжились после перезапуска бота
+func (r *ExamResults) SaveActive(sessions map[int]*ExamSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return saveJSON(r.activePath(), sessions)
+}
+
+// LoadActive возвращает экзамены, которые шли при остановке бота
+func (r *ExamResults) LoadActive() (map[int]*ExamSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sessions := make(map[int]*ExamSession)
+	if err := loadJSON(r.activePath(), &sessions); err != nil {
+		return make(map[int]*ExamSession), err
+	}
+	return sessions, nil
+}
+
+func (r *ExamResults) activePath() string {
+	return filepath.Join(r.dir, "active.json")
+}
+
+func (r *ExamResults) path(userID int) string {
+	return filepath.Join(r.dir, fmt.Sprintf("%d.jsonl", userID))
+}
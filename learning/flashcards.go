@@ -0,0 +1,226 @@
+package learning
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Grade - самооценка ответа на карточку по шкале SM-2 от 0 до 5
+type Grade int
+
+const (
+	GradeAgain Grade = 1 // не вспомнил
+	GradeHard  Grade = 3 // вспомнил с трудом
+	GradeGood  Grade = 4
+	GradeEasy  Grade = 5
+)
+
+const (
+	initialEaseFactor = 2.5
+	minEaseFactor     = 1.3
+	dateLayout        = "2006-01-02"
+)
+
+// Card - карточка термин/определение с состоянием интервального повторения
+type Card struct {
+	ID          int     `json:"id"`
+	Front       string  `json:"front"`
+	Back        string  `json:"back"`
+	Created     string  `json:"created"`
+	Due         string  `json:"due"` // дата следующего повторения, 2006-01-02
+	Interval    int     `json:"interval"`
+	Repetitions int     `json:"repetitions"`
+	EaseFactor  float64 `json:"ease_factor"`
+	Lapses      int     `json:"lapses"`
+}
+
+// IsDue сообщает, пора ли повторить карточку
+func (c Card) IsDue(now time.Time) bool {
+	return c.Due <= now.Format(dateLayout)
+}
+
+// Review пересчитывает интервал карточки по алгоритму SM-2. При оценке ниже GradeHard
+// карточка начинает повторяться заново с завтрашнего дня
+func (c *Card) Review(grade Grade, now time.Time) {
+	q := float64(grade)
+	if grade < GradeHard {
+		c.Repetitions = 0
+		c.Interval = 1
+		c.Lapses++
+	} else {
+		switch c.Repetitions {
+		case 0:
+			c.Interval = 1
+		case 1:
+			c.Interval = 6
+		default:
+			c.Interval = int(math.Round(float64(c.Interval) * c.EaseFactor))
+		}
+		c.Repetitions++
+	}
+
+	c.EaseFactor += 0.1 - (5-q)*(0.08+(5-q)*0.02)
+	if c.EaseFactor < minEaseFactor {
+		c.EaseFactor = minEaseFactor
+	}
+	c.Due = now.AddDate(0, 0, c.Interval).Format(dateLayout)
+}
+
+// deck - файл карточек одного пользователя
+type deck struct {
+	UserID int    `json:"user_id"`
+	NextID int    `json:"next_id"`
+	Cards  []Card `json:"cards"`
+}
+
+// CardStore хранит карточки пользователей в каталоге flashcards каталога логов, по файлу на пользователя
+type CardStore struct {
+	mu    sync.Mutex
+	dir   string
+	decks map[int]*deck
+}
+
+// NewCardStore создает хранилище карточек. Колоды читаются с диска при первом обращении
+func NewCardStore(logsDir string) *CardStore {
+	return &CardStore{dir: filepath.Join(logsDir, "flashcards"), decks: make(map[int]*deck)}
+}
+
+// Add добавляет пользователю карточки, пропуская термины, которые у него уже есть. Возвращает число добавленных
+func (s *CardStore) Add(userID int, cards []Card) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, err := s.deckLocked(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	known := make(map[string]bool)
+	for _, card := range d.Cards {
+		known[normalizeTerm(card.Front)] = true
+	}
+
+	today := time.Now().Format(dateLayout)
+	added := 0
+	for _, card := range cards {
+		term := normalizeTerm(card.Front)
+		if term == "" || strings.TrimSpace(card.Back) == "" || known[term] {
+			continue
+		}
+		known[term] = true
+		d.NextID++
+		d.Cards = append(d.Cards, Card{
+			ID:         d.NextID,
+			Front:      strings.TrimSpace(card.Front),
+			Back:       strings.TrimSpace(card.Back),
+			Created:    today,
+			Due:        today,
+			EaseFactor: initialEaseFactor,
+		})
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	return added, s.saveLocked(d)
+}
+
+// Cards возвращает все карточки пользователя
+func (s *CardStore) Cards(userID int) ([]Card, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, err := s.deckLocked(userID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]Card(nil), d.Cards...), nil
+}
+
+// Due возвращает карточки, которые пора повторить, начиная с самых просроченных
+func (s *CardStore) Due(userID int, now time.Time) ([]Card, error) {
+	cards, err := s.Cards(userID)
+	if err != nil {
+		return nil, err
+	}
+	var due []Card
+	for _, card := range cards {
+		if card.IsDue(now) {
+			due = append(due, card)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].Due < due[j].Due })
+	return due, nil
+}
+
+// Get возвращает карточку пользователя
+func (s *CardStore) Get(userID, cardID int) (Card, bool, error) {
+	cards, err := s.Cards(userID)
+	if err != nil {
+		return Card{}, false, err
+	}
+	for _, card := range cards {
+		if card.ID == cardID {
+			return card, true, nil
+		}
+	}
+	return Card{}, false, nil
+}
+
+// Review записывает самооценку повторения карточки и сохраняет колоду
+func (s *CardStore) Review(userID, cardID int, grade Grade, now time.Time) (Card, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, err := s.deckLocked(userID)
+	if err != nil {
+		return Card{}, err
+	}
+	for i := range d.Cards {
+		if d.Cards[i].ID == cardID {
+			d.Cards[i].Review(grade, now)
+			return d.Cards[i], s.saveLocked(d)
+		}
+	}
+	return Card{}, fmt.Errorf("card %d of user %d not found", cardID, userID)
+}
+
+func (s *CardStore) deckLocked(userID int) (*deck, error) {
+	if d, ok := s.decks[userID]; ok {
+		return d, nil
+	}
+	d := &deck{UserID: userID}
+	if err := loadJSON(s.deckPath(userID), d); err != nil {
+		return nil, err
+	}
+	s.decks[userID] = d
+	return d, nil
+}
+
+func (s *CardStore) saveLocked(d *deck) error {
+	return saveJSON(s.deckPath(d.UserID), d)
+}
+
+func (s *CardStore) deckPath(userID int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%d.json", userID))
+}
+
+func normalizeTerm(term string) string {
+	return strings.ToLower(strings.TrimSpace(term))
+}
+
+// WriteAnkiCSV выгружает карточки в CSV для импорта в Anki: лицевая сторона, оборотная сторона, метки
+func WriteAnkiCSV(out io.Writer, cards []Card, tags string) error {
+	w := csv.NewWriter(out)
+	for _, card := range cards {
+		if err := w.Write([]string{card.Front, card.Back, tags}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
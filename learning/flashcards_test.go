@@ -0,0 +1,86 @@
+package learning
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCardReview(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		grades      []Grade
+		interval    int
+		repetitions int
+		ease        float64
+		lapses      int
+	}{
+		{"first good", []Grade{GradeGood}, 1, 1, 2.5, 0},
+		{"second good", []Grade{GradeGood, GradeGood}, 6, 2, 2.5, 0},
+		{"interval grows by the ease", []Grade{GradeGood, GradeGood, GradeGood}, 15, 3, 2.5, 0},
+		{"easy raises the ease", []Grade{GradeEasy, GradeEasy, GradeEasy}, 16, 3, 2.8, 0},
+		{"hard lowers the ease", []Grade{GradeHard, GradeHard, GradeHard}, 13, 3, 2.08, 0},
+		{"again resets the repetitions", []Grade{GradeGood, GradeGood, GradeAgain}, 1, 0, 1.96, 1},
+		{"learning again after a lapse", []Grade{GradeAgain, GradeGood, GradeGood}, 6, 2, 1.96, 1},
+		{"ease floor", []Grade{GradeAgain, GradeAgain, GradeAgain}, 1, 0, minEaseFactor, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card := Card{EaseFactor: initialEaseFactor}
+			for _, grade := range tt.grades {
+				card.Review(grade, now)
+			}
+			if card.Interval != tt.interval || card.Repetitions != tt.repetitions || card.Lapses != tt.lapses ||
+				math.Abs(card.EaseFactor-tt.ease) > 1e-9 {
+				t.Errorf("card = %+v, want interval %d, repetitions %d, ease %g, lapses %d",
+					card, tt.interval, tt.repetitions, tt.ease, tt.lapses)
+			}
+			if want := now.AddDate(0, 0, tt.interval).Format(dateLayout); card.Due != want {
+				t.Errorf("due %s, want %s", card.Due, want)
+			}
+		})
+	}
+}
+
+func TestCardStoreDue(t *testing.T) {
+	store := NewCardStore(t.TempDir())
+	added, err := store.Add(1, []Card{{Front: "one", Back: "1"}, {Front: "two", Back: "2"}, {Front: "three", Back: "3"}, {Front: "One", Back: "dup"}})
+	if err != nil || added != 3 {
+		t.Fatalf("Add = %d, %v, want 3 cards", added, err)
+	}
+
+	now := time.Now()
+	if _, err := store.Review(1, 1, GradeGood, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Review(1, 2, GradeGood, now.AddDate(0, 0, -5)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want []int
+	}{
+		{"today, most overdue first", now, []int{2, 3}},
+		{"tomorrow", now.AddDate(0, 0, 1), []int{2, 3, 1}},
+		{"in the past", now.AddDate(0, 0, -10), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			due, err := store.Due(1, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			for _, card := range due {
+				ids = append(ids, card.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("due cards %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package learning
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Plan - учебный план: разделы из шагов, которые ученик проходит по порядку
+type Plan struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Units       []Unit `json:"units"`
+}
+
+// Unit - раздел плана
+type Unit struct {
+	Title string `json:"title"`
+	Steps []Step `json:"steps"`
+}
+
+// Step - шаг урока. Instructions добавляются к системному промпту, пока ученик на этом шаге.
+// Если у шага есть контрольный вопрос, перейти дальше можно только ответив на него
+type Step struct {
+	Title        string      `json:"title"`
+	Objective    string      `json:"objective"`
+	Instructions string      `json:"instructions"`
+	Checkpoint   *Checkpoint `json:"checkpoint,omitempty"`
+}
+
+// Checkpoint - контрольный вопрос шага. Ответ ученика модель оценивает по критериям Rubric
+type Checkpoint struct {
+	Question string `json:"question"`
+	Rubric   string `json:"rubric"`
+}
+
+// StepCount возвращает число шагов во всех разделах
+func (p Plan) StepCount() int {
+	count := 0
+	for _, unit := range p.Units {
+		count += len(unit.Steps)
+	}
+	return count
+}
+
+// StepAt возвращает раздел и шаг по сквозному номеру шага
+func (p Plan) StepAt(index int) (Unit, Step, bool) {
+	for _, unit := range p.Units {
+		if index < len(unit.Steps) {
+			return unit, unit.Steps[index], true
+		}
+		index -= len(unit.Steps)
+	}
+	return Unit{}, Step{}, false
+}
+
+// Validate проверяет, что у плана есть ID, шаги и у каждого шага - инструкции
+func (p Plan) Validate() error {
+	if p.ID == "" || p.Title == "" {
+		return fmt.Errorf("lesson plan must have an id and a title")
+	}
+	if p.StepCount() == 0 {
+		return fmt.Errorf("lesson plan %q has no steps", p.ID)
+	}
+	for _, unit := range p.Units {
+		for _, step := range unit.Steps {
+			if step.Title == "" || step.Instructions == "" {
+				return fmt.Errorf("every step of lesson plan %q must have a title and instructions", p.ID)
+			}
+			if step.Checkpoint != nil && (step.Checkpoint.Question == "" || step.Checkpoint.Rubric == "") {
+				return fmt.Errorf("checkpoint of step %q in lesson plan %q must have a question and a rubric", step.Title, p.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// LessonLibrary - учебные планы из файла LESSONS_FILE
+type LessonLibrary struct {
+	plans map[string]Plan
+}
+
+// LoadLessons читает учебные планы из JSON-файла со списком планов. Отсутствующий файл дает пустую библиотеку
+func LoadLessons(path string) (*LessonLibrary, error) {
+	l := &LessonLibrary{plans: make(map[string]Plan)}
+	if path == "" {
+		return l, nil
+	}
+
+	var plans []Plan
+	if err := loadJSON(path, &plans); err != nil {
+		return l, err
+	}
+	for _, plan := range plans {
+		if err := plan.Validate(); err != nil {
+			return l, fmt.Errorf("%s: %v", path, err)
+		}
+		l.plans[plan.ID] = plan
+	}
+	return l, nil
+}
+
+// Lookup возвращает план по ID
+func (l *LessonLibrary) Lookup(id string) (Plan, bool) {
+	plan, ok := l.plans[id]
+	return plan, ok
+}
+
+// List возвращает планы, отсортированные по ID
+func (l *LessonLibrary) List() []Plan {
+	plans := make([]Plan, 0, len(l.plans))
+	for _, plan := range l.plans {
+		plans = append(plans, plan)
+	}
+	sort.Slice(plans, func(i, j int) bool { return plans[i].ID < plans[j].ID })
+	return plans
+}
+
+// PlanProgress - прохождение плана учеником. Step - сквозной номер текущего шага
+type PlanProgress struct {
+	Step     int       `json:"step"`
+	Attempts int       `json:"attempts,omitempty"` // неудачные ответы на контрольный вопрос текущего шага
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished,omitempty"`
+}
+
+// LessonState - уроки ученика: активный план, ожидание ответа на контрольный вопрос и прогресс по планам
+type LessonState struct {
+	Active   string                   `json:"active,omitempty"`
+	Awaiting bool                     `json:"awaiting,omitempty"`
+	Plans    map[string]*PlanProgress `json:"plans,omitempty"`
+}
+
+// Current возвращает прогресс активного плана
+func (s *LessonState) Current() *PlanProgress {
+	if s.Active == "" || s.Plans == nil {
+		return nil
+	}
+	return s.Plans[s.Active]
+}
+
+// Start делает план активным. Пройденный план начинается заново
+func (s *LessonState) Start(planID string, now time.Time) *PlanProgress {
+	progress, ok := s.Plans[planID]
+	if !ok || !progress.Finished.IsZero() {
+		progress = &PlanProgress{Started: now}
+		s.Plans[planID] = progress
+	}
+	s.Active = planID
+	s.Awaiting = false
+	return progress
+}
+
+// Advance завершает текущий шаг активного плана. Возвращает true, если план пройден
+func (s *LessonState) Advance(plan Plan, now time.Time) bool {
+	progress := s.Current()
+	if progress == nil {
+		return false
+	}
+	s.Awaiting = false
+	progress.Attempts = 0
+	progress.Step++
+	if progress.Step < plan.StepCount() {
+		return false
+	}
+	progress.Finished = now
+	s.Active = ""
+	return true
+}
+
+// LessonStore хранит состояние уроков в каталоге lessons каталога логов, по файлу на ученика
+type LessonStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewLessonStore создает хранилище состояния уроков
+func NewLessonStore(logsDir string) *LessonStore {
+	return &LessonStore{dir: filepath.Join(logsDir, "lessons")}
+}
+
+// Get возвращает состояние уроков ученика
+func (s *LessonStore) Get(userID int) (LessonState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(userID)
+}
+
+// Update изменяет состояние уроков ученика и сохраняет его
+func (s *LessonStore) Update(userID int, update func(*LessonState)) (LessonState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, err := s.load(userID)
+	if err != nil {
+		return state, err
+	}
+	if state.Plans == nil {
+		state.Plans = make(map[string]*PlanProgress)
+	}
+	update(&state)
+	return state, saveJSON(s.path(userID), state)
+}
+
+func (s *LessonStore) load(userID int) (LessonState, error) {
+	var state LessonState
+	err := loadJSON(s.path(userID), &state)
+	return state, err
+}
+
+func (s *LessonStore) path(userID int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%d.json", userID))
+}
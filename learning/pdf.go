@@ -0,0 +1,822 @@
+package learning
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Минимальный разбор PDF для извлечения текста учебных материалов. Поддерживаются несжатые и сжатые
+// FlateDecode потоки, потоки объектов, наследование ресурсов страниц и шрифты с ToUnicode.
+// Зашифрованные и отсканированные документы, а также текст внутри Form XObject не поддерживаются
+
+type (
+	pdfName    string
+	pdfKeyword string
+	pdfRef     int
+	pdfDict    map[string]interface{}
+)
+
+// pdfMaxDepth ограничивает глубину ссылок и дерева страниц, чтобы испорченный файл не зациклил разбор
+const pdfMaxDepth = 32
+
+// pdfMaxNesting ограничивает вложенность массивов и словарей: переполнение стека не перехватывается recover
+const pdfMaxNesting = 256
+
+const (
+	// pdfMaxStreamSize ограничивает размер одного распакованного потока
+	pdfMaxStreamSize = 16 << 20
+	// pdfMaxDecodedSize ограничивает суммарный размер распакованных потоков. Небольшой файл со сжатыми нулями
+	// распаковывается в гигабайты, а нехватку памяти recover не перехватывает
+	pdfMaxDecodedSize = 64 << 20
+)
+
+var pdfObjectPattern = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+// pdfDocument - объекты документа по номерам и декодированные данные их потоков
+type pdfDocument struct {
+	objects map[int]interface{}
+	streams map[int][]byte
+}
+
+// pdfFont - таблица перевода кодов символов шрифта в Unicode
+type pdfFont struct {
+	toUnicode map[string]string
+	// codeLengths - длины кодов в байтах по возрастанию
+	codeLengths []int
+	composite   bool
+}
+
+// ExtractPDFText возвращает текст страниц PDF-документа по порядку. Если разбор испорченного файла все же
+// упадет, паника возвращается как ошибка, а не завершает бота
+func ExtractPDFText(data []byte) (texts []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			texts, err = nil, fmt.Errorf("malformed PDF file: %v", r)
+		}
+	}()
+	return extractPDFText(data)
+}
+
+func extractPDFText(data []byte) ([]string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \r\n\t"), []byte("%PDF")) {
+		return nil, fmt.Errorf("not a PDF file")
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return nil, fmt.Errorf("encrypted PDF files are not supported")
+	}
+
+	doc, err := parsePDF(data)
+	if err != nil {
+		return nil, err
+	}
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("no pages found in the PDF file")
+	}
+
+	texts := make([]string, len(pages))
+	for i, page := range pages {
+		texts[i] = doc.pageText(page)
+	}
+	return texts, nil
+}
+
+func parsePDF(data []byte) (*pdfDocument, error) {
+	doc := &pdfDocument{objects: make(map[int]interface{}), streams: make(map[int][]byte)}
+	parsed, decoded := 0, 0
+	for _, match := range pdfObjectPattern.FindAllSubmatchIndex(data, -1) {
+		// совпадения внутри данных уже разобранного потока - не объекты
+		if match[0] < parsed {
+			continue
+		}
+		num, err := strconv.Atoi(string(data[match[2]:match[3]]))
+		if err != nil {
+			continue
+		}
+		lexer := &pdfLexer{data: data, pos: match[1]}
+		value, ok := lexer.value()
+		if !ok {
+			continue
+		}
+		// более поздние определения объекта заменяют ранние, как при инкрементальном обновлении
+		doc.objects[num] = value
+		delete(doc.streams, num)
+		if dict, ok := value.(pdfDict); ok {
+			if stream, ok := lexer.stream(dict); ok {
+				decodedStream, err := decodePDFStream(dict, stream, min(pdfMaxStreamSize, pdfMaxDecodedSize-decoded))
+				if err != nil {
+					return nil, err
+				}
+				doc.streams[num] = decodedStream
+				if dict["Filter"] != nil {
+					decoded += len(decodedStream)
+				}
+			}
+		}
+		parsed = lexer.pos
+	}
+
+	for num, value := range doc.objects {
+		if dict, ok := value.(pdfDict); ok && dict["Type"] == pdfName("ObjStm") {
+			doc.parseObjectStream(dict, doc.streams[num])
+		}
+	}
+	return doc, nil
+}
+
+// parseObjectStream добавляет объекты из потока объектов, не заменяя определенные напрямую
+func (d *pdfDocument) parseObjectStream(dict pdfDict, data []byte) {
+	count, _ := d.resolve(dict["N"]).(float64)
+	first, _ := d.resolve(dict["First"]).(float64)
+	if data == nil || first < 0 || int(first) > len(data) {
+		return
+	}
+
+	header := &pdfLexer{data: data[:int(first)]}
+	for i := 0; i < int(count); i++ {
+		num, ok1 := header.next()
+		offset, ok2 := header.next()
+		n, isNum := num.(float64)
+		o, isOffset := offset.(float64)
+		if !ok1 || !ok2 || !isNum || !isOffset {
+			return
+		}
+		if _, exists := d.objects[int(n)]; exists || o < 0 || int(first)+int(o) >= len(data) {
+			continue
+		}
+		lexer := &pdfLexer{data: data, pos: int(first) + int(o)}
+		if value, ok := lexer.value(); ok {
+			d.objects[int(n)] = value
+		}
+	}
+}
+
+// resolve заменяет ссылку на объект самим объектом
+func (d *pdfDocument) resolve(value interface{}) interface{} {
+	for depth := 0; depth < pdfMaxDepth; depth++ {
+		ref, ok := value.(pdfRef)
+		if !ok {
+			return value
+		}
+		value = d.objects[int(ref)]
+	}
+	return nil
+}
+
+func (d *pdfDocument) dict(value interface{}) pdfDict {
+	dict, _ := d.resolve(value).(pdfDict)
+	return dict
+}
+
+// pdfPage - словарь страницы и ее ресурсы с учетом унаследованных
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// pages возвращает страницы в порядке дерева страниц каталога. Если каталог не найден,
+// страницы берутся в порядке номеров объектов
+func (d *pdfDocument) pages() []pdfPage {
+	var pages []pdfPage
+	var walk func(node pdfDict, resources pdfDict, depth int)
+	walk = func(node pdfDict, resources pdfDict, depth int) {
+		if node == nil || depth > pdfMaxDepth {
+			return
+		}
+		if own := d.dict(node["Resources"]); own != nil {
+			resources = own
+		}
+		if node["Type"] == pdfName("Page") {
+			pages = append(pages, pdfPage{dict: node, resources: resources})
+			return
+		}
+		kids, _ := d.resolve(node["Kids"]).([]interface{})
+		for _, kid := range kids {
+			walk(d.dict(kid), resources, depth+1)
+		}
+	}
+
+	for _, value := range d.objects {
+		if dict, ok := value.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+			walk(d.dict(dict["Pages"]), nil, 0)
+			if len(pages) > 0 {
+				return pages
+			}
+		}
+	}
+
+	var nums []int
+	for num, value := range d.objects {
+		if dict, ok := value.(pdfDict); ok && dict["Type"] == pdfName("Page") {
+			nums = append(nums, num)
+		}
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		dict := d.objects[num].(pdfDict)
+		pages = append(pages, pdfPage{dict: dict, resources: d.dict(dict["Resources"])})
+	}
+	return pages
+}
+
+// pageText собирает содержимое страницы и извлекает из него текст
+func (d *pdfDocument) pageText(page pdfPage) string {
+	var content []byte
+	contents := page.dict["Contents"]
+	if array, ok := d.resolve(contents).([]interface{}); ok {
+		for _, item := range array {
+			if ref, ok := item.(pdfRef); ok {
+				content = append(content, d.streams[int(ref)]...)
+				content = append(content, '\n')
+			}
+		}
+	} else if ref, ok := contents.(pdfRef); ok {
+		content = d.streams[int(ref)]
+	}
+
+	fonts := make(map[string]*pdfFont)
+	for name, value := range d.dict(page.resources["Font"]) {
+		fonts[name] = d.font(d.dict(value))
+	}
+	return normalizePDFText(extractContentText(content, fonts))
+}
+
+// font читает кодировку шрифта из его ToUnicode
+func (d *pdfDocument) font(dict pdfDict) *pdfFont {
+	font := &pdfFont{composite: dict["Subtype"] == pdfName("Type0")}
+	if ref, ok := dict["ToUnicode"].(pdfRef); ok {
+		font.toUnicode, font.codeLengths = parseToUnicode(d.streams[int(ref)])
+	}
+	if len(font.codeLengths) == 0 {
+		font.codeLengths = []int{1}
+		if font.composite {
+			font.codeLengths = []int{2}
+		}
+	}
+	return font
+}
+
+// decode переводит строку из кодов шрифта в текст. Коды без перевода у простых шрифтов
+// считаются Latin-1, у составных пропускаются
+func (f *pdfFont) decode(s string) string {
+	if f == nil {
+		return latin1(s)
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		matched := false
+		for _, n := range f.codeLengths {
+			if i+n > len(s) {
+				break
+			}
+			if text, ok := f.toUnicode[s[i:i+n]]; ok {
+				b.WriteString(text)
+				i += n
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+		if f.composite {
+			i += f.codeLengths[0]
+			continue
+		}
+		b.WriteString(latin1(s[i : i+1]))
+		i++
+	}
+	return b.String()
+}
+
+// parseToUnicode разбирает CMap ToUnicode: bfchar, bfrange и длины кодов из codespacerange
+func parseToUnicode(data []byte) (map[string]string, []int) {
+	cmap := make(map[string]string)
+	lengths := make(map[int]bool)
+	lexer := &pdfLexer{data: data}
+	var operands []interface{}
+	for {
+		token, ok := lexer.value()
+		if !ok {
+			break
+		}
+		keyword, isKeyword := token.(pdfKeyword)
+		if !isKeyword {
+			operands = append(operands, token)
+			continue
+		}
+		switch keyword {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				if lo, ok := operands[i].(string); ok {
+					lengths[len(lo)] = true
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(string)
+				dst, ok2 := operands[i+1].(string)
+				if ok1 && ok2 {
+					cmap[src] = utf16BE(dst)
+					lengths[len(src)] = true
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(string)
+				hi, ok2 := operands[i+1].(string)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 {
+					continue
+				}
+				lengths[len(lo)] = true
+				start, end := codeValue(lo), codeValue(hi)
+				if end < start || end-start > 0xFFFF {
+					continue
+				}
+				for code := start; code <= end; code++ {
+					src := codeString(code, len(lo))
+					switch dst := operands[i+2].(type) {
+					case string:
+						cmap[src] = utf16BE(incrementCode(dst, code-start))
+					case []interface{}:
+						if code-start < len(dst) {
+							if item, ok := dst[code-start].(string); ok {
+								cmap[src] = utf16BE(item)
+							}
+						}
+					}
+				}
+			}
+		}
+		if strings.HasPrefix(string(keyword), "end") || strings.HasPrefix(string(keyword), "begin") {
+			operands = operands[:0]
+		}
+	}
+
+	var sorted []int
+	for n := range lengths {
+		if n > 0 && n <= 4 {
+			sorted = append(sorted, n)
+		}
+	}
+	sort.Ints(sorted)
+	return cmap, sorted
+}
+
+func codeValue(s string) int {
+	value := 0
+	for i := 0; i < len(s); i++ {
+		value = value<<8 | int(s[i])
+	}
+	return value
+}
+
+func codeString(value, length int) string {
+	b := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		b[i] = byte(value)
+		value >>= 8
+	}
+	return string(b)
+}
+
+// incrementCode увеличивает последний байт строки назначения bfrange на delta
+func incrementCode(s string, delta int) string {
+	if s == "" {
+		return s
+	}
+	b := []byte(s)
+	b[len(b)-1] += byte(delta)
+	return string(b)
+}
+
+func utf16BE(s string) string {
+	if len(s)%2 != 0 {
+		return latin1(s)
+	}
+	units := make([]uint16, len(s)/2)
+	for i := range units {
+		units[i] = uint16(s[2*i])<<8 | uint16(s[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+func latin1(s string) string {
+	runes := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		runes[i] = rune(s[i])
+	}
+	return string(runes)
+}
+
+// extractContentText выполняет текстовые операторы потока содержимого страницы.
+// Переходы на новую строку превращаются в переводы строк, заметные сдвиги - в пробелы
+func extractContentText(content []byte, fonts map[string]*pdfFont) string {
+	var b strings.Builder
+	var font *pdfFont
+	var operands []interface{}
+	lastY, hasY := 0.0, false
+
+	number := func(i int) float64 {
+		if i < len(operands) {
+			if n, ok := operands[i].(float64); ok {
+				return n
+			}
+		}
+		return 0
+	}
+	show := func(value interface{}) {
+		switch v := value.(type) {
+		case string:
+			b.WriteString(font.decode(v))
+		case []interface{}:
+			for _, item := range v {
+				switch item := item.(type) {
+				case string:
+					b.WriteString(font.decode(item))
+				case float64:
+					// большой отрицательный кернинг обычно означает пробел между словами
+					if item < -200 {
+						b.WriteByte(' ')
+					}
+				}
+			}
+		}
+	}
+
+	lexer := &pdfLexer{data: content}
+	for {
+		token, ok := lexer.next()
+		if !ok {
+			break
+		}
+		keyword, isKeyword := token.(pdfKeyword)
+		if !isKeyword {
+			operands = append(operands, token)
+			continue
+		}
+
+		switch keyword {
+		case "Tf":
+			if len(operands) > 0 {
+				if name, ok := operands[0].(pdfName); ok {
+					font = fonts[string(name)]
+				}
+			}
+		case "Td", "TD":
+			if number(1) != 0 {
+				b.WriteByte('\n')
+			} else if number(0) != 0 {
+				b.WriteByte(' ')
+			}
+		case "Tm":
+			y := number(5)
+			if hasY && y != lastY {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(' ')
+			}
+			lastY, hasY = y, true
+		case "T*":
+			b.WriteByte('\n')
+		case "Tj", "TJ":
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "'", "\"":
+			b.WriteByte('\n')
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "ET":
+			b.WriteByte(' ')
+		case "BI":
+			// встроенное изображение содержит двоичные данные до оператора EI
+			if end := bytes.Index(content[lexer.pos:], []byte("EI")); end >= 0 {
+				lexer.pos += end + 2
+			}
+		}
+		operands = operands[:0]
+	}
+	return b.String()
+}
+
+var (
+	pdfSpaces     = regexp.MustCompile(`[ \t\x00]+`)
+	pdfBlankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+func normalizePDFText(text string) string {
+	text = pdfSpaces.ReplaceAllString(text, " ")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(pdfBlankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// decodePDFStream распаковывает поток, сжатый FlateDecode. Потоки с другими фильтрами, например изображения,
+// не нужны для извлечения текста и возвращаются пустыми. Если распакованный поток больше limit байт,
+// документ считается слишком большим
+func decodePDFStream(dict pdfDict, data []byte, limit int) ([]byte, error) {
+	var filters []interface{}
+	switch filter := dict["Filter"].(type) {
+	case nil:
+		// несжатый поток - часть самого файла и не занимает новой памяти
+		return data, nil
+	case pdfName:
+		filters = []interface{}{filter}
+	case []interface{}:
+		filters = filter
+	}
+	for _, filter := range filters {
+		if filter != pdfName("FlateDecode") {
+			return nil, nil
+		}
+		reader, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil
+		}
+		// у обрезанных потоков сохраняется то, что удалось распаковать
+		data, _ = io.ReadAll(io.LimitReader(reader, int64(limit)+1))
+		reader.Close()
+		if len(data) > limit {
+			break
+		}
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("the PDF file is too large when decompressed")
+	}
+	return data, nil
+}
+
+// pdfLexer читает объекты PDF и операторы потоков содержимого. pos никогда не выходит за len(data)
+type pdfLexer struct {
+	data  []byte
+	pos   int
+	depth int // вложенность разбираемых массивов и словарей
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+// value читает объект, распознавая ссылки вида "12 0 R"
+func (l *pdfLexer) value() (interface{}, bool) {
+	value, ok := l.next()
+	if !ok {
+		return nil, false
+	}
+	num, isNum := value.(float64)
+	if !isNum || num != float64(int(num)) || num < 0 {
+		return value, true
+	}
+	saved := l.pos
+	generation, ok1 := l.next()
+	keyword, ok2 := l.next()
+	if _, isGen := generation.(float64); ok1 && ok2 && isGen && keyword == pdfKeyword("R") {
+		return pdfRef(int(num)), true
+	}
+	l.pos = saved
+	return value, true
+}
+
+// next читает объект без распознавания ссылок. Строки возвращаются как string с исходными байтами
+func (l *pdfLexer) next() (interface{}, bool) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, false
+	}
+
+	c := l.data[l.pos]
+	if (c == '[' || c == '<') && l.depth >= pdfMaxNesting {
+		return nil, false
+	}
+	switch {
+	case c == '/':
+		l.pos++
+		return pdfName(decodePDFName(l.regular())), true
+	case c == '(':
+		return l.literalString(), true
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		l.depth++
+		defer func() { l.depth-- }()
+		dict := make(pdfDict)
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return dict, true
+			}
+			if l.data[l.pos] == '>' {
+				l.pos++
+				if l.pos < len(l.data) && l.data[l.pos] == '>' {
+					l.pos++
+				}
+				return dict, true
+			}
+			key, ok := l.next()
+			if !ok {
+				return dict, true
+			}
+			value, ok := l.value()
+			if !ok {
+				return dict, true
+			}
+			if name, ok := key.(pdfName); ok {
+				dict[string(name)] = value
+			}
+		}
+	case c == '<':
+		return l.hexString(), true
+	case c == '[':
+		l.pos++
+		l.depth++
+		defer func() { l.depth-- }()
+		var array []interface{}
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return array, true
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return array, true
+			}
+			value, ok := l.value()
+			if !ok {
+				return array, true
+			}
+			array = append(array, value)
+		}
+	case isPDFDelimiter(c):
+		l.pos++
+		return pdfKeyword(string(c)), true
+	}
+
+	token := l.regular()
+	if n, err := strconv.ParseFloat(token, 64); err == nil {
+		return n, true
+	}
+	return pdfKeyword(token), true
+}
+
+func (l *pdfLexer) regular() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+func (l *pdfLexer) literalString() string {
+	var b []byte
+	depth := 0
+	for l.pos++; l.pos < len(l.data); l.pos++ {
+		c := l.data[l.pos]
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				l.pos++
+				return string(b)
+			}
+			depth--
+		case '\\':
+			l.pos++
+			if l.pos >= len(l.data) {
+				return string(b)
+			}
+			c = l.data[l.pos]
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// перенос строки после обратной косой черты не входит в строку
+				if c == '\r' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '\n' {
+					l.pos++
+				}
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					value := 0
+					for i := 0; i < 3 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						value = value*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					l.pos--
+					c = byte(value)
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+func (l *pdfLexer) hexString() string {
+	var digits []byte
+	for l.pos++; l.pos < len(l.data) && l.data[l.pos] != '>'; l.pos++ {
+		if c := l.data[l.pos]; !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if l.pos < len(l.data) {
+		l.pos++
+	}
+	if len(digits)%2 != 0 {
+		digits = append(digits, '0')
+	}
+	b := make([]byte, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		value, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		if err != nil {
+			break
+		}
+		b = append(b, byte(value))
+	}
+	return string(b)
+}
+
+// stream читает данные потока, следующего за словарем объекта
+func (l *pdfLexer) stream(dict pdfDict) ([]byte, bool) {
+	l.skipSpace()
+	if l.pos >= len(l.data) || !bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+		return nil, false
+	}
+	start := l.pos + len("stream")
+	if bytes.HasPrefix(l.data[start:], []byte("\r\n")) {
+		start += 2
+	} else if start < len(l.data) && (l.data[start] == '\n' || l.data[start] == '\r') {
+		start++
+	}
+
+	if length, ok := dict["Length"].(float64); ok && length >= 0 && length <= float64(len(l.data)-start) {
+		end := start + int(length)
+		if bytes.HasPrefix(bytes.TrimLeft(l.data[end:], " \r\n"), []byte("endstream")) {
+			l.pos = end
+			return l.data[start:end], true
+		}
+	}
+	// длина задана ссылкой или неверна: данные заканчиваются перед endstream
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end < 0 {
+		return nil, false
+	}
+	l.pos = start + end
+	return bytes.TrimRight(l.data[start:start+end], "\r\n"), true
+}
+
+func decodePDFName(name string) string {
+	if !strings.Contains(name, "#") {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '#' && i+2 < len(name) {
+			if value, err := strconv.ParseUint(name[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(value))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
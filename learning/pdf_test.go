@@ -0,0 +1,180 @@
+package learning
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// buildPDF numbers the objects from 1 and joins them into a PDF file without a cross-reference table,
+// which the parser doesn't need.
+func buildPDF(objects ...string) []byte {
+	var b strings.Builder
+	b.WriteString("%PDF-1.4\n")
+	for i, object := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	b.WriteString("%%EOF\n")
+	return []byte(b.String())
+}
+
+func streamObject(dict, data string) string {
+	return fmt.Sprintf("<< /Length %d %s >>\nstream\n%s\nendstream", len(data), dict, data)
+}
+
+func deflate(data string) string {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write([]byte(data))
+	w.Close()
+	return b.String()
+}
+
+const pdfFontResources = "/Resources << /Font << /F1 << /Type /Font /Subtype /Type1 >> >> >>"
+
+func TestExtractPDFText(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []string
+	}{
+		{
+			name: "single page",
+			data: buildPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+				"<< /Type /Page /Parent 2 0 R /Contents 4 0 R "+pdfFontResources+" >>",
+				streamObject("", "BT /F1 12 Tf 72 720 Td (Hello, world!) Tj ET"),
+			),
+			want: []string{"Hello, world!"},
+		},
+		{
+			name: "page order and lines",
+			data: buildPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [4 0 R 3 0 R] /Count 2 "+pdfFontResources+" >>",
+				"<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>",
+				"<< /Type /Page /Parent 2 0 R /Contents 6 0 R >>",
+				streamObject("", "BT /F1 12 Tf (Second) Tj ET"),
+				streamObject("", "BT /F1 12 Tf (First) Tj 0 -14 Td [(li) 20 (ne) -300 (two)] TJ ET"),
+			),
+			want: []string{"First\nline two", "Second"},
+		},
+		{
+			name: "compressed stream with escapes",
+			data: buildPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+				"<< /Type /Page /Parent 2 0 R /Contents 4 0 R "+pdfFontResources+" >>",
+				streamObject("/Filter /FlateDecode", deflate(`BT /F1 12 Tf (\(a\) caf\351) Tj ET`)),
+			),
+			want: []string{"(a) café"},
+		},
+		{
+			name: "wrong length",
+			data: buildPDF(
+				"<< /Type /Page /Contents 2 0 R "+pdfFontResources+" >>",
+				"<< /Length 1000 >>\nstream\nBT /F1 12 Tf (Still read) Tj ET\nendstream",
+			),
+			want: []string{"Still read"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractPDFText(tt.data)
+			if err != nil {
+				t.Fatalf("ExtractPDFText: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractPDFTextMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"not a PDF", "hello", "not a PDF"},
+		{"encrypted", "%PDF-1.4\n1 0 obj << /Encrypt 2 0 R >> endobj", "encrypted"},
+		{"no pages", "%PDF-1.4\n1 0 obj << /Type /Catalog >> endobj", "no pages"},
+		{"unterminated hex string", "%PDF0 0 obj<<<", "no pages"},
+		{"unterminated dictionary", "%PDF-1.4\n1 0 obj << /Type /Catalog /Pages >", "no pages"},
+		{"negative length", "%PDF-1.4\n1 0 obj << /Length -100 >>\nstream\nabc\nendstream endobj", "no pages"},
+		{"length past the end", "%PDF-1.4\n1 0 obj << /Length 99999999999 >>\nstream\nabc", "no pages"},
+		{"negative object stream offset", "%PDF-1.4\n1 0 obj << /Type /ObjStm /N 1 /First 4 /Length 8 >>\nstream\n2 -9 <<>>\nendstream endobj", "no pages"},
+		{"negative object stream start", "%PDF-1.4\n1 0 obj << /Type /ObjStm /N 1 /First -4 /Length 8 >>\nstream\n2 0 <<>>\nendstream endobj", "no pages"},
+		{"deep nesting", "%PDF-1.4\n1 0 obj " + strings.Repeat("[", 100000), "no pages"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// call the parser without the recover of ExtractPDFText, so a bounds bug fails the test
+			_, err := extractPDFText([]byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractPDFTextDecompressionLimit(t *testing.T) {
+	page := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R " + pdfFontResources + " >>",
+		streamObject("", "BT /F1 12 Tf (Hello) Tj ET"),
+	}
+	tests := []struct {
+		name    string
+		streams []string
+	}{
+		{"one large stream", []string{deflate(strings.Repeat("0", pdfMaxStreamSize+1))}},
+		{"many streams", []string{
+			deflate(strings.Repeat("0", pdfMaxStreamSize)),
+			deflate(strings.Repeat("0", pdfMaxStreamSize)),
+			deflate(strings.Repeat("0", pdfMaxStreamSize)),
+			deflate(strings.Repeat("0", pdfMaxStreamSize)),
+			deflate("0"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := append([]string(nil), page...)
+			for _, stream := range tt.streams {
+				objects = append(objects, streamObject("/Filter /FlateDecode", stream))
+			}
+			_, err := extractPDFText(buildPDF(objects...))
+			if err == nil || !strings.Contains(err.Error(), "too large") {
+				t.Errorf("err = %v, want the document rejected", err)
+			}
+		})
+	}
+}
+
+func FuzzExtractPDFText(f *testing.F) {
+	f.Add(buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R "+pdfFontResources+" >>",
+		streamObject("", "BT /F1 12 Tf 72 720 Td (Hello) Tj ET"),
+	))
+	f.Add([]byte("%PDF0 0 obj<<<"))
+	f.Add([]byte("%PDF-1.4\n1 0 obj << /Length -1 >>\nstream\nx\nendstream endobj"))
+	f.Add([]byte("%PDF-1.4\n1 0 obj << /Type /ObjStm /N 2 /First 8 >>\nstream\n2 0 3 4 <<>> [<41>]\nendstream endobj"))
+	f.Add([]byte("%PDF-1.4\n1 0 obj << /ToUnicode 2 0 R >> endobj 2 0 obj << >>\nstream\n" +
+		"1 begincodespacerange <00> <FF> endcodespacerange 1 beginbfrange <00> <FF> <0041> endbfrange\nendstream endobj"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// without the recover of ExtractPDFText any panic of the parser fails the fuzzer
+		texts, err := extractPDFText(data)
+		if err == nil && len(texts) == 0 {
+			t.Error("no pages and no error")
+		}
+	})
+}
@@ -0,0 +1,266 @@
+package learning
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType - вид учебного события
+type EventType string
+
+const (
+	EventChat            EventType = "chat"             // вопрос тьютору, Detail - начало вопроса
+	EventQuiz            EventType = "quiz"             // пройденный тест, Value - доля правильных ответов
+	EventFlashcardReview EventType = "flashcard_review" // повторение карточки, Value - самооценка
+	EventSession         EventType = "session"          // учебная сессия, Value - длительность в минутах
+	EventLesson          EventType = "lesson"           // пройденный шаг урока, Topic - план, Detail - шаг
+	EventExam            EventType = "exam"             // сданный экзамен, Value - доля набранных баллов
+	EventVocabDrill      EventType = "vocab_drill"      // упражнение со словом, Topic - слово, Value - 1 за правильный ответ
+	EventHint            EventType = "hint"             // подсказка к задаче, Topic - задача, Value - уровень подсказки, Detail - "solution", если показано решение
+)
+
+// Event - учебное событие ученика
+type Event struct {
+	Time   time.Time `json:"time"`
+	Type   EventType `json:"type"`
+	Topic  string    `json:"topic,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+	Value  float64   `json:"value,omitempty"`
+}
+
+func (e Event) String() string {
+	s := e.Time.Format("2006-01-02 15:04") + " " + string(e.Type)
+	if e.Topic != "" {
+		s += " [" + e.Topic + "]"
+	}
+	if e.Detail != "" {
+		s += ": " + e.Detail
+	}
+	switch e.Type {
+	case EventQuiz, EventExam:
+		s += fmt.Sprintf(" (%.0f%%)", e.Value*100)
+	case EventFlashcardReview:
+		s += fmt.Sprintf(" (grade %.0f)", e.Value)
+	case EventSession:
+		s += fmt.Sprintf(" (%.0f min)", e.Value)
+	case EventHint:
+		s += fmt.Sprintf(" (hint %.0f)", e.Value)
+	}
+	return s
+}
+
+// ProgressLog хранит учебные события в каталоге progress каталога логов, по файлу JSON lines на ученика
+type ProgressLog struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewProgressLog создает журнал учебных событий
+func NewProgressLog(logsDir string) *ProgressLog {
+	return &ProgressLog{dir: filepath.Join(logsDir, "progress")}
+}
+
+// Record добавляет событие в журнал ученика
+func (l *ProgressLog) Record(userID int, event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(l.dir, os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.path(userID), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// Events возвращает события ученика начиная с since
+func (l *ProgressLog) Events(userID int, since time.Time) ([]Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.Open(l.path(userID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		if !event.Time.Before(since) {
+			events = append(events, event)
+		}
+	}
+	return events, scanner.Err()
+}
+
+func (l *ProgressLog) path(userID int) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%d.jsonl", userID))
+}
+
+// ProgressStats - сводка событий без участия модели
+type ProgressStats struct {
+	Questions      int
+	Quizzes        int
+	QuizScore      float64 // средняя доля правильных ответов
+	CardsReviewed  int
+	SessionMinutes float64
+	Problems       int     // задачи, решенные в режиме подсказок
+	Solutions      int     // задачи, для которых ученик попросил решение
+	HintLevel      float64 // средний достигнутый уровень подсказки
+}
+
+// Summarize считает сводку событий
+func Summarize(events []Event) ProgressStats {
+	var stats ProgressStats
+	quizTotal := 0.0
+	problems := make(map[string]struct {
+		level  float64
+		solved bool
+	})
+	for _, event := range events {
+		switch event.Type {
+		case EventChat:
+			stats.Questions++
+		case EventQuiz:
+			stats.Quizzes++
+			quizTotal += event.Value
+		case EventFlashcardReview:
+			stats.CardsReviewed++
+		case EventSession:
+			stats.SessionMinutes += event.Value
+		case EventHint:
+			problem := problems[event.Topic]
+			problem.level = max(problem.level, event.Value)
+			problem.solved = problem.solved || event.Detail == "solution"
+			problems[event.Topic] = problem
+		}
+	}
+	if stats.Quizzes > 0 {
+		stats.QuizScore = quizTotal / float64(stats.Quizzes)
+	}
+	for _, problem := range problems {
+		stats.Problems++
+		stats.HintLevel += problem.level
+		if problem.solved {
+			stats.Solutions++
+		}
+	}
+	if stats.Problems > 0 {
+		stats.HintLevel /= float64(stats.Problems)
+	}
+	return stats
+}
+
+// FormatEvents превращает события в текст для запроса к модели
+func FormatEvents(events []Event) string {
+	lines := make([]string, 0, len(events))
+	for _, event := range events {
+		lines = append(lines, event.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Sessions отслеживает учебные сессии: сессия заканчивается, если ученик молчит дольше gap
+type Sessions struct {
+	gap    time.Duration
+	active map[int]*session
+}
+
+type session struct {
+	start, last time.Time
+}
+
+// NewSessions создает трекер сессий
+func NewSessions(gap time.Duration) *Sessions {
+	return &Sessions{gap: gap, active: make(map[int]*session)}
+}
+
+// Touch отмечает активность ученика. Если предыдущая сессия закончилась, возвращает ее событие
+func (s *Sessions) Touch(userID int, now time.Time) (Event, bool) {
+	current, ok := s.active[userID]
+	if ok && now.Sub(current.last) <= s.gap {
+		current.last = now
+		return Event{}, false
+	}
+	s.active[userID] = &session{start: now, last: now}
+	if !ok {
+		return Event{}, false
+	}
+	return current.event(), true
+}
+
+// Expire завершает сессии, в которых ученик молчит дольше gap, и возвращает их события по ученикам
+func (s *Sessions) Expire(now time.Time) map[int]Event {
+	ended := make(map[int]Event)
+	for userID, current := range s.active {
+		if now.Sub(current.last) > s.gap {
+			ended[userID] = current.event()
+			delete(s.active, userID)
+		}
+	}
+	return ended
+}
+
+// event возвращает событие сессии. Одиночный вопрос считается минутой занятий
+func (s *session) event() Event {
+	minutes := s.last.Sub(s.start).Minutes()
+	if minutes < 1 {
+		minutes = 1
+	}
+	return Event{Time: s.start, Type: EventSession, Value: float64(int(minutes + 0.5))}
+}
+
+// DigestLog запоминает, когда учителям отправлялся еженедельный отчет, чтобы не повторять его после перезапуска
+type DigestLog struct {
+	mu   sync.Mutex
+	path string
+	sent map[int]time.Time
+}
+
+// LoadDigestLog читает progress/digests.json из каталога логов
+func LoadDigestLog(logsDir string) (*DigestLog, error) {
+	l := &DigestLog{path: filepath.Join(logsDir, "progress", "digests.json"), sent: make(map[int]time.Time)}
+	err := loadJSON(l.path, &l.sent)
+	return l, err
+}
+
+// LastSent возвращает время последнего отчета учителю
+func (l *DigestLog) LastSent(teacherID int) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sent[teacherID]
+}
+
+// MarkSent запоминает отправку отчета учителю
+func (l *DigestLog) MarkSent(teacherID int, at time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sent[teacherID] = at
+	return saveJSON(l.path, l.sent)
+}
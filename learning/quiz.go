@@ -0,0 +1,92 @@
+package learning
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Question - вопрос теста с вариантами ответа. Answer - индекс правильного варианта, начиная с 0
+type Question struct {
+	Question    string   `json:"question"`
+	Options     []string `json:"options"`
+	Answer      int      `json:"answer"`
+	Explanation string   `json:"explanation,omitempty"`
+}
+
+// Validate проверяет, что у вопроса есть текст, от двух до шести вариантов и правильный ответ среди них
+func (q Question) Validate() error {
+	if strings.TrimSpace(q.Question) == "" {
+		return fmt.Errorf("question has no text")
+	}
+	if len(q.Options) < 2 || len(q.Options) > 6 {
+		return fmt.Errorf("question %q has %d options", q.Question, len(q.Options))
+	}
+	if q.Answer < 0 || q.Answer >= len(q.Options) {
+		return fmt.Errorf("question %q has answer %d out of range", q.Question, q.Answer)
+	}
+	return nil
+}
+
+// OptionLabel возвращает букву варианта ответа: A, B, C...
+func OptionLabel(option int) string {
+	return string(rune('A' + option))
+}
+
+var quizCounter int64
+
+// Quiz - отправленный в чат тест. Каждый участник может ответить на каждый вопрос один раз
+type Quiz struct {
+	ID        string
+	ChatID    int64
+	ThreadID  int // тема форума, в которую отправлен тест, 0 вне тем
+	Topic     string
+	Questions []Question
+	Created   time.Time
+
+	answers map[int]map[int]int // ID пользователя -> вопрос -> выбранный вариант
+}
+
+// NewQuiz создает тест с коротким уникальным ID, пригодным для данных кнопок
+func NewQuiz(chatID int64, topic string, questions []Question) *Quiz {
+	id := strconv.FormatInt(time.Now().Unix()%100000, 36) + strconv.FormatInt(atomic.AddInt64(&quizCounter, 1), 36)
+	return &Quiz{
+		ID:        id,
+		ChatID:    chatID,
+		Topic:     topic,
+		Questions: questions,
+		Created:   time.Now(),
+		answers:   make(map[int]map[int]int),
+	}
+}
+
+// Answer записывает ответ пользователя. first - ответ на этот вопрос первый и засчитан,
+// done - пользователь ответил на все вопросы теста
+func (q *Quiz) Answer(userID, question, option int) (correct, first, done bool) {
+	if question < 0 || question >= len(q.Questions) {
+		return false, false, false
+	}
+	answers, ok := q.answers[userID]
+	if !ok {
+		answers = make(map[int]int)
+		q.answers[userID] = answers
+	}
+	if _, answered := answers[question]; answered {
+		return false, false, false
+	}
+
+	answers[question] = option
+	return option == q.Questions[question].Answer, true, len(answers) == len(q.Questions)
+}
+
+// Score возвращает число правильных ответов пользователя и число его ответов
+func (q *Quiz) Score(userID int) (correct, answered int) {
+	for question, option := range q.answers[userID] {
+		if option == q.Questions[question].Answer {
+			correct++
+		}
+	}
+	return correct, len(q.answers[userID])
+}
@@ -0,0 +1,124 @@
+package learning
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TopicScore - ответы ученика по одной теме
+type TopicScore struct {
+	Answered int `json:"answered"`
+	Correct  int `json:"correct"`
+}
+
+// StudentScore - результаты тестов ученика
+type StudentScore struct {
+	UserID   int                    `json:"user_id"`
+	Name     string                 `json:"name,omitempty"`
+	Quizzes  int                    `json:"quizzes"`
+	Answered int                    `json:"answered"`
+	Correct  int                    `json:"correct"`
+	Topics   map[string]*TopicScore `json:"topics,omitempty"`
+	LastQuiz string                 `json:"last_quiz,omitempty"` // дата последнего ответа, 2006-01-02
+}
+
+// ScoreStore хранит результаты тестов в файле quiz_scores.json каталога логов
+type ScoreStore struct {
+	mu     sync.Mutex
+	path   string
+	scores map[int]*StudentScore
+}
+
+// LoadScores читает результаты тестов из каталога логов
+func LoadScores(logsDir string) (*ScoreStore, error) {
+	s := &ScoreStore{path: filepath.Join(logsDir, "quiz_scores.json"), scores: make(map[int]*StudentScore)}
+	var scores []*StudentScore
+	if err := loadJSON(s.path, &scores); err != nil {
+		return s, err
+	}
+	for _, score := range scores {
+		s.scores[score.UserID] = score
+	}
+	return s, nil
+}
+
+// RecordAnswer засчитывает ответ ученика по теме и сохраняет результаты.
+// completed отмечает, что этим ответом ученик закончил тест
+func (s *ScoreStore) RecordAnswer(userID int, name, topic string, correct, completed bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	score, ok := s.scores[userID]
+	if !ok {
+		score = &StudentScore{UserID: userID}
+		s.scores[userID] = score
+	}
+	if name != "" {
+		score.Name = name
+	}
+	if score.Topics == nil {
+		score.Topics = make(map[string]*TopicScore)
+	}
+	topicScore, ok := score.Topics[topic]
+	if !ok {
+		topicScore = &TopicScore{}
+		score.Topics[topic] = topicScore
+	}
+
+	score.Answered++
+	topicScore.Answered++
+	if correct {
+		score.Correct++
+		topicScore.Correct++
+	}
+	if completed {
+		score.Quizzes++
+	}
+	score.LastQuiz = time.Now().Format("2006-01-02")
+
+	return s.saveLocked()
+}
+
+// Get возвращает копию результатов ученика
+func (s *ScoreStore) Get(userID int) (StudentScore, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	score, ok := s.scores[userID]
+	if !ok {
+		return StudentScore{}, false
+	}
+	return score.copy(), true
+}
+
+// List возвращает копии результатов всех учеников, отсортированные по ID
+func (s *ScoreStore) List() []StudentScore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scores := make([]StudentScore, 0, len(s.scores))
+	for _, score := range s.scores {
+		scores = append(scores, score.copy())
+	}
+	sort.Slice(scores, func(i, j int) bool { return scores[i].UserID < scores[j].UserID })
+	return scores
+}
+
+func (s *ScoreStore) saveLocked() error {
+	scores := make([]*StudentScore, 0, len(s.scores))
+	for _, score := range s.scores {
+		scores = append(scores, score)
+	}
+	sort.Slice(scores, func(i, j int) bool { return scores[i].UserID < scores[j].UserID })
+	return saveJSON(s.path, scores)
+}
+
+func (score *StudentScore) copy() StudentScore {
+	c := *score
+	c.Topics = make(map[string]*TopicScore, len(score.Topics))
+	for topic, topicScore := range score.Topics {
+		t := *topicScore
+		c.Topics[topic] = &t
+	}
+	return c
+}
@@ -0,0 +1,202 @@
+package learning
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Word - слово из словаря ученика с переводом на язык интерфейса и примером употребления
+type Word struct {
+	ID          int    `json:"id"`
+	Word        string `json:"word"`
+	Translation string `json:"translation"`
+	Example     string `json:"example,omitempty"`
+	// Note - почему слово попало в словарь, например ошибка ученика
+	Note        string `json:"note,omitempty"`
+	Added       string `json:"added"`
+	Drills      int    `json:"drills"`
+	Correct     int    `json:"correct"`
+	LastDrilled string `json:"last_drilled,omitempty"`
+}
+
+// Mastery возвращает долю правильных ответов на упражнениях, для новых слов - 0
+func (w Word) Mastery() float64 {
+	if w.Drills == 0 {
+		return 0
+	}
+	return float64(w.Correct) / float64(w.Drills)
+}
+
+// vocabulary - файл словаря одного пользователя
+type vocabulary struct {
+	UserID int    `json:"user_id"`
+	NextID int    `json:"next_id"`
+	Words  []Word `json:"words"`
+}
+
+// VocabStore хранит словари пользователей в каталоге vocab каталога логов, по файлу на пользователя
+type VocabStore struct {
+	mu    sync.Mutex
+	dir   string
+	vocab map[int]*vocabulary
+}
+
+// NewVocabStore создает хранилище словарей. Словари читаются с диска при первом обращении
+func NewVocabStore(logsDir string) *VocabStore {
+	return &VocabStore{dir: filepath.Join(logsDir, "vocab"), vocab: make(map[int]*vocabulary)}
+}
+
+// Add добавляет пользователю слова, пропуская те, что у него уже есть. Возвращает добавленные слова
+func (s *VocabStore) Add(userID int, words []Word) ([]Word, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, err := s.vocabularyLocked(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool)
+	for _, word := range v.Words {
+		known[normalizeTerm(word.Word)] = true
+	}
+
+	today := time.Now().Format(dateLayout)
+	var added []Word
+	for _, word := range words {
+		term := normalizeTerm(word.Word)
+		if term == "" || strings.TrimSpace(word.Translation) == "" || known[term] {
+			continue
+		}
+		known[term] = true
+		v.NextID++
+		added = append(added, Word{
+			ID:          v.NextID,
+			Word:        strings.TrimSpace(word.Word),
+			Translation: strings.TrimSpace(word.Translation),
+			Example:     strings.TrimSpace(word.Example),
+			Note:        strings.TrimSpace(word.Note),
+			Added:       today,
+		})
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+	v.Words = append(v.Words, added...)
+	return added, s.saveLocked(v)
+}
+
+// Remove удаляет слово из словаря пользователя. Возвращает false, если такого слова нет
+func (s *VocabStore) Remove(userID int, term string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, err := s.vocabularyLocked(userID)
+	if err != nil {
+		return false, err
+	}
+	for i, word := range v.Words {
+		if normalizeTerm(word.Word) == normalizeTerm(term) {
+			v.Words = append(v.Words[:i], v.Words[i+1:]...)
+			return true, s.saveLocked(v)
+		}
+	}
+	return false, nil
+}
+
+// Words возвращает слова пользователя в порядке добавления
+func (s *VocabStore) Words(userID int) ([]Word, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, err := s.vocabularyLocked(userID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]Word(nil), v.Words...), nil
+}
+
+// Get возвращает слово пользователя по ID
+func (s *VocabStore) Get(userID, wordID int) (Word, bool, error) {
+	words, err := s.Words(userID)
+	if err != nil {
+		return Word{}, false, err
+	}
+	for _, word := range words {
+		if word.ID == wordID {
+			return word, true, nil
+		}
+	}
+	return Word{}, false, nil
+}
+
+// RecordDrill записывает ответ на упражнение со словом
+func (s *VocabStore) RecordDrill(userID, wordID int, correct bool, now time.Time) (Word, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, err := s.vocabularyLocked(userID)
+	if err != nil {
+		return Word{}, err
+	}
+	for i := range v.Words {
+		if v.Words[i].ID == wordID {
+			v.Words[i].Drills++
+			if correct {
+				v.Words[i].Correct++
+			}
+			v.Words[i].LastDrilled = now.Format(dateLayout)
+			return v.Words[i], s.saveLocked(v)
+		}
+	}
+	return Word{}, fmt.Errorf("word %d not found", wordID)
+}
+
+// Drill выбирает слово для упражнения - хуже всего выученное из давно не повторявшихся - и до options-1
+// случайных других слов для вариантов ответа. Варианты перемешаны. Возвращает false, если слов меньше двух
+func Drill(words []Word, options int) (Word, []Word, bool) {
+	if len(words) < 2 {
+		return Word{}, nil, false
+	}
+	sorted := append([]Word(nil), words...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].LastDrilled != sorted[j].LastDrilled {
+			return sorted[i].LastDrilled < sorted[j].LastDrilled
+		}
+		return sorted[i].Mastery() < sorted[j].Mastery()
+	})
+	target := sorted[0]
+
+	choices := []Word{target}
+	for _, i := range rand.Perm(len(words)) {
+		if len(choices) >= options {
+			break
+		}
+		if words[i].ID != target.ID {
+			choices = append(choices, words[i])
+		}
+	}
+	rand.Shuffle(len(choices), func(i, j int) { choices[i], choices[j] = choices[j], choices[i] })
+	return target, choices, true
+}
+
+func (s *VocabStore) vocabularyLocked(userID int) (*vocabulary, error) {
+	if v, ok := s.vocab[userID]; ok {
+		return v, nil
+	}
+	v := &vocabulary{UserID: userID}
+	if err := loadJSON(s.path(userID), v); err != nil {
+		return nil, err
+	}
+	s.vocab[userID] = v
+	return v, nil
+}
+
+func (s *VocabStore) saveLocked(v *vocabulary) error {
+	return saveJSON(s.path(v.UserID), v)
+}
+
+func (s *VocabStore) path(userID int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%d.json", userID))
+}
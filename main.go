@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	"tutor/bot"
+	"tutor/cli"
+	conf "tutor/config"
+	"tutor/helper"
+	"tutor/sandbox"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "usage" {
+		if err := cli.RunUsage(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == sandbox.ExecCommand {
+		if err := sandbox.Exec(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	cfg, err := conf.FromEnv()
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+
+	api, err := telegram.NewBotAPI(cfg.TelegramToken)
+	if err != nil {
+		log.Fatalf("Error creating Telegram bot: %v", err)
+	}
+
+	tutorBot := bot.New(cfg, api, helper.NewOpenAIHelper(cfg))
+	if err := tutorBot.Run(); err != nil {
+		log.Fatalf("Error running bot: %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExecCommand - скрытая подкоманда бота, которая собирает файловую систему песочницы, устанавливает ограничения
+// ресурсов и запускает программу. Go не умеет делать это в дочернем процессе, поэтому для этого бот запускает сам себя
+const ExecCommand = "sandbox-exec"
+
+// Поддерживаемые языки фрагментов
+const (
+	Go     = "go"
+	Python = "python"
+)
+
+const (
+	// compileTimeout - время на компиляцию фрагмента Go. Первая компиляция заполняет кэш сборки и идет дольше
+	compileTimeout = 2 * time.Minute
+	// compileMemoryMB - память компилятора Go. Ему нужно больше, чем фрагменту
+	compileMemoryMB = 2048
+	// compileProcesses - сколько процессов и потоков может запустить компиляция
+	compileProcesses = 512
+	// maxProcesses - сколько процессов и потоков может запустить фрагмент. Программе Go нужно несколько потоков
+	maxProcesses = 64
+	// maxFileSize - наибольший файл, который может записать фрагмент
+	maxFileSize = 10 << 20
+)
+
+// systemDirs - каталоги хоста с программами и библиотеками, которые песочница видит только для чтения.
+// Остальная файловая система хоста, в том числе файлы бота, в песочнице не видна
+var systemDirs = []string{"/bin", "/sbin", "/lib", "/lib32", "/lib64", "/usr"}
+
+// Limits - ограничения запуска фрагмента. Процессорное время ограничивается так же, как время выполнения
+type Limits struct {
+	Timeout     time.Duration
+	MemoryMB    int
+	OutputBytes int
+}
+
+// Result - вывод и код завершения фрагмента. Если фрагмент Go не скомпилировался,
+// в Stderr - ошибки компилятора, а в ExitCode - код завершения компилятора
+type Result struct {
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	ExitCode  int    `json:"exit_code"`
+	TimedOut  bool   `json:"timed_out,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// Languages возвращает поддерживаемые языки
+func Languages() []string {
+	return []string{Go, Python}
+}
+
+// Run запускает фрагмент кода отдельным процессом во временном каталоге, который удаляется после запуска.
+// Процесс работает в своих пространствах имен пользователей, процессов, монтирования и сети: не видит сеть
+// и другие процессы, а корнем его файловой системы становится пустой tmpfs, в который для чтения смонтированы
+// только системные каталоги и установка языка. Рабочий каталог фрагмента - tmpfs ограниченного размера с копией
+// временного каталога, так что фрагмент не может заполнить диск хоста. Процессорное время, память,
+// размер файлов и число процессов ограничены, возможности root в пространстве имен сбрасываются перед запуском
+func Run(language, code string, limits Limits) (Result, error) {
+	tc, err := findToolchain(language)
+	if err != nil {
+		return Result{}, err
+	}
+	dir, err := os.MkdirTemp("", "tutor-sandbox-")
+	if err != nil {
+		return Result{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	env := []string{
+		"PATH=" + filepath.Dir(tc.program) + ":/usr/local/bin:/usr/bin:/bin",
+		"HOME=" + dir,
+		"TMPDIR=" + dir,
+		"LANG=C.UTF-8",
+	}
+	runLimits := rlimits{
+		cpuSeconds:  int((limits.Timeout + time.Second - 1) / time.Second),
+		memoryBytes: limits.MemoryMB << 20,
+		fileBytes:   maxFileSize,
+		processes:   maxProcesses,
+	}
+	runMounts := mounts{readOnly: append(append([]string(nil), systemDirs...), tc.dirs()...), scratch: []string{dir}}
+
+	var command []string
+	switch language {
+	case Go:
+		if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(code), 0600); err != nil {
+			return Result{}, err
+		}
+		// кэш сборки общий для всех запусков, иначе каждый фрагмент заново компилировал бы стандартную библиотеку.
+		// Запись в него и во временный каталог хоста доступна только компилятору, который не выполняет код
+		// фрагмента; сам фрагмент кэш не видит
+		cache := filepath.Join(os.TempDir(), "tutor-sandbox-gocache")
+		if err := os.MkdirAll(cache, 0700); err != nil {
+			return Result{}, err
+		}
+		buildEnv := append(env,
+			"GOROOT="+tc.root,
+			"GOCACHE="+cache,
+			"GOPATH="+filepath.Join(dir, "go"),
+			"GOTOOLCHAIN=local",
+			"GOPROXY=off",
+			"CGO_ENABLED=0",
+		)
+		buildLimits := rlimits{
+			cpuSeconds:  int(compileTimeout / time.Second),
+			memoryBytes: compileMemoryMB << 20,
+			processes:   compileProcesses,
+		}
+		buildMounts := mounts{readOnly: runMounts.readOnly, writable: []string{dir, cache}}
+		build, err := execute(dir, buildEnv, buildLimits, buildMounts, compileTimeout, limits.OutputBytes,
+			tc.program, "build", "-o", "main", "main.go")
+		if err != nil || build.ExitCode != 0 || build.TimedOut {
+			return build, err
+		}
+		// программа собрана без cgo и не нуждается в установке Go
+		runMounts.readOnly = systemDirs
+		command = []string{"./main"}
+	case Python:
+		if err := os.WriteFile(filepath.Join(dir, "main.py"), []byte(code), 0600); err != nil {
+			return Result{}, err
+		}
+		command = []string{tc.program, "-I", "main.py"}
+	}
+	return execute(dir, env, runLimits, runMounts, limits.Timeout, limits.OutputBytes, command...)
+}
+
+// toolchain - программа, которая компилирует или выполняет фрагменты языка, и каталог ее установки
+type toolchain struct {
+	program string
+	root    string
+}
+
+// dirs возвращает каталоги, которые нужны программе в песочнице
+func (t toolchain) dirs() []string {
+	dirs := []string{t.root}
+	if bin := filepath.Dir(t.program); !strings.HasPrefix(bin, t.root+string(filepath.Separator)) {
+		dirs = append(dirs, bin)
+	}
+	return dirs
+}
+
+var toolchains = struct {
+	sync.Mutex
+	found map[string]toolchain
+}{found: make(map[string]toolchain)}
+
+// findToolchain находит программу языка на хосте. Обертки вроде pyenv в песочнице не работают,
+// поэтому путь к настоящей программе и каталог установки сообщает сам язык
+func findToolchain(language string) (toolchain, error) {
+	toolchains.Lock()
+	defer toolchains.Unlock()
+	if tc, ok := toolchains.found[language]; ok {
+		return tc, nil
+	}
+
+	var lines []string
+	switch language {
+	case Go:
+		out, err := exec.Command("go", "env", "GOROOT").Output()
+		if err != nil {
+			return toolchain{}, fmt.Errorf("error finding the Go installation: %v", err)
+		}
+		root := strings.TrimSpace(string(out))
+		lines = []string{filepath.Join(root, "bin", "go"), root}
+	case Python:
+		out, err := exec.Command("python3", "-I", "-c", "import sys; print(sys.executable); print(sys.base_prefix)").Output()
+		if err != nil {
+			return toolchain{}, fmt.Errorf("error finding the Python installation: %v", err)
+		}
+		lines = strings.Split(strings.TrimSpace(string(out)), "\n")
+	default:
+		return toolchain{}, fmt.Errorf("unsupported language %q", language)
+	}
+	if len(lines) != 2 || !filepath.IsAbs(lines[0]) || !filepath.IsAbs(lines[1]) {
+		return toolchain{}, fmt.Errorf("unexpected %s installation paths %q", language, lines)
+	}
+	program, err := filepath.EvalSymlinks(lines[0])
+	if err != nil {
+		return toolchain{}, err
+	}
+	root, err := filepath.EvalSymlinks(lines[1])
+	if err != nil {
+		return toolchain{}, err
+	}
+	tc := toolchain{program: program, root: root}
+	toolchains.found[language] = tc
+	return tc, nil
+}
+
+// rlimits - ограничения ресурсов процесса, нулевые не устанавливаются
+type rlimits struct {
+	cpuSeconds  int
+	memoryBytes int
+	fileBytes   int
+	processes   int
+}
+
+// mounts - каталоги хоста, которые видны в песочнице по тем же путям. Вместо каталогов scratch монтируется
+// tmpfs ограниченного размера с копией их файлов, изменения в нем на хост не попадают
+type mounts struct {
+	readOnly []string
+	writable []string
+	scratch  []string
+}
+
+// execute запускает команду через ExecCommand с ограничениями ресурсов и изоляцией
+func execute(dir string, env []string, limits rlimits, dirs mounts, timeout time.Duration, outputBytes int, command ...string) (Result, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return Result{}, err
+	}
+	// точка монтирования корня песочницы; ее tmpfs виден только в пространстве имен песочницы
+	root, err := os.MkdirTemp("", "tutor-sandbox-root-")
+	if err != nil {
+		return Result{}, err
+	}
+	defer os.RemoveAll(root)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	list := string(filepath.ListSeparator)
+	args := append([]string{ExecCommand, strconv.Itoa(limits.cpuSeconds), strconv.Itoa(limits.memoryBytes),
+		strconv.Itoa(limits.fileBytes), strconv.Itoa(limits.processes), root,
+		strings.Join(dirs.readOnly, list), strings.Join(dirs.writable, list), strings.Join(dirs.scratch, list), "--"}, command...)
+	cmd := exec.CommandContext(ctx, self, args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	stdout := &limitedBuffer{limit: outputBytes}
+	stderr := &limitedBuffer{limit: outputBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = time.Second
+	if err := isolate(cmd); err != nil {
+		return Result{}, err
+	}
+
+	err = cmd.Run()
+	result := Result{
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		ExitCode:  -1,
+		TimedOut:  errors.Is(ctx.Err(), context.DeadlineExceeded),
+		Truncated: stdout.truncated || stderr.truncated,
+	}
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) && !result.TimedOut {
+		return result, fmt.Errorf("error running sandbox: %v", err)
+	}
+	return result, nil
+}
+
+// limitedBuffer сохраняет не больше limit байт вывода, остальное отбрасывает.
+// Запись не прерывается, чтобы процесс не завершился из-за закрытого канала
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - b.buf.Len(); remaining < len(p) {
+		b.truncated = true
+		if remaining > 0 {
+			b.buf.Write(p[:remaining])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
@@ -0,0 +1,291 @@
+package sandbox
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Константы Linux, которых нет в пакете syscall
+const (
+	// rlimitNproc - RLIMIT_NPROC. В пространстве имен пользователей ядро считает процессы и потоки песочницы
+	// отдельно от процессов пользователя бота
+	rlimitNproc     = 6
+	prSetNoNewPrivs = 38
+)
+
+// scratchSize - размер tmpfs рабочего каталога фрагмента, включая скопированные в него файлы
+const scratchSize = "16m"
+
+// devices - устройства, которые нужны программам в песочнице
+var devices = []string{"/dev/null", "/dev/zero", "/dev/random", "/dev/urandom"}
+
+// isolate запускает процесс в новых пространствах имен пользователей, процессов, монтирования, IPC и сети.
+// В новом пространстве сети есть только выключенный loopback, поэтому сеть недоступна.
+// Процесс получает PID 1, и при его завершении ядро завершает все запущенные им процессы. Пользователь бота
+// становится root пространства имен, чтобы Exec мог собрать файловую систему песочницы
+func isolate(cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC |
+			syscall.CLONE_NEWNET,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		Pdeathsig:   syscall.SIGKILL,
+	}
+	return nil
+}
+
+// Exec выполняет подкоманду ExecCommand: переносит процесс в корень песочницы, устанавливает ограничения
+// ресурсов, сбрасывает возможности root и заменяет процесс программой. Аргументы: <секунды процессора>
+// <байты памяти> <байты файлов> <процессы> <корень> <каталоги для чтения> <каталоги для записи>
+// <каталоги в tmpfs> -- <программа> [аргументы]. Каталоги разделяются ':', нулевое ограничение
+// не устанавливается. При успехе не возвращается
+func Exec(args []string) error {
+	if len(args) < 10 || args[8] != "--" {
+		return fmt.Errorf("usage: tutor %s <cpu seconds> <memory bytes> <file bytes> <processes> <root> "+
+			"<read-only dirs> <writable dirs> <scratch dirs> -- <program> [args]", ExecCommand)
+	}
+
+	dirs := mounts{readOnly: splitDirs(args[5]), writable: splitDirs(args[6]), scratch: splitDirs(args[7])}
+	if err := enterRoot(args[4], dirs); err != nil {
+		return fmt.Errorf("error building the sandbox file system: %v", err)
+	}
+
+	resources := []int{syscall.RLIMIT_CPU, syscall.RLIMIT_DATA, syscall.RLIMIT_FSIZE, rlimitNproc}
+	for i, resource := range resources {
+		value, err := strconv.ParseUint(args[i], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid limit %q: %v", args[i], err)
+		}
+		if value == 0 {
+			continue
+		}
+		if err := syscall.Setrlimit(resource, &syscall.Rlimit{Cur: value, Max: value}); err != nil {
+			return fmt.Errorf("error setting resource limit: %v", err)
+		}
+	}
+	if err := syscall.Setrlimit(syscall.RLIMIT_CORE, &syscall.Rlimit{}); err != nil {
+		return fmt.Errorf("error disabling core dumps: %v", err)
+	}
+	if err := dropCapabilities(); err != nil {
+		return fmt.Errorf("error dropping capabilities: %v", err)
+	}
+
+	path, err := exec.LookPath(args[9])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, args[9:], os.Environ())
+}
+
+func splitDirs(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, string(filepath.ListSeparator))
+}
+
+// enterRoot монтирует tmpfs в root, монтирует в него каталоги хоста по тем же путям, свежий /proc и устройства,
+// и делает его корнем процесса. Старый корень отмонтируется, так что файлы хоста вне каталогов недоступны
+func enterRoot(root string, dirs mounts) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	// иначе монтирования песочницы распространились бы на хост
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return err
+	}
+	if err := syscall.Mount("tmpfs", root, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "size=1m,mode=0755"); err != nil {
+		return err
+	}
+
+	for _, dir := range dirs.readOnly {
+		if err := bind(root, dir, syscall.MS_RDONLY|syscall.MS_NODEV); err != nil {
+			return err
+		}
+	}
+	for _, dir := range dirs.writable {
+		if err := bind(root, dir, syscall.MS_NODEV); err != nil {
+			return err
+		}
+	}
+	for _, dir := range dirs.scratch {
+		if err := scratch(root, dir); err != nil {
+			return err
+		}
+	}
+	for _, device := range devices {
+		if err := bind(root, device, 0); err != nil {
+			return err
+		}
+	}
+
+	// /proc нового пространства процессов показывает только процессы песочницы. Ядро не разрешает смонтировать
+	// его, если /proc хоста частично скрыт, как в некоторых контейнерах; тогда песочница работает без /proc
+	proc := filepath.Join(root, "proc")
+	if err := os.Mkdir(proc, 0555); err != nil {
+		return err
+	}
+	syscall.Mount("proc", proc, "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, "")
+
+	oldRoot := filepath.Join(root, ".oldroot")
+	if err := os.Mkdir(oldRoot, 0700); err != nil {
+		return err
+	}
+	if err := syscall.PivotRoot(root, oldRoot); err != nil {
+		return err
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+	if err := syscall.Unmount("/.oldroot", syscall.MNT_DETACH); err != nil {
+		return err
+	}
+	if err := os.Remove("/.oldroot"); err != nil {
+		return err
+	}
+	if err := syscall.Mount("", "/", "", syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, ""); err != nil {
+		return err
+	}
+	return os.Chdir(wd)
+}
+
+// bind монтирует путь хоста в root по тому же пути с флагами flags. Символические ссылки, например /lib
+// в системах с объединенным /usr, копируются. Отсутствующие пути пропускаются
+func bind(root, path string, flags uintptr) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, target)
+	case info.IsDir():
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+	default:
+		if err := os.WriteFile(target, nil, 0644); err != nil {
+			return err
+		}
+	}
+
+	if err := syscall.Mount(path, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return err
+	}
+	locked, err := lockedFlags(path)
+	if err != nil {
+		return err
+	}
+	return syscall.Mount("", target, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_NOSUID|flags|locked, "")
+}
+
+// scratch монтирует в root по пути dir tmpfs размера scratchSize и копирует в него файлы каталога dir хоста.
+// Подкаталоги не копируются: фрагменту нужны только исходный код и собранная программа
+func scratch(root, dir string) error {
+	target := filepath.Join(root, dir)
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount("tmpfs", target, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "size="+scratchSize+",mode=0700"); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if err := copyFile(filepath.Join(dir, entry.Name()), filepath.Join(target, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(from, to string) error {
+	info, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// lockedFlags возвращает флаги монтирования пути на хосте, которые в пространстве имен пользователей нельзя
+// снять при повторном монтировании
+func lockedFlags(path string) (uintptr, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	// значения ST_* из statvfs
+	mapping := []struct {
+		st int64
+		ms uintptr
+	}{
+		{1, syscall.MS_RDONLY},
+		{2, syscall.MS_NOSUID},
+		{4, syscall.MS_NODEV},
+		{8, syscall.MS_NOEXEC},
+		{1024, syscall.MS_NOATIME},
+		{2048, syscall.MS_NODIRATIME},
+		{4096, syscall.MS_RELATIME},
+	}
+	var flags uintptr
+	for _, m := range mapping {
+		if int64(stat.Flags)&m.st != 0 {
+			flags |= m.ms
+		}
+	}
+	return flags, nil
+}
+
+// dropCapabilities очищает ограничивающий набор возможностей и запрещает их получение, так что программа
+// после exec не сохраняет возможностей root пространства имен
+func dropCapabilities() error {
+	for capability := 0; ; capability++ {
+		_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_CAPBSET_DROP, uintptr(capability), 0)
+		if errno == syscall.EINVAL {
+			break
+		}
+		if errno != 0 {
+			return errno
+		}
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
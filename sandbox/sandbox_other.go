@@ -0,0 +1,18 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// isolate не поддерживается: изоляция использует пространства имен Linux
+func isolate(cmd *exec.Cmd) error {
+	return fmt.Errorf("code execution sandbox is only supported on Linux")
+}
+
+// Exec не поддерживается вне Linux
+func Exec(args []string) error {
+	return fmt.Errorf("code execution sandbox is only supported on Linux")
+}
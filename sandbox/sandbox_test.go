@@ -0,0 +1,149 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain lets Run start the test binary as the sandbox, like the bot does with its own executable.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == ExecCommand {
+		if err := Exec(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(127)
+	}
+	os.Exit(m.Run())
+}
+
+var testLimits = Limits{Timeout: 10 * time.Second, MemoryMB: 256, OutputBytes: 1000}
+
+// runPython runs code with Python in the sandbox, skipping the test where the sandbox can't work.
+func runPython(t *testing.T, code string, limits Limits) Result {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("the sandbox only works on Linux")
+	}
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is not installed")
+	}
+	result, err := Run(Python, code, limits)
+	if err != nil {
+		t.Skipf("user namespaces are not available: %v", err)
+	}
+	if result.ExitCode == 127 && strings.Contains(result.Stderr, "sandbox") {
+		t.Skipf("the sandbox can't be built here: %s", result.Stderr)
+	}
+	return result
+}
+
+func TestRunPython(t *testing.T) {
+	result := runPython(t, "print(6 * 7)", testLimits)
+	if result.ExitCode != 0 || result.Stdout != "42\n" || result.TimedOut || result.Truncated {
+		t.Errorf("result = %+v, want 42", result)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	limits := testLimits
+	limits.Timeout = time.Second
+	start := time.Now()
+	result := runPython(t, "while True:\n    pass", limits)
+	if !result.TimedOut || result.ExitCode == 0 {
+		t.Errorf("result = %+v, want a timeout", result)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the snippet ran for %v", elapsed)
+	}
+}
+
+func TestRunTruncatesOutput(t *testing.T) {
+	result := runPython(t, "print('x' * 100000)", testLimits)
+	if !result.Truncated || len(result.Stdout) != testLimits.OutputBytes || result.ExitCode != 0 {
+		t.Errorf("got %d bytes, truncated %t, exit code %d, want %d bytes truncated",
+			len(result.Stdout), result.Truncated, result.ExitCode, testLimits.OutputBytes)
+	}
+}
+
+func TestRunNoNetwork(t *testing.T) {
+	code := `import socket
+try:
+    socket.create_connection(("1.1.1.1", 53), timeout=2)
+    print("connected")
+except OSError as e:
+    print("error", e.errno)`
+	result := runPython(t, code, testLimits)
+	if result.ExitCode != 0 || !strings.HasPrefix(result.Stdout, "error") {
+		t.Errorf("result = %+v, want a connection error", result)
+	}
+}
+
+func TestRunHidesHost(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("TUTOR_SANDBOX_SECRET", "secret")
+	defer os.Unsetenv("TUTOR_SANDBOX_SECRET")
+
+	code := fmt.Sprintf(`import os
+print(os.path.exists(%q))
+environ = b""
+for pid in os.listdir("/proc") if os.path.isdir("/proc") else []:
+    try:
+        environ += open("/proc/%%s/environ" %% pid, "rb").read()
+    except OSError:
+        pass
+print(b"TUTOR_SANDBOX_SECRET" in environ)
+try:
+    open("/usr/sandbox-test", "w")
+    print("writable")
+except OSError:
+    print("read-only")`, wd)
+	result := runPython(t, code, testLimits)
+	if result.ExitCode != 0 || result.Stdout != "False\nFalse\nread-only\n" {
+		t.Errorf("result = %+v, want the host files, processes and system directories hidden or read-only", result)
+	}
+}
+
+func TestRunLimitsDiskSpace(t *testing.T) {
+	code := `import errno
+try:
+    for i in range(10):
+        with open("file%d" % i, "wb") as f:
+            f.write(b"0" * (5 << 20))
+    print("written")
+except OSError as e:
+    print(errno.errorcode[e.errno])`
+	result := runPython(t, code, testLimits)
+	if result.ExitCode != 0 || result.Stdout != "ENOSPC\n" {
+		t.Errorf("result = %+v, want the work directory full", result)
+	}
+}
+
+func TestRunGo(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the sandbox only works on Linux")
+	}
+	if testing.Short() {
+		t.Skip("compiling in the sandbox is slow")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	code := "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(6 * 7) }\n"
+	limits := testLimits
+	limits.Timeout = time.Minute
+	result, err := Run(Go, code, limits)
+	if err != nil {
+		t.Skipf("user namespaces are not available: %v", err)
+	}
+	if result.ExitCode != 0 || result.Stdout != "42\n" {
+		t.Errorf("result = %+v, want 42", result)
+	}
+}
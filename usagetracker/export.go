@@ -0,0 +1,95 @@
+package usagetracker
+
+import (
+	"sort"
+)
+
+// Record - одна строка выгрузки: использование пользователя за день в одной категории.
+// IncludedIn - категория, в которую уже входят количество и стоимость записи, их не нужно складывать с ней
+type Record struct {
+	UserID     int     `json:"user_id"`
+	UserName   string  `json:"user_name"`
+	Date       string  `json:"date"`
+	Category   string  `json:"category"`
+	Model      string  `json:"model,omitempty"`
+	Amount     int     `json:"amount"`
+	Cost       float64 `json:"cost"`
+	IncludedIn string  `json:"included_in,omitempty"`
+}
+
+// Records возвращает использование трекера по дням и категориям в диапазоне дат [from, to] (формат 2006-01-02,
+// пустая граница не ограничивает). Токены разбиваются по моделям, если разбивка записана;
+// токены, записанные до появления разбивки, выгружаются без модели
+func (ut *UsageTracker) Records(from, to string, tokensPrice float64, imagePrices []float64, minutePrice float64, embeddingPrice float64) []Record {
+	inRange := func(date string) bool {
+		return (from == "" || date >= from) && (to == "" || date <= to)
+	}
+	record := func(date, category, model string, amount int, cost float64) Record {
+		return Record{UserID: ut.UserID, UserName: ut.Name, Date: date, Category: category, Model: model, Amount: amount, Cost: cost}
+	}
+
+	var records []Record
+	for date, val := range ut.UsageHistory["chat_tokens"] {
+		if !inRange(date) {
+			continue
+		}
+		remaining := val.(int)
+		if byModel, ok := ut.UsageHistory["chat_tokens_by_model"][date].(map[string]int); ok {
+			for model, tokens := range byModel {
+				records = append(records, record(date, "chat_tokens", model, tokens, round(float64(tokens)*tokensPrice/1000, 6)))
+				remaining -= tokens
+			}
+		}
+		if remaining > 0 {
+			records = append(records, record(date, "chat_tokens", "", remaining, round(float64(remaining)*tokensPrice/1000, 6)))
+		}
+	}
+
+	for date, val := range ut.UsageHistory["number_images"] {
+		if !inRange(date) {
+			continue
+		}
+		cost := 0.0
+		for i, count := range val.([]int) {
+			if i < len(imagePrices) {
+				cost += float64(count) * imagePrices[i]
+			}
+		}
+		records = append(records, record(date, "images", "", sum(val.([]int)), round(cost, 6)))
+	}
+
+	for date, val := range ut.UsageHistory["transcription_seconds"] {
+		if !inRange(date) {
+			continue
+		}
+		records = append(records, record(date, "transcription_seconds", "", val.(int), round(float64(val.(int))*minutePrice/60, 2)))
+	}
+
+	// токены исправлений грамматики записаны и в chat_tokens, отдельная строка показывает их долю
+	for date, val := range ut.UsageHistory["correction_tokens"] {
+		if !inRange(date) {
+			continue
+		}
+		correction := record(date, "correction_tokens", "", val.(int), round(float64(val.(int))*tokensPrice/1000, 6))
+		correction.IncludedIn = "chat_tokens"
+		records = append(records, correction)
+	}
+
+	for date, val := range ut.UsageHistory["embedding_tokens"] {
+		if !inRange(date) {
+			continue
+		}
+		records = append(records, record(date, "embedding_tokens", "", val.(int), round(float64(val.(int))*embeddingPrice/1000, 6)))
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Date != records[j].Date {
+			return records[i].Date < records[j].Date
+		}
+		if records[i].Category != records[j].Category {
+			return records[i].Category < records[j].Category
+		}
+		return records[i].Model < records[j].Model
+	})
+	return records
+}
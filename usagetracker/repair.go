@@ -0,0 +1,150 @@
+package usagetracker
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// RepairResult - сохраненные и пересчитанные из истории затраты трекера (ключи day, month, all_time)
+type RepairResult struct {
+	UserID     int
+	Name       string
+	Stored     map[string]float64
+	Recomputed map[string]float64
+	Written    bool // файл трекера перезаписан пересчитанными значениями
+}
+
+// Discrepancies возвращает ключи, по которым сохраненное и пересчитанное значения расходятся больше чем на tolerance
+func (r RepairResult) Discrepancies(tolerance float64) []string {
+	var keys []string
+	for _, key := range []string{"day", "month", "all_time"} {
+		if math.Abs(r.Stored[key]-r.Recomputed[key]) > tolerance {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// RecomputeCosts пересчитывает затраты за сегодня, текущий месяц и все время из usage_history по текущим ценам.
+// Если затраты обнулялись через /resetusage, учитывается только использование после обнуления
+func (ut *UsageTracker) RecomputeCosts(tokensPrice float64, imagePrices []float64, minutePrice float64, embeddingPrice float64) map[string]float64 {
+	today := time.Now().Format("2006-01-02")
+	month := yearMonth(time.Now())
+
+	dates := make(map[string]bool)
+	for _, category := range []string{"chat_tokens", "number_images", "transcription_seconds", "embedding_tokens"} {
+		for date := range ut.UsageHistory[category] {
+			dates[date] = true
+		}
+	}
+
+	resetAt, resetUsage, reset := ut.resetMarker()
+	dayCost := func(date string) float64 {
+		switch {
+		case !reset || date > resetAt:
+			return ut.GetDayCost(date, tokensPrice, imagePrices, minutePrice, embeddingPrice)
+		case date == resetAt:
+			return ut.dayUsage(date).minus(resetUsage).cost(tokensPrice, imagePrices, minutePrice, embeddingPrice)
+		default:
+			return 0
+		}
+	}
+
+	costMonth, costAllTime := 0.0, 0.0
+	for date := range dates {
+		cost := dayCost(date)
+		if strings.HasPrefix(date, month) {
+			costMonth += cost
+		}
+		costAllTime += cost
+	}
+	if !reset {
+		// без обнуления all_time считается по суммарному использованию, как в InitializeMissingAllTimeCost
+		costAllTime = ut.InitializeAllTimeCost(tokensPrice, imagePrices, minutePrice, embeddingPrice)
+	}
+
+	return map[string]float64{
+		"day":      dayCost(today),
+		"month":    costMonth,
+		"all_time": costAllTime,
+	}
+}
+
+// resetMarker возвращает дату последнего обнуления затрат и использование за этот день до обнуления,
+// см. ResetCurrentCosts
+func (ut *UsageTracker) resetMarker() (string, dayUsage, bool) {
+	currentCost := ut.Usage["current_cost"].(map[string]interface{})
+	date, ok := currentCost["reset_at"].(string)
+	if !ok {
+		return "", dayUsage{}, false
+	}
+	// после загрузки из JSON числа - float64, а массив - []interface{}
+	saved, _ := currentCost["reset_usage"].(map[string]interface{})
+	usage := dayUsage{
+		chatTokens:           toInt(saved["chat_tokens"]),
+		transcriptionSeconds: toInt(saved["transcription_seconds"]),
+		embeddingTokens:      toInt(saved["embedding_tokens"]),
+	}
+	switch images := saved["number_images"].(type) {
+	case []int:
+		usage.images = images
+	case []interface{}:
+		for _, count := range images {
+			usage.images = append(usage.images, toInt(count))
+		}
+	}
+	return date, usage, true
+}
+
+func toInt(val interface{}) int {
+	switch v := val.(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// minus возвращает использование сверх other
+func (u dayUsage) minus(other dayUsage) dayUsage {
+	images := append([]int(nil), u.images...)
+	for i := range images {
+		if i < len(other.images) {
+			images[i] = max(images[i]-other.images[i], 0)
+		}
+	}
+	return dayUsage{
+		chatTokens:           max(u.chatTokens-other.chatTokens, 0),
+		images:               images,
+		transcriptionSeconds: max(u.transcriptionSeconds-other.transcriptionSeconds, 0),
+		embeddingTokens:      max(u.embeddingTokens-other.embeddingTokens, 0),
+	}
+}
+
+// Repair сравнивает сохраненные затраты с пересчитанными из истории и, если write, перезаписывает файл трекера.
+// Файл перезаписывается, только если значения расходятся больше чем на tolerance
+func (ut *UsageTracker) Repair(tokensPrice float64, imagePrices []float64, minutePrice float64, embeddingPrice float64, tolerance float64, write bool) RepairResult {
+	current := ut.GetCurrentCost()
+	result := RepairResult{
+		UserID: ut.UserID,
+		Name:   ut.Name,
+		Stored: map[string]float64{
+			"day":      current["cost_today"],
+			"month":    current["cost_month"],
+			"all_time": current["cost_all_time"],
+		},
+		Recomputed: ut.RecomputeCosts(tokensPrice, imagePrices, minutePrice, embeddingPrice),
+	}
+
+	if write && len(result.Discrepancies(tolerance)) > 0 {
+		result.Written = true
+		for key, val := range result.Recomputed {
+			ut.CostMap[key] = val
+		}
+		ut.Usage["current_cost"].(map[string]interface{})["last_update"] = time.Now().Format("2006-01-02")
+		ut.saveUsage()
+	}
+	return result
+}
@@ -0,0 +1,152 @@
+package usagetracker
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DaySpend - затраты за один день
+type DaySpend struct {
+	Date string
+	Cost float64
+}
+
+// LoadUsageTrackers загружает трекеры всех пользователей и чатов из logsDir.
+// Файлы, имя которых не является ID, и поврежденные файлы пропускаются
+func LoadUsageTrackers(logsDir string) ([]*UsageTracker, error) {
+	files, err := filepath.Glob(filepath.Join(logsDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var trackers []*UsageTracker
+	for _, file := range files {
+		id, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err != nil {
+			continue
+		}
+		tracker, err := LoadUsageTracker(id, "", logsDir)
+		if err != nil {
+			log.Printf("Skipping usage tracker %s: %v", file, err)
+			continue
+		}
+		if name, ok := tracker.Usage["user_name"].(string); ok {
+			tracker.Name = name
+		}
+		trackers = append(trackers, tracker)
+	}
+	return trackers, nil
+}
+
+// IsUserTracker сообщает, принадлежит ли трекер пользователю. Трекеры гостей и групповых чатов
+// имеют отрицательный ID и дублируют затраты пользователей, поэтому в суммах не учитываются
+func (ut *UsageTracker) IsUserTracker() bool {
+	return ut.UserID > 0
+}
+
+// ReportsTrackerID - ID трекера отчетов о прогрессе и еженедельных отчетов, которые оплачивает организация
+const ReportsTrackerID = -2
+
+// IsCountedInTotals сообщает, входят ли затраты трекера в итоги организации: кроме трекеров пользователей
+// в них входит трекер отчетов, затраты которого никому из пользователей не списываются
+func (ut *UsageTracker) IsCountedInTotals() bool {
+	return ut.IsUserTracker() || ut.UserID == ReportsTrackerID
+}
+
+// GetAllTimeUsage возвращает количество токенов, изображений и секунд транскрипции за все время
+func (ut *UsageTracker) GetAllTimeUsage() (int, int, int) {
+	tokens := 0
+	for _, val := range ut.UsageHistory["chat_tokens"] {
+		tokens += val.(int)
+	}
+	images := 0
+	for _, val := range ut.UsageHistory["number_images"] {
+		images += sum(val.([]int))
+	}
+	seconds := 0
+	for _, val := range ut.UsageHistory["transcription_seconds"] {
+		seconds += val.(int)
+	}
+	return tokens, images, seconds
+}
+
+// GetDayCost пересчитывает затраты за день (формат 2006-01-02) из истории использования по текущим ценам
+func (ut *UsageTracker) GetDayCost(date string, tokensPrice float64, imagePrices []float64, minutePrice float64, embeddingPrice float64) float64 {
+	return ut.dayUsage(date).cost(tokensPrice, imagePrices, minutePrice, embeddingPrice)
+}
+
+// dayUsage - платное использование за день из usage_history
+type dayUsage struct {
+	chatTokens           int
+	images               []int
+	transcriptionSeconds int
+	embeddingTokens      int
+}
+
+func (ut *UsageTracker) dayUsage(date string) dayUsage {
+	var usage dayUsage
+	usage.chatTokens, _ = ut.UsageHistory["chat_tokens"][date].(int)
+	usage.images, _ = ut.UsageHistory["number_images"][date].([]int)
+	usage.transcriptionSeconds, _ = ut.UsageHistory["transcription_seconds"][date].(int)
+	usage.embeddingTokens, _ = ut.UsageHistory["embedding_tokens"][date].(int)
+	return usage
+}
+
+func (u dayUsage) cost(tokensPrice float64, imagePrices []float64, minutePrice float64, embeddingPrice float64) float64 {
+	cost := round(float64(u.chatTokens)*tokensPrice/1000, 6)
+	for i, count := range u.images {
+		if i < len(imagePrices) {
+			cost += float64(count) * imagePrices[i]
+		}
+	}
+	cost += round(float64(u.transcriptionSeconds)*minutePrice/60, 2)
+	cost += round(float64(u.embeddingTokens)*embeddingPrice/1000, 6)
+	return cost
+}
+
+// DailySpend суммирует затраты организации за последние days дней, от старых к новым
+func DailySpend(trackers []*UsageTracker, days int, tokensPrice float64, imagePrices []float64, minutePrice float64, embeddingPrice float64) []DaySpend {
+	spend := make([]DaySpend, 0, days)
+	today := time.Now()
+	for i := days - 1; i >= 0; i-- {
+		date := today.AddDate(0, 0, -i).Format("2006-01-02")
+		day := DaySpend{Date: date}
+		for _, tracker := range trackers {
+			if tracker.IsCountedInTotals() {
+				day.Cost += tracker.GetDayCost(date, tokensPrice, imagePrices, minutePrice, embeddingPrice)
+			}
+		}
+		spend = append(spend, day)
+	}
+	return spend
+}
+
+// TopUsers возвращает до limit пользователей с наибольшими затратами за текущий месяц
+func TopUsers(trackers []*UsageTracker, limit int) []*UsageTracker {
+	var users []*UsageTracker
+	for _, tracker := range trackers {
+		if tracker.IsUserTracker() {
+			users = append(users, tracker)
+		}
+	}
+	sort.SliceStable(users, func(i, j int) bool {
+		return users[i].GetCurrentCost()["cost_month"] > users[j].GetCurrentCost()["cost_month"]
+	})
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users
+}
+
+// String возвращает имя трекера или его ID, если имя не сохранено
+func (ut *UsageTracker) String() string {
+	if ut.Name != "" {
+		return ut.Name
+	}
+	return fmt.Sprintf("%d", ut.UserID)
+}
@@ -18,21 +18,32 @@ type UsageTracker struct {
 	UserFile     string
 	Usage        map[string]interface{}
 	UsageHistory map[string]map[string]interface{}
+
+	// allTimeMissing - в файле нет all_time, его нужно вычислить из истории, см. InitializeMissingAllTimeCost
+	allTimeMissing bool
 }
 
 // NewUsageTracker создает новый UsageTracker с заданным UserID и именем
 func NewUsageTracker(userID int, userName string, logsDir string) *UsageTracker {
+	tracker, err := LoadUsageTracker(userID, userName, logsDir)
+	if err != nil {
+		panic(err)
+	}
+	return tracker
+}
+
+// LoadUsageTracker работает как NewUsageTracker, но возвращает ошибку, если файл трекера не читается
+func LoadUsageTracker(userID int, userName string, logsDir string) (*UsageTracker, error) {
 	userFile := filepath.Join(logsDir, fmt.Sprintf("%d.json", userID))
 
 	usage := make(map[string]interface{})
 	if _, err := os.Stat(userFile); err == nil {
 		data, err := ioutil.ReadFile(userFile)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		err = json.Unmarshal(data, &usage)
-		if err != nil {
-			panic(err)
+		if err = json.Unmarshal(data, &usage); err != nil {
+			return nil, fmt.Errorf("error unmarshalling %s: %v", userFile, err)
 		}
 	} else {
 		os.MkdirAll(logsDir, os.ModePerm)
@@ -52,14 +63,80 @@ func NewUsageTracker(userID int, userName string, logsDir string) *UsageTracker
 		}
 	}
 
+	currentCost, _ := usage["current_cost"].(map[string]interface{})
+	if currentCost == nil {
+		currentCost = map[string]interface{}{"last_update": time.Now().Format("2006-01-02")}
+		usage["current_cost"] = currentCost
+	}
+	_, hasAllTime := currentCost["all_time"]
+	history, _ := usage["usage_history"].(map[string]interface{})
+
 	return &UsageTracker{
-		UserID:       userID,
-		Name:         userName,
-		UserFile:     userFile,
-		Usage:        usage,
-		CostMap:      usage["current_cost"].(map[string]float64),
-		UsageHistory: usage["usage_history"].(map[string]map[string]interface{}),
+		UserID:         userID,
+		Name:           userName,
+		UserFile:       userFile,
+		Usage:          usage,
+		CostMap:        normalizeCostMap(currentCost),
+		UsageHistory:   normalizeUsageHistory(history),
+		allTimeMissing: !hasAllTime,
+	}, nil
+}
+
+// normalizeCostMap приводит значения current_cost к float64 (в JSON все числа float64, в новом файле могут быть int)
+func normalizeCostMap(currentCost map[string]interface{}) map[string]float64 {
+	costMap := map[string]float64{"day": 0.0, "month": 0.0, "all_time": 0.0}
+	for _, key := range []string{"day", "month", "all_time"} {
+		if val, ok := currentCost[key].(float64); ok {
+			costMap[key] = val
+		}
 	}
+	return costMap
+}
+
+// normalizeUsageHistory приводит usage_history к типам, с которыми работают методы трекера: int для chat_tokens,
+// transcription_seconds, correction_tokens и embedding_tokens, []int для number_images
+func normalizeUsageHistory(history map[string]interface{}) map[string]map[string]interface{} {
+	normalized := map[string]map[string]interface{}{
+		"chat_tokens":           make(map[string]interface{}),
+		"transcription_seconds": make(map[string]interface{}),
+		"number_images":         make(map[string]interface{}),
+		"correction_tokens":     make(map[string]interface{}),
+		"embedding_tokens":      make(map[string]interface{}),
+	}
+	for category, entries := range history {
+		if _, ok := normalized[category]; !ok {
+			normalized[category] = make(map[string]interface{})
+		}
+		days, ok := entries.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for day, val := range days {
+			switch v := val.(type) {
+			case float64:
+				normalized[category][day] = int(v)
+			case map[string]interface{}:
+				counts := make(map[string]int, len(v))
+				for key, c := range v {
+					if f, ok := c.(float64); ok {
+						counts[key] = int(f)
+					}
+				}
+				normalized[category][day] = counts
+			case []interface{}:
+				counts := make([]int, len(v))
+				for i, c := range v {
+					if f, ok := c.(float64); ok {
+						counts[i] = int(f)
+					}
+				}
+				normalized[category][day] = counts
+			default:
+				normalized[category][day] = val
+			}
+		}
+	}
+	return normalized
 }
 
 // AddChatTokens добавляет использованные токены в историю использования и обновляет текущую стоимость
@@ -77,6 +154,90 @@ func (ut *UsageTracker) AddChatTokens(tokens int, tokensPrice float64) {
 	ut.saveUsage()
 }
 
+// AddChatTokensForModel добавляет токены как AddChatTokens и дополнительно записывает их в разбивку по моделям
+func (ut *UsageTracker) AddChatTokensForModel(tokens int, tokensPrice float64, model string) {
+	today := time.Now().Format("2006-01-02")
+	if _, ok := ut.UsageHistory["chat_tokens_by_model"]; !ok {
+		ut.UsageHistory["chat_tokens_by_model"] = make(map[string]interface{})
+	}
+	if val, ok := ut.UsageHistory["chat_tokens_by_model"][today]; ok {
+		val.(map[string]int)[model] += tokens
+	} else {
+		ut.UsageHistory["chat_tokens_by_model"][today] = map[string]int{model: tokens}
+	}
+
+	ut.AddChatTokens(tokens, tokensPrice)
+}
+
+// AddCorrectionTokens добавляет токены проверки грамматики как AddChatTokensForModel и дополнительно
+// записывает их в отдельную категорию correction_tokens, чтобы расходы на исправления были видны отдельно
+func (ut *UsageTracker) AddCorrectionTokens(tokens int, tokensPrice float64, model string) {
+	today := time.Now().Format("2006-01-02")
+	if val, ok := ut.UsageHistory["correction_tokens"][today]; ok {
+		ut.UsageHistory["correction_tokens"][today] = val.(int) + tokens
+	} else {
+		ut.UsageHistory["correction_tokens"][today] = tokens
+	}
+
+	ut.AddChatTokensForModel(tokens, tokensPrice, model)
+}
+
+// GetCurrentCorrectionTokens возвращает количество токенов проверки грамматики за сегодня и за этот месяц.
+// Они уже входят в GetCurrentTokenUsage
+func (ut *UsageTracker) GetCurrentCorrectionTokens() (int, int) {
+	today := time.Now().Format("2006-01-02")
+	month := yearMonth(time.Now())
+
+	usageDay := 0
+	if val, ok := ut.UsageHistory["correction_tokens"][today]; ok {
+		usageDay = val.(int)
+	}
+
+	usageMonth := 0
+	for dateStr, tokens := range ut.UsageHistory["correction_tokens"] {
+		if strings.HasPrefix(dateStr, month) {
+			usageMonth += tokens.(int)
+		}
+	}
+
+	return usageDay, usageMonth
+}
+
+// AddEmbeddingTokens добавляет токены эмбеддингов документов в категорию embedding_tokens и обновляет текущие затраты.
+// Эмбеддинги стоят намного дешевле токенов чата, поэтому считаются по своей цене и в chat_tokens не входят
+func (ut *UsageTracker) AddEmbeddingTokens(tokens int, embeddingPrice float64) {
+	today := time.Now().Format("2006-01-02")
+	ut.AddCurrentCosts(round(float64(tokens)*embeddingPrice/1000, 6))
+
+	if val, ok := ut.UsageHistory["embedding_tokens"][today]; ok {
+		ut.UsageHistory["embedding_tokens"][today] = val.(int) + tokens
+	} else {
+		ut.UsageHistory["embedding_tokens"][today] = tokens
+	}
+
+	ut.saveUsage()
+}
+
+// GetCurrentEmbeddingTokens возвращает количество токенов эмбеддингов за сегодня и за этот месяц
+func (ut *UsageTracker) GetCurrentEmbeddingTokens() (int, int) {
+	today := time.Now().Format("2006-01-02")
+	month := yearMonth(time.Now())
+
+	usageDay := 0
+	if val, ok := ut.UsageHistory["embedding_tokens"][today]; ok {
+		usageDay = val.(int)
+	}
+
+	usageMonth := 0
+	for dateStr, tokens := range ut.UsageHistory["embedding_tokens"] {
+		if strings.HasPrefix(dateStr, month) {
+			usageMonth += tokens.(int)
+		}
+	}
+
+	return usageDay, usageMonth
+}
+
 // GetCurrentCost возвращает общую сумму затрат за текущий день и месяц
 func (ut *UsageTracker) GetCurrentCost() map[string]float64 {
 	today := time.Now().Format("2006-01-02")
@@ -91,8 +252,6 @@ func (ut *UsageTracker) GetCurrentCost() map[string]float64 {
 		if yearMonth(time.Now()) == yearMonth(parseDate(lastUpdate)) {
 			costMonth = ut.CostMap["month"]
 		}
-		costDay = 0.0
-		costMonth = 0.0
 	}
 	costAllTime := ut.CostMap["all_time"]
 
@@ -105,6 +264,12 @@ func yearMonth(date time.Time) string {
 }
 
 func (ut *UsageTracker) saveUsage() {
+	currentCost := ut.Usage["current_cost"].(map[string]interface{})
+	for key, val := range ut.CostMap {
+		currentCost[key] = val
+	}
+	ut.Usage["usage_history"] = ut.UsageHistory
+
 	data, err := json.MarshalIndent(ut.Usage, "", "  ")
 	if err != nil {
 		panic(err)
@@ -196,7 +361,7 @@ func (ut *UsageTracker) AddCurrentCosts(requestCost float64) {
 	today := time.Now().Format("2006-01-02")
 	lastUpdate := ut.Usage["current_cost"].(map[string]interface{})["last_update"].(string)
 
-	// add to all_time cost, initialize with calculation of total_cost if key doesn't exist
+	// add to all_time cost, files without all_time are initialized from history by InitializeMissingAllTimeCost
 	ut.CostMap["all_time"] += requestCost
 	if today == lastUpdate {
 		ut.CostMap["day"] += requestCost
@@ -212,6 +377,27 @@ func (ut *UsageTracker) AddCurrentCosts(requestCost float64) {
 	}
 }
 
+// ResetCurrentCosts обнуляет текущие затраты за день, месяц и все время. История использования сохраняется,
+// а в current_cost записываются дата обнуления и использование за этот день до него, чтобы RecomputeCosts
+// учитывал только историю после обнуления
+func (ut *UsageTracker) ResetCurrentCosts() {
+	for key := range ut.CostMap {
+		ut.CostMap[key] = 0.0
+	}
+	today := time.Now().Format("2006-01-02")
+	usage := ut.dayUsage(today)
+	currentCost := ut.Usage["current_cost"].(map[string]interface{})
+	currentCost["last_update"] = today
+	currentCost["reset_at"] = today
+	currentCost["reset_usage"] = map[string]interface{}{
+		"chat_tokens":           usage.chatTokens,
+		"number_images":         append([]int(nil), usage.images...),
+		"transcription_seconds": usage.transcriptionSeconds,
+		"embedding_tokens":      usage.embeddingTokens,
+	}
+	ut.saveUsage()
+}
+
 // GetCurrentTranscriptionDuration возвращает минуты и секунды аудио, транскрибированные за сегодня и за этот месяц
 func (ut *UsageTracker) GetCurrentTranscriptionDuration() (int, float64, int, float64) {
 	today := time.Now().Format("2006-01-02")
@@ -236,7 +422,7 @@ func (ut *UsageTracker) GetCurrentTranscriptionDuration() (int, float64, int, fl
 }
 
 // InitializeAllTimeCost возвращает общую сумму затрат всех запросов в истории
-func (ut *UsageTracker) InitializeAllTimeCost(tokensPrice float64, imagePrices []float64, minutePrice float64) float64 {
+func (ut *UsageTracker) InitializeAllTimeCost(tokensPrice float64, imagePrices []float64, minutePrice float64, embeddingPrice float64) float64 {
 	totalTokens := 0
 	for _, tokens := range ut.UsageHistory["chat_tokens"] {
 		totalTokens += tokens.(int)
@@ -260,10 +446,27 @@ func (ut *UsageTracker) InitializeAllTimeCost(tokensPrice float64, imagePrices [
 	}
 	transcriptionCost := round(float64(totalTranscriptionSeconds)*minutePrice/60, 2)
 
-	allTimeCost := tokenCost + transcriptionCost + imageCost
+	totalEmbeddingTokens := 0
+	for _, tokens := range ut.UsageHistory["embedding_tokens"] {
+		totalEmbeddingTokens += tokens.(int)
+	}
+	embeddingCost := round(float64(totalEmbeddingTokens)*embeddingPrice/1000, 6)
+
+	allTimeCost := tokenCost + transcriptionCost + imageCost + embeddingCost
 	return allTimeCost
 }
 
+// InitializeMissingAllTimeCost вычисляет all_time из истории, если его нет в файле трекера, например в файлах
+// старых версий бота. Вызывается при создании трекера, до добавления новых запросов в историю
+func (ut *UsageTracker) InitializeMissingAllTimeCost(tokensPrice float64, imagePrices []float64, minutePrice float64, embeddingPrice float64) {
+	if !ut.allTimeMissing {
+		return
+	}
+	ut.allTimeMissing = false
+	ut.CostMap["all_time"] = ut.InitializeAllTimeCost(tokensPrice, imagePrices, minutePrice, embeddingPrice)
+	ut.saveUsage()
+}
+
 // Вспомогательные функции
 
 func round(val float64, precision int) float64 {
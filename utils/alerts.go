@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	conf "tutor/config"
+	"tutor/usagetracker"
+)
+
+// BudgetAlert is a budget threshold crossed by a request.
+type BudgetAlert struct {
+	// UserID is the user whose budget was crossed, 0 for the organisation cap.
+	UserID       int
+	Threshold    int
+	Period       string
+	Spent        float64
+	Budget       float64
+	NotifyUser   bool
+	NotifyAdmins bool
+}
+
+// budgetAlertsFile keeps the thresholds already notified, keyed by scope and period,
+// so an alert is sent once per period even across restarts.
+const budgetAlertsFile = "budget_alerts.json"
+
+// GetBudgetAlertThresholds parses BudgetAlertThresholds, a comma list of percentages, in ascending order.
+func GetBudgetAlertThresholds(cfg conf.Config) []int {
+	var thresholds []int
+	for _, item := range strings.Split(cfg.BudgetAlertThresholds, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		threshold, err := strconv.Atoi(strings.TrimSuffix(item, "%"))
+		if err != nil || threshold <= 0 {
+			log.Printf("Invalid budget alert threshold '%s'", item)
+			continue
+		}
+		thresholds = append(thresholds, threshold)
+	}
+	sort.Ints(thresholds)
+	return thresholds
+}
+
+// GetOrgMonthlyCost sums the monthly cost of all user trackers and of the reports tracker. usage must hold
+// every tracker in LogsDir, see LoadUsage, so the check never touches the disk.
+func GetOrgMonthlyCost(cfg conf.Config, usage map[string]*usagetracker.UsageTracker) float64 {
+	total := 0.0
+	for _, tracker := range usage {
+		if tracker.IsCountedInTotals() {
+			total += tracker.GetCurrentCost()["cost_month"]
+		}
+	}
+	return total
+}
+
+// IsWithinOrgBudget checks if the organisation stays under OrgMonthlyBudget. Admins are never refused.
+func IsWithinOrgBudget(cfg conf.Config, usage map[string]*usagetracker.UsageTracker, userID int) bool {
+	if cfg.OrgMonthlyBudget <= 0 || IsAdmin(cfg, userID) {
+		return true
+	}
+	return GetOrgMonthlyCost(cfg, usage) < cfg.OrgMonthlyBudget
+}
+
+// checkBudgetAlerts returns the alerts crossed by the user and the organisation after a request was recorded.
+// Only the highest newly crossed threshold is reported, lower ones are marked as sent with it.
+func checkBudgetAlerts(cfg conf.Config, usage map[string]*usagetracker.UsageTracker, userID int) []BudgetAlert {
+	thresholds := GetBudgetAlertThresholds(cfg)
+	if len(thresholds) == 0 {
+		return nil
+	}
+
+	notifyUser, notifyAdmins := false, false
+	for _, recipient := range strings.Split(cfg.BudgetAlertRecipients, ",") {
+		switch strings.TrimSpace(recipient) {
+		case "user":
+			notifyUser = true
+		case "admins":
+			notifyAdmins = true
+		}
+	}
+
+	sent := loadSentAlerts(cfg)
+	var alerts []BudgetAlert
+
+	// guests sharing the GuestBudget pool have no budget of their own
+	if cfg.GuestBudget <= 0 || GetUserRole(cfg, userID) != conf.RoleGuest {
+		budget := GetUserBudget(cfg, userID)
+		if budget > 0 && !math.IsInf(budget, 1) {
+			period := GetUserBudgetPeriod(cfg, userID)
+			spent := GetUserUsageTracker(cfg, usage, userID, "").GetCurrentCost()[budgetCostMap[period]]
+			key := fmt.Sprintf("%d:%s", userID, periodKey(period))
+			if threshold, ok := crossedThreshold(sent, key, thresholds, spent, budget); ok {
+				alerts = append(alerts, BudgetAlert{UserID: userID, Threshold: threshold, Period: period,
+					Spent: spent, Budget: budget, NotifyUser: notifyUser, NotifyAdmins: notifyAdmins})
+			}
+		}
+	}
+
+	if cfg.OrgMonthlyBudget > 0 {
+		spent := GetOrgMonthlyCost(cfg, usage)
+		key := "org:" + periodKey("monthly")
+		if threshold, ok := crossedThreshold(sent, key, thresholds, spent, cfg.OrgMonthlyBudget); ok {
+			alerts = append(alerts, BudgetAlert{Threshold: threshold, Period: "monthly",
+				Spent: spent, Budget: cfg.OrgMonthlyBudget, NotifyAdmins: true})
+		}
+	}
+
+	if len(alerts) > 0 {
+		saveSentAlerts(cfg, sent)
+	}
+	return alerts
+}
+
+// crossedThreshold marks the thresholds reached by spent and returns the highest one not notified before.
+func crossedThreshold(sent map[string][]int, key string, thresholds []int, spent, budget float64) (int, bool) {
+	percent := spent / budget * 100
+	crossed, found := 0, false
+	for _, threshold := range thresholds {
+		if percent < float64(threshold) || containsInt(sent[key], threshold) {
+			continue
+		}
+		sent[key] = append(sent[key], threshold)
+		crossed, found = threshold, true
+	}
+	return crossed, found
+}
+
+// periodKey identifies the current budget period, so alerts fire again when a new period starts.
+func periodKey(period string) string {
+	switch period {
+	case "daily":
+		return time.Now().Format("2006-01-02")
+	case "monthly":
+		return time.Now().Format("2006-01")
+	default:
+		return period
+	}
+}
+
+func loadSentAlerts(cfg conf.Config) map[string][]int {
+	sent := make(map[string][]int)
+	data, err := os.ReadFile(filepath.Join(cfg.LogsDir, budgetAlertsFile))
+	if err != nil {
+		return sent
+	}
+	if err := json.Unmarshal(data, &sent); err != nil {
+		log.Printf("Error unmarshalling budget alerts: %v", err)
+	}
+	return sent
+}
+
+func saveSentAlerts(cfg conf.Config, sent map[string][]int) {
+	data, err := json.MarshalIndent(sent, "", "  ")
+	if err != nil {
+		log.Printf("Error marshalling budget alerts: %v", err)
+		return
+	}
+	if err := os.MkdirAll(cfg.LogsDir, os.ModePerm); err != nil {
+		log.Printf("Error creating logs dir: %v", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(cfg.LogsDir, budgetAlertsFile), data, 0644); err != nil {
+		log.Printf("Error saving budget alerts: %v", err)
+	}
+}
+
+func containsInt(slice []int, item int) bool {
+	for _, v := range slice {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
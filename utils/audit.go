@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	conf "tutor/config"
+)
+
+// AuditEntry is a single record of the admin audit log.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	ActorID   int       `json:"actor_id"`
+	ActorName string    `json:"actor_name"`
+	Action    string    `json:"action"`
+	TargetID  int       `json:"target_id,omitempty"`
+	Details   string    `json:"details,omitempty"`
+}
+
+// AuditLogPath returns the path of the audit log inside LogsDir.
+func AuditLogPath(cfg conf.Config) string {
+	return filepath.Join(cfg.LogsDir, "audit.log")
+}
+
+// RecordAudit appends an entry to the audit log as a JSON line.
+func RecordAudit(cfg conf.Config, entry AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(cfg.LogsDir, os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(AuditLogPath(cfg), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
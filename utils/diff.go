@@ -0,0 +1,72 @@
+package utils
+
+import "strings"
+
+// maxDiffWords limits the word diff, the LCS table grows with the product of both lengths.
+const maxDiffWords = 400
+
+// WordDiff returns a compact Markdown diff of two texts: removed words are struck through and added words are bold.
+// Runs of changed words are grouped. The texts are compared word by word, so whitespace is normalised.
+// It returns false if there are no changes or the texts are too long to compare.
+func WordDiff(original, corrected string) (string, bool) {
+	a, b := strings.Fields(original), strings.Fields(corrected)
+	if len(a) > maxDiffWords || len(b) > maxDiffWords {
+		return "", false
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var parts, removed, added []string
+	changed := false
+	flush := func() {
+		if len(removed) > 0 {
+			parts = append(parts, "~~"+strings.Join(removed, " ")+"~~")
+		}
+		if len(added) > 0 {
+			parts = append(parts, "**"+strings.Join(added, " ")+"**")
+		}
+		removed, added = nil, nil
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			parts = append(parts, EscapeMarkdown(a[i]))
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			added = append(added, EscapeMarkdown(b[j]))
+			changed = true
+			j++
+		default:
+			removed = append(removed, EscapeMarkdown(a[i]))
+			changed = true
+			i++
+		}
+	}
+	flush()
+	return strings.Join(parts, " "), changed
+}
+
+// markdownEscaper escapes the characters parseInline treats as Markdown.
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "~", `\~`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`, "#", `\#`)
+
+// EscapeMarkdown escapes text so that RenderTelegramHTML shows it literally.
+func EscapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWordDiff(t *testing.T) {
+	tests := []struct {
+		name        string
+		original    string
+		corrected   string
+		want        string
+		wantChanged bool
+		wantHTML    string
+	}{
+		{
+			name:        "replaced word",
+			original:    "I has a cat",
+			corrected:   "I have a cat",
+			want:        "I ~~has~~ **have** a cat",
+			wantChanged: true,
+			wantHTML:    "I <s>has</s> <b>have</b> a cat",
+		},
+		{
+			name:        "replaced and inserted words",
+			original:    "She go to school yesterday",
+			corrected:   "She went to the school yesterday",
+			want:        "She ~~go~~ **went** to **the** school yesterday",
+			wantChanged: true,
+			wantHTML:    "She <s>go</s> <b>went</b> to <b>the</b> school yesterday",
+		},
+		{
+			name:        "removed run",
+			original:    "the big red dog",
+			corrected:   "the dog",
+			want:        "the ~~big red~~ dog",
+			wantChanged: true,
+			wantHTML:    "the <s>big red</s> dog",
+		},
+		{
+			name:        "replaced run",
+			original:    "we was going home",
+			corrected:   "we were heading home",
+			want:        "we ~~was going~~ **were heading** home",
+			wantChanged: true,
+			wantHTML:    "we <s>was going</s> <b>were heading</b> home",
+		},
+		{
+			name:      "only whitespace differs",
+			original:  "same  text\n",
+			corrected: "same text",
+			want:      "same text",
+			wantHTML:  "same text",
+		},
+		{
+			name:        "escaped markdown",
+			original:    "2*3 = x_1",
+			corrected:   "2*3 = x_2",
+			want:        `2\*3 = ~~x\_1~~ **x\_2**`,
+			wantChanged: true,
+			wantHTML:    "2*3 = <s>x_1</s> <b>x_2</b>",
+		},
+		{
+			name:        "all markdown characters",
+			original:    "call f(x) [draft] ~ok #1 `a` \\n",
+			corrected:   "call g(x) [final] ~ok #2 `b` \\n",
+			want:        "call ~~f\\(x\\) \\[draft\\]~~ **g\\(x\\) \\[final\\]** \\~ok ~~\\#1 \\`a\\`~~ **\\#2 \\`b\\`** \\\\n",
+			wantChanged: true,
+			wantHTML:    "call <s>f(x) [draft]</s> <b>g(x) [final]</b> ~ok <s>#1 `a`</s> <b>#2 `b`</b> \\n",
+		},
+		{
+			name:        "longest compared text",
+			original:    strings.Repeat("a ", maxDiffWords),
+			corrected:   strings.Repeat("a ", maxDiffWords-1) + "b",
+			want:        strings.Repeat("a ", maxDiffWords-1) + "~~a~~ **b**",
+			wantChanged: true,
+			wantHTML:    strings.Repeat("a ", maxDiffWords-1) + "<s>a</s> <b>b</b>",
+		},
+		{
+			name:      "too long",
+			original:  strings.Repeat("a ", maxDiffWords+1),
+			corrected: "a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := WordDiff(tt.original, tt.corrected)
+			if got != tt.want || changed != tt.wantChanged {
+				t.Errorf("WordDiff = %q, %t, want %q, %t", got, changed, tt.want, tt.wantChanged)
+			}
+			if tt.wantHTML == "" {
+				return
+			}
+			if html := RenderTelegramHTML(got, 4096); len(html) != 1 || html[0] != tt.wantHTML {
+				t.Errorf("RenderTelegramHTML = %q, want %q", html, tt.wantHTML)
+			}
+		})
+	}
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	text := "a*b_c~d`e[f](g)#h\\i <j> & k"
+	html := RenderTelegramHTML(EscapeMarkdown(text), 4096)
+	if len(html) != 1 || StripHTML(html[0]) != text {
+		t.Errorf("RenderTelegramHTML(EscapeMarkdown(%q)) = %q, want the text unchanged", text, html)
+	}
+}
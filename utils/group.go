@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	conf "tutor/config"
+	"tutor/helper"
+)
+
+// GroupPolicy decides when the bot answers in a group chat and how conversations are kept there.
+type GroupPolicy struct {
+	// Trigger is "mention" to answer only when mentioned, replied to or addressed by a keyword, or "all".
+	Trigger string
+	// Context is "chat" for one conversation per chat or forum topic, or "user" for one per member.
+	Context string
+}
+
+// GetGroupPolicy returns the policy of a group chat from GroupPolicies, entries "chatID:trigger[:context]",
+// falling back to GroupTrigger and GroupContext.
+func GetGroupPolicy(cfg conf.Config, chat *telegram.Chat) GroupPolicy {
+	policy := GroupPolicy{Trigger: cfg.GroupTrigger, Context: cfg.GroupContext}
+
+	chatIDStr := fmt.Sprint(chat.ID)
+	for _, entry := range strings.Split(cfg.GroupPolicies, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) < 2 || parts[0] != chatIDStr {
+			continue
+		}
+		if parts[1] != "" {
+			policy.Trigger = parts[1]
+		}
+		if len(parts) > 2 && parts[2] != "" {
+			policy.Context = parts[2]
+		}
+		break
+	}
+
+	if policy.Trigger != "mention" && policy.Trigger != "all" {
+		log.Printf("Invalid group trigger '%s' for chat id: %d, using 'mention'", policy.Trigger, chat.ID)
+		policy.Trigger = "mention"
+	}
+	if policy.Context != "chat" && policy.Context != "user" {
+		log.Printf("Invalid group context '%s' for chat id: %d, using 'chat'", policy.Context, chat.ID)
+		policy.Context = "chat"
+	}
+	return policy
+}
+
+// IsAddressedToBot checks if the bot should answer a message. Private messages are always answered,
+// group messages depending on the trigger of the group policy.
+func IsAddressedToBot(cfg conf.Config, bot *telegram.BotAPI, message *telegram.Message) bool {
+	if !IsGroupChat(message.Chat) || GetGroupPolicy(cfg, message.Chat).Trigger == "all" {
+		return true
+	}
+
+	if reply := message.ReplyToMessage; reply != nil && reply.From != nil && reply.From.ID == bot.Self.ID {
+		return true
+	}
+
+	text := strings.ToLower(message.Text)
+	if bot.Self.UserName != "" && strings.Contains(text, "@"+strings.ToLower(bot.Self.UserName)) {
+		return true
+	}
+
+	pattern := keywordPattern(cfg.GroupKeywords)
+	return pattern != nil && pattern.MatchString(message.Text)
+}
+
+// keywordPatterns caches the pattern compiled from GroupKeywords, so group messages don't compile it again.
+var keywordPatterns = struct {
+	sync.Mutex
+	keywords string
+	pattern  *regexp.Regexp
+}{}
+
+// keywordPattern returns a pattern matching any of the comma-separated keywords as a whole word,
+// nil if there are no keywords.
+func keywordPattern(keywords string) *regexp.Regexp {
+	keywordPatterns.Lock()
+	defer keywordPatterns.Unlock()
+	if keywordPatterns.pattern != nil && keywordPatterns.keywords == keywords {
+		return keywordPatterns.pattern
+	}
+
+	var alternatives []string
+	for _, keyword := range strings.Split(keywords, ",") {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			alternatives = append(alternatives, regexp.QuoteMeta(keyword))
+		}
+	}
+	if len(alternatives) == 0 {
+		return nil
+	}
+	keywordPatterns.keywords = keywords
+	keywordPatterns.pattern = regexp.MustCompile(`(?i)(^|[^\p{L}\p{N}_])(` + strings.Join(alternatives, "|") + `)($|[^\p{L}\p{N}_])`)
+	return keywordPatterns.pattern
+}
+
+// mentionPatterns caches the pattern matching the mention of the bot, so group messages don't compile it again.
+var mentionPatterns = struct {
+	sync.Mutex
+	botName string
+	pattern *regexp.Regexp
+}{}
+
+// mentionPattern returns a pattern matching @botName.
+func mentionPattern(botName string) *regexp.Regexp {
+	mentionPatterns.Lock()
+	defer mentionPatterns.Unlock()
+	if mentionPatterns.pattern == nil || mentionPatterns.botName != botName {
+		mentionPatterns.botName = botName
+		mentionPatterns.pattern = regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(botName) + `\b`)
+	}
+	return mentionPatterns.pattern
+}
+
+// StripMention removes the mention of the bot from a prompt.
+func StripMention(text, botName string) string {
+	if botName == "" {
+		return text
+	}
+	return strings.TrimSpace(mentionPattern(botName).ReplaceAllString(text, ""))
+}
+
+// GetConversationKey returns the conversation a message belongs to. In groups every forum topic has its own
+// conversation, and with the "user" context every member has their own conversation inside it.
+func GetConversationKey(cfg conf.Config, message *telegram.Message) helper.ConversationKey {
+	if !IsGroupChat(message.Chat) {
+		return helper.ChatConversation(message.Chat.ID)
+	}
+
+	key := helper.ConversationKey{ChatID: message.Chat.ID, ThreadID: GetThreadID(message)}
+	if GetGroupPolicy(cfg, message.Chat).Context == "user" && message.From != nil {
+		key.UserID = message.From.ID
+	}
+	return key
+}
+
+type messageRef struct {
+	chatID    int64
+	messageID int
+}
+
+// threadIDs keeps the forum topics of the messages being handled. The Telegram library doesn't decode
+// message_thread_id, so the bot reads it from the raw update and records it here with SetThreadID.
+var threadIDs = struct {
+	sync.Mutex
+	ids map[messageRef]int
+}{ids: make(map[messageRef]int)}
+
+// SetThreadID records the forum topic of a message. A zero threadID forgets the message.
+func SetThreadID(chatID int64, messageID, threadID int) {
+	threadIDs.Lock()
+	defer threadIDs.Unlock()
+	if threadID == 0 {
+		delete(threadIDs.ids, messageRef{chatID, messageID})
+		return
+	}
+	threadIDs.ids[messageRef{chatID, messageID}] = threadID
+}
+
+// GetThreadID returns the forum topic of a message, 0 for messages outside of topics.
+func GetThreadID(message *telegram.Message) int {
+	threadIDs.Lock()
+	defer threadIDs.Unlock()
+	return threadIDs.ids[messageRef{message.Chat.ID, message.MessageID}]
+}
+
+// SendMessage sends a message into a forum topic, or like bot.Send if threadID is 0. The Telegram library
+// doesn't know message_thread_id, so messages that don't quote anything would otherwise land in the General topic.
+func SendMessage(bot *telegram.BotAPI, msg telegram.MessageConfig, threadID int) (telegram.Message, error) {
+	if threadID == 0 {
+		return bot.Send(msg)
+	}
+
+	v := url.Values{}
+	if msg.ChannelUsername != "" {
+		v.Add("chat_id", msg.ChannelUsername)
+	} else {
+		v.Add("chat_id", strconv.FormatInt(msg.ChatID, 10))
+	}
+	v.Add("message_thread_id", strconv.Itoa(threadID))
+	v.Add("text", msg.Text)
+	if msg.ParseMode != "" {
+		v.Add("parse_mode", msg.ParseMode)
+	}
+	if msg.DisableWebPagePreview {
+		v.Add("disable_web_page_preview", "true")
+	}
+	if msg.DisableNotification {
+		v.Add("disable_notification", "true")
+	}
+	if msg.ReplyToMessageID != 0 {
+		v.Add("reply_to_message_id", strconv.Itoa(msg.ReplyToMessageID))
+	}
+	if msg.ReplyMarkup != nil {
+		markup, err := json.Marshal(msg.ReplyMarkup)
+		if err != nil {
+			return telegram.Message{}, err
+		}
+		v.Add("reply_markup", string(markup))
+	}
+
+	resp, err := bot.MakeRequest("sendMessage", v)
+	if err != nil {
+		return telegram.Message{}, err
+	}
+	var message telegram.Message
+	err = json.Unmarshal(resp.Result, &message)
+	return message, err
+}
@@ -0,0 +1,394 @@
+package utils
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// htmlSegment is a piece of a rendered message: either raw text, escaped on output, or an opening or closing tag.
+type htmlSegment struct {
+	text  string
+	tag   string
+	attrs string
+	open  bool
+	close bool
+}
+
+var headingRegexp = regexp.MustCompile(`^#{1,6}\s+(.*)$`)
+var bulletRegexp = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+
+// RenderTelegramHTML converts the Markdown produced by the model into Telegram HTML and splits it into
+// messages of at most limit visible characters, counted in UTF-16 code units like Telegram does. Messages are split on paragraph, line, word and rune
+// boundaries, in that order of preference; formatting open at a split is closed and re-opened in the next message.
+func RenderTelegramHTML(markdown string, limit int) []string {
+	return splitSegments(parseMarkdown(markdown), limit)
+}
+
+// ToTelegramHTML converts Markdown into Telegram HTML without splitting it.
+func ToTelegramHTML(markdown string) string {
+	var sb strings.Builder
+	for _, seg := range parseMarkdown(markdown) {
+		sb.WriteString(seg.html())
+	}
+	return sb.String()
+}
+
+var tagRegexp = regexp.MustCompile(`<[^>]*>`)
+
+// StripHTML removes the tags from Telegram HTML and unescapes it, to resend a message Telegram refused as plain text.
+func StripHTML(text string) string {
+	return html.UnescapeString(tagRegexp.ReplaceAllString(text, ""))
+}
+
+func (s htmlSegment) html() string {
+	switch {
+	case s.open:
+		return "<" + s.tag + s.attrs + ">"
+	case s.close:
+		return "</" + s.tag + ">"
+	default:
+		return html.EscapeString(s.text)
+	}
+}
+
+func openTag(tag, attrs string) htmlSegment { return htmlSegment{tag: tag, attrs: attrs, open: true} }
+func closeTag(tag string) htmlSegment       { return htmlSegment{tag: tag, close: true} }
+func textSegment(text string) htmlSegment   { return htmlSegment{text: text} }
+
+// parseMarkdown handles the block level: code fences, headings and bullets. Everything else is inline Markdown.
+func parseMarkdown(markdown string) []htmlSegment {
+	var segments []htmlSegment
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if i > 0 {
+			segments = append(segments, textSegment("\n"))
+		}
+
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "```") {
+			attrs := ""
+			if lang := strings.TrimSpace(strings.TrimPrefix(trimmed, "```")); lang != "" {
+				attrs = ` class="language-` + html.EscapeString(lang) + `"`
+			}
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			segments = append(segments, openTag("pre", ""), openTag("code", attrs))
+			if len(code) > 0 {
+				segments = append(segments, textSegment(strings.Join(code, "\n")))
+			}
+			segments = append(segments, closeTag("code"), closeTag("pre"))
+			continue
+		}
+
+		if match := headingRegexp.FindStringSubmatch(line); match != nil {
+			segments = append(segments, openTag("b", ""))
+			segments = append(segments, parseInline(match[1])...)
+			segments = append(segments, closeTag("b"))
+			continue
+		}
+
+		if match := bulletRegexp.FindStringSubmatch(line); match != nil {
+			segments = append(segments, textSegment(match[1]+"• "))
+			line = line[len(match[0]):]
+		}
+		segments = append(segments, parseInline(line)...)
+	}
+
+	return mergeText(segments)
+}
+
+// inlineDelimiters maps Markdown delimiters to Telegram tags, longer delimiters first.
+var inlineDelimiters = []struct {
+	delimiter string
+	tag       string
+}{
+	{"**", "b"},
+	{"__", "b"},
+	{"~~", "s"},
+	{"*", "i"},
+	{"_", "i"},
+}
+
+// parseInline handles inline code, links, emphasis and backslash escapes. Unmatched delimiters stay literal.
+func parseInline(text string) []htmlSegment {
+	var segments []htmlSegment
+	var plain strings.Builder
+	flush := func() {
+		if plain.Len() > 0 {
+			segments = append(segments, textSegment(plain.String()))
+			plain.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); {
+		rest := text[i:]
+
+		if rest[0] == '\\' && len(rest) > 1 && strings.ContainsRune("\\`*_~[]()#", rune(rest[1])) {
+			plain.WriteByte(rest[1])
+			i += 2
+			continue
+		}
+
+		if rest[0] == '`' {
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				flush()
+				segments = append(segments, openTag("code", ""), textSegment(rest[1:end+1]), closeTag("code"))
+				i += end + 2
+				continue
+			}
+		}
+
+		if rest[0] == '[' {
+			if label, url, n, ok := parseLink(rest); ok {
+				flush()
+				segments = append(segments, openTag("a", ` href="`+html.EscapeString(url)+`"`))
+				segments = append(segments, parseInline(label)...)
+				segments = append(segments, closeTag("a"))
+				i += n
+				continue
+			}
+		}
+
+		matched := false
+		for _, d := range inlineDelimiters {
+			if !strings.HasPrefix(rest, d.delimiter) || !canOpen(text, i, d.delimiter) {
+				continue
+			}
+			end := findCloser(text, i+len(d.delimiter), d.delimiter)
+			if end < 0 {
+				continue
+			}
+			flush()
+			segments = append(segments, openTag(d.tag, ""))
+			segments = append(segments, parseInline(text[i+len(d.delimiter):end])...)
+			segments = append(segments, closeTag(d.tag))
+			i = end + len(d.delimiter)
+			matched = true
+			break
+		}
+		if matched {
+			continue
+		}
+
+		plain.WriteByte(rest[0])
+		i++
+	}
+	flush()
+	return segments
+}
+
+// canOpen checks that a delimiter at i is followed by text and, for "_", is not inside a word like snake_case.
+func canOpen(text string, i int, delimiter string) bool {
+	after := i + len(delimiter)
+	if after >= len(text) || text[after] == ' ' || strings.HasPrefix(text[after:], delimiter) {
+		return false
+	}
+	if delimiter[0] == '_' && i > 0 && isWordByte(text[i-1]) {
+		return false
+	}
+	return true
+}
+
+// findCloser returns the position of the delimiter closing an emphasis opened before start, or -1.
+func findCloser(text string, start int, delimiter string) int {
+	for j := start; j < len(text); j++ {
+		if text[j] == '\\' {
+			j++
+			continue
+		}
+		if text[j] == '`' {
+			if end := strings.IndexByte(text[j+1:], '`'); end >= 0 {
+				j += end + 1
+				continue
+			}
+		}
+		if !strings.HasPrefix(text[j:], delimiter) || text[j-1] == ' ' {
+			continue
+		}
+		// "**" must not be taken for the closer of "*"
+		if len(delimiter) == 1 && j+1 < len(text) && text[j+1] == delimiter[0] {
+			j++
+			continue
+		}
+		after := j + len(delimiter)
+		if delimiter[0] == '_' && after < len(text) && isWordByte(text[after]) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+// parseLink parses [label](url) at the start of text and returns the number of bytes consumed.
+func parseLink(text string) (string, string, int, bool) {
+	closeLabel := strings.Index(text, "](")
+	if closeLabel < 0 || strings.Contains(text[:closeLabel], "\n") {
+		return "", "", 0, false
+	}
+	closeURL := strings.IndexByte(text[closeLabel+2:], ')')
+	if closeURL < 0 {
+		return "", "", 0, false
+	}
+	url := text[closeLabel+2 : closeLabel+2+closeURL]
+	if url == "" || strings.ContainsAny(url, " \n") {
+		return "", "", 0, false
+	}
+	return text[1:closeLabel], url, closeLabel + 2 + closeURL + 1, true
+}
+
+func isWordByte(b byte) bool {
+	return b >= 0x80 || b == '_' || unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b))
+}
+
+// mergeText joins adjacent text segments.
+func mergeText(segments []htmlSegment) []htmlSegment {
+	var merged []htmlSegment
+	for _, seg := range segments {
+		if !seg.open && !seg.close && len(merged) > 0 {
+			last := &merged[len(merged)-1]
+			if !last.open && !last.close {
+				last.text += seg.text
+				continue
+			}
+		}
+		merged = append(merged, seg)
+	}
+	return merged
+}
+
+// styledText is the visible text of a message with the stack of open tags for every rune.
+type styledText struct {
+	runes  []rune
+	styles []int // index into stacks
+	stacks [][]htmlSegment
+}
+
+func flatten(segments []htmlSegment) styledText {
+	st := styledText{stacks: [][]htmlSegment{nil}}
+	var stack []htmlSegment
+	for _, seg := range segments {
+		switch {
+		case seg.open:
+			stack = append(append([]htmlSegment(nil), stack...), seg)
+			st.stacks = append(st.stacks, stack)
+		case seg.close:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			st.stacks = append(st.stacks, stack)
+		default:
+			for _, r := range seg.text {
+				st.runes = append(st.runes, r)
+				st.styles = append(st.styles, len(st.stacks)-1)
+			}
+		}
+	}
+	return st
+}
+
+// render returns the HTML of runes [from, to), opening and closing tags where the style changes.
+func (st styledText) render(from, to int) string {
+	var sb strings.Builder
+	var open []htmlSegment
+	var text []rune
+	flush := func() {
+		sb.WriteString(html.EscapeString(string(text)))
+		text = text[:0]
+	}
+
+	for i := from; i < to; i++ {
+		stack := st.stacks[st.styles[i]]
+		common := 0
+		for common < len(open) && common < len(stack) && open[common] == stack[common] {
+			common++
+		}
+		if common != len(open) || common != len(stack) {
+			flush()
+			for j := len(open) - 1; j >= common; j-- {
+				sb.WriteString(closeTag(open[j].tag).html())
+			}
+			for _, tag := range stack[common:] {
+				sb.WriteString(tag.html())
+			}
+			open = stack
+		}
+		text = append(text, st.runes[i])
+	}
+	flush()
+	for j := len(open) - 1; j >= 0; j-- {
+		sb.WriteString(closeTag(open[j].tag).html())
+	}
+	return sb.String()
+}
+
+// splitSegments packs segments into messages of at most limit visible UTF-16 code units. Tags open at a split
+// are closed at the end of a message and re-opened at the start of the next one.
+func splitSegments(segments []htmlSegment, limit int) []string {
+	st := flatten(segments)
+	var chunks []string
+
+	start := 0
+	for start < len(st.runes) {
+		for start < len(st.runes) && unicode.IsSpace(st.runes[start]) {
+			start++
+		}
+		if start == len(st.runes) {
+			break
+		}
+
+		end, size := start, 0
+		for end < len(st.runes) && size+utf16Len(st.runes[end]) <= limit {
+			size += utf16Len(st.runes[end])
+			end++
+		}
+		if end < len(st.runes) {
+			// a single rune wider than the limit still has to make progress
+			end = start + max(breakPoint(st.runes[start:end]), 1)
+		}
+
+		trimmed := end
+		for trimmed > start && unicode.IsSpace(st.runes[trimmed-1]) {
+			trimmed--
+		}
+		chunks = append(chunks, st.render(start, trimmed))
+		start = end
+	}
+	return chunks
+}
+
+// utf16Len returns the number of UTF-16 code units of r, the unit Telegram counts message length in.
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// telegramLen returns the length of text as Telegram counts it, in UTF-16 code units.
+func telegramLen(text string) int {
+	n := 0
+	for _, r := range text {
+		n += utf16Len(r)
+	}
+	return n
+}
+
+// breakPoint returns how many runes of window to keep in a message: up to the last paragraph break,
+// line break or space in the second half of the window, then anywhere in it, or the whole window if there is none.
+func breakPoint(window []rune) int {
+	text := string(window)
+	separators := []string{"\n\n", "\n", " "}
+	for _, minIndex := range []int{len(text) / 2, 1} {
+		for _, sep := range separators {
+			if idx := strings.LastIndex(text, sep); idx >= minIndex {
+				return len([]rune(text[:idx+len(sep)]))
+			}
+		}
+	}
+	return len(window)
+}
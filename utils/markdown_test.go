@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// chunkSeparator separates the messages of a split answer in golden files.
+const chunkSeparator = "\n----- next message -----\n"
+
+func TestRenderTelegramHTMLGolden(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+	}{
+		{"escaping", 4096},
+		{"code_fence", 4096},
+		{"unmatched", 4096},
+		{"nested", 4096},
+		{"cyrillic_split", 60},
+		{"reopen", 40},
+		{"emoji_split", 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := os.ReadFile(filepath.Join("testdata", "markdown", tt.name+".md"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunks := RenderTelegramHTML(strings.TrimSuffix(string(input), "\n"), tt.limit)
+			for i, chunk := range chunks {
+				if n := len(utf16.Encode([]rune(StripHTML(chunk)))); n > tt.limit {
+					t.Errorf("message %d has %d UTF-16 code units, limit %d", i+1, n, tt.limit)
+				}
+			}
+			got := strings.Join(chunks, chunkSeparator) + "\n"
+
+			golden := filepath.Join("testdata", "markdown", tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("output differs from %s:\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
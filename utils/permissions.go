@@ -0,0 +1,58 @@
+package utils
+
+import (
+	conf "tutor/config"
+)
+
+// Permission is an action a role may be allowed to perform.
+type Permission string
+
+const (
+	// PermChat allows free chat and the tutoring commands.
+	PermChat Permission = "chat"
+	// PermManageStudents allows resetting history, viewing stats and setting budgets of students.
+	PermManageStudents Permission = "manage_students"
+	// PermManageUsers allows managing any user of the bot.
+	PermManageUsers Permission = "manage_users"
+)
+
+var rolePermissions = map[conf.Role][]Permission{
+	conf.RoleAdmin:   {PermChat, PermManageStudents, PermManageUsers},
+	conf.RoleTeacher: {PermChat, PermManageStudents},
+	conf.RoleStudent: {PermChat},
+	conf.RoleGuest:   {PermChat},
+}
+
+// GetUserRole returns the role of a registered user, unregistered users are guests.
+func GetUserRole(cfg conf.Config, userID int) conf.Role {
+	if user, ok := cfg.UserRegistry().Lookup(userID); ok {
+		return user.Role
+	}
+	return conf.RoleGuest
+}
+
+// HasPermission checks if the role of the user grants the permission.
+func HasPermission(cfg conf.Config, userID int, permission Permission) bool {
+	for _, p := range rolePermissions[GetUserRole(cfg, userID)] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// CanManageUser checks if actorID may act on targetID: admins manage everyone,
+// teachers manage students that are assigned to them or to no teacher at all.
+func CanManageUser(cfg conf.Config, actorID int, targetID int) bool {
+	if HasPermission(cfg, actorID, PermManageUsers) {
+		return true
+	}
+	if !HasPermission(cfg, actorID, PermManageStudents) {
+		return false
+	}
+	target, ok := cfg.UserRegistry().Lookup(targetID)
+	if !ok || target.Role != conf.RoleStudent {
+		return false
+	}
+	return target.Teacher == 0 || target.Teacher == actorID
+}
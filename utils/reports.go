@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"strings"
+	"time"
+
+	conf "tutor/config"
+	"tutor/usagetracker"
+)
+
+// GetReportUsageTracker returns the tracker charged for progress reports and weekly digests.
+// Reports are paid by the organisation, not by the teacher who asked for them, so they have
+// their own tracker next to the guests tracker. Its cost counts towards the organisation budget.
+func GetReportUsageTracker(cfg conf.Config, usage map[string]*usagetracker.UsageTracker) *usagetracker.UsageTracker {
+	if _, ok := usage["reports"]; !ok {
+		usage["reports"] = newUsageTracker(cfg, usagetracker.ReportsTrackerID, "Reports")
+	}
+	return usage["reports"]
+}
+
+// IsWithinReportBudget checks if the monthly ReportBudget still allows a report. A zero budget means no limit.
+func IsWithinReportBudget(cfg conf.Config, usage map[string]*usagetracker.UsageTracker) bool {
+	if cfg.ReportBudget <= 0 {
+		return true
+	}
+	return GetReportUsageTracker(cfg, usage).GetCurrentCost()["cost_month"] < cfg.ReportBudget
+}
+
+// AddReportRequestToUsageTracker charges the tokens used for a report to the reports tracker.
+func AddReportRequestToUsageTracker(usage map[string]*usagetracker.UsageTracker, cfg conf.Config, model string, usedTokens int) {
+	GetReportUsageTracker(cfg, usage).AddChatTokensForModel(usedTokens, cfg.TokenPrice, model)
+}
+
+// IsDigestDue checks if the weekly digest should be sent now: it is DigestWeekday, DigestHour has passed
+// and the last digest was sent on another day. DIGEST_WEEKDAY=none disables digests.
+func IsDigestDue(cfg conf.Config, lastSent time.Time, now time.Time) bool {
+	weekday := strings.ToLower(strings.TrimSpace(cfg.DigestWeekday))
+	if weekday == "" || weekday == "none" || strings.ToLower(now.Weekday().String()) != weekday {
+		return false
+	}
+	if now.Hour() < cfg.DigestHour {
+		return false
+	}
+	return lastSent.Format("2006-01-02") != now.Format("2006-01-02")
+}
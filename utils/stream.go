@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"errors"
+	"html"
+	"log"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+
+	conf "tutor/config"
+	"tutor/helper"
+)
+
+// telegramMessageLimit is the maximum length of a Telegram message in UTF-16 code units.
+const telegramMessageLimit = 4096
+
+// streamRenderer edits a reply in place as a streamed answer grows.
+type streamRenderer struct {
+	bot     *telegram.BotAPI
+	config  conf.Config
+	message *telegram.Message
+
+	sent        telegram.Message
+	finished    int // messages of the answer already finalised, the current message shows the next one
+	renderedLen int // visible runes of the current message last sent to Telegram
+	backoff     int
+	pauseUntil  time.Time
+}
+
+// StreamResponse renders a streamed answer as a reply to message. It sends a placeholder, edits it whenever
+// the answer grew by the cutoff of getStreamCutoffValues, backs off on flood limits and continues in a new
+// message when the Telegram limit is reached. It returns the tokens used by the request.
+// On a stream error the partial answer is closed with an error note, or the placeholder is deleted if nothing
+// was rendered yet, and the error is returned with the tokens already spent. Both channels are always
+// drained, so the generating goroutine finishes and records the answer in the history.
+func StreamResponse(bot *telegram.BotAPI, config conf.Config, message *telegram.Message, chunks <-chan helper.StreamChunk, errs <-chan error) (int, error) {
+	placeholder := telegram.NewMessage(message.Chat.ID, "...")
+	placeholder.ReplyToMessageID = GetReplyToMessageID(config, message)
+	sent, err := bot.Send(placeholder)
+	if err != nil {
+		tokensUsed, _ := drainStream(chunks, errs)
+		return tokensUsed, err
+	}
+
+	r := &streamRenderer{bot: bot, config: config, message: message, sent: sent}
+	content := ""
+	for chunk := range chunks {
+		content = chunk.Content
+		if chunk.Done {
+			r.finish(content)
+			return chunk.TokensUsed, nil
+		}
+		r.update(content)
+	}
+
+	err = <-errs
+	if err == nil {
+		err = errors.New("stream closed without an answer")
+	}
+	r.abort(content)
+	return helper.TokensUsedBy(err), err
+}
+
+// drainStream reads a stream to the end without rendering it and returns the tokens it used.
+func drainStream(chunks <-chan helper.StreamChunk, errs <-chan error) (int, error) {
+	tokensUsed := 0
+	for chunk := range chunks {
+		if chunk.Done {
+			tokensUsed = chunk.TokensUsed
+		}
+	}
+	if err := <-errs; err != nil {
+		return helper.TokensUsedBy(err), err
+	}
+	return tokensUsed, nil
+}
+
+// update edits the current message if the answer grew enough since the last edit.
+func (r *streamRenderer) update(content string) {
+	current := r.spill(content)
+	if time.Now().Before(r.pauseUntil) {
+		return
+	}
+	visible := StripHTML(current)
+	cutoff := getStreamCutoffValues(r.message, visible) + r.backoff
+	if len([]rune(visible))-r.renderedLen <= cutoff {
+		return
+	}
+	r.edit(current)
+}
+
+// finish renders the complete answer, retrying after a flood limit.
+func (r *streamRenderer) finish(content string) {
+	current := r.spill(content)
+	for attempt := 0; attempt < 3; attempt++ {
+		r.waitForFloodLimit()
+		if r.edit(current) || time.Now().After(r.pauseUntil) {
+			return
+		}
+	}
+}
+
+// abort closes a failed stream: the partial answer gets an error note, an empty placeholder is deleted.
+func (r *streamRenderer) abort(content string) {
+	current := r.spill(content)
+	if current == "" && r.finished == 0 {
+		if _, err := r.bot.DeleteMessage(telegram.NewDeleteMessage(r.sent.Chat.ID, r.sent.MessageID)); err != nil {
+			log.Printf("Failed to delete placeholder message: %v", err)
+		}
+		return
+	}
+
+	note := "⚠️ " + html.EscapeString(helper.LocalizedText("stream_interrupted", r.config.BotLanguage))
+	r.waitForFloodLimit()
+	if telegramLen(StripHTML(current+note))+2 <= telegramMessageLimit {
+		r.edit(current + "\n\n" + note)
+		return
+	}
+	// the note doesn't fit into the full message, so it follows as a separate one
+	r.edit(current)
+	r.sendContinuation(note)
+}
+
+// spill renders the answer into messages under the Telegram limit, finalises every message before the last one
+// and returns the HTML of the message that is still being written.
+func (r *streamRenderer) spill(content string) string {
+	messages := RenderTelegramHTML(content, telegramMessageLimit)
+	for len(messages)-r.finished > 1 {
+		r.waitForFloodLimit()
+		r.edit(messages[r.finished])
+		r.finished++
+		r.sendContinuation("...")
+	}
+	if r.finished < len(messages) {
+		return messages[r.finished]
+	}
+	return ""
+}
+
+// sendContinuation sends the next message of the answer, which becomes the message being edited.
+func (r *streamRenderer) sendContinuation(text string) {
+	next := telegram.NewMessage(r.message.Chat.ID, text)
+	next.ParseMode = telegram.ModeHTML
+	next.ReplyToMessageID = GetReplyToMessageID(r.config, r.message)
+	sent, err := r.bot.Send(next)
+	if err != nil {
+		log.Printf("Failed to send continuation message: %v", err)
+		return
+	}
+	r.sent = sent
+	r.renderedLen = 0
+}
+
+func (r *streamRenderer) waitForFloodLimit() {
+	if wait := time.Until(r.pauseUntil); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// edit updates the current message with rendered HTML and remembers a flood limit reported by Telegram.
+func (r *streamRenderer) edit(text string) bool {
+	if text == "" {
+		return true
+	}
+	err := editMessageHTML(r.bot, r.sent.Chat.ID, r.sent.MessageID, text)
+	if err != nil {
+		if seconds := retryAfter(err); seconds > 0 {
+			log.Printf("Flood limit reached, backing off for %d seconds", seconds)
+			r.pauseUntil = time.Now().Add(time.Duration(seconds) * time.Second)
+			r.backoff += 5
+		}
+		return false
+	}
+	r.renderedLen = len([]rune(StripHTML(text)))
+	return true
+}
+
+// retryAfter returns the number of seconds Telegram asked to wait before the next request, 0 if none.
+func retryAfter(err error) int {
+	var tgErr telegram.Error
+	if err != nil && errors.As(err, &tgErr) {
+		return tgErr.RetryAfter
+	}
+	return 0
+}
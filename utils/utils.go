@@ -13,14 +13,16 @@ import (
 	conf "tutor/config"
 )
 
-func messageText(message *telegram.Message) string {
+func MessageText(message *telegram.Message) string {
 	if message.Text == "" {
 		return ""
 	}
 
 	messageTxt := message.Text
-	entities := *message.Entities
-	for _, entity := range entities {
+	if message.Entities == nil {
+		return strings.TrimSpace(messageTxt)
+	}
+	for _, entity := range *message.Entities {
 		if entity.Type == "bot_command" {
 			messageTxt = strings.ReplaceAll(messageTxt, message.Text[entity.Offset:entity.Offset+entity.Length], "")
 		}
@@ -43,15 +45,8 @@ func isUserInGroup(bot *telegram.BotAPI, chatID int64, userID int) (bool, error)
 	return member.IsMember(), nil
 }
 
-func getThreadID(message *telegram.Message) int64 {
-	if message.MessageID != 0 {
-		return int64(message.MessageID)
-	}
-	return 0
-}
-
 func getStreamCutoffValues(message *telegram.Message, content string) int {
-	if isGroupChat(message.Chat) {
+	if IsGroupChat(message.Chat) {
 		if len(content) > 1000 {
 			return 180
 		} else if len(content) > 200 {
@@ -72,23 +67,11 @@ func getStreamCutoffValues(message *telegram.Message, content string) int {
 	}
 }
 
-func isGroupChat(chat *telegram.Chat) bool {
+func IsGroupChat(chat *telegram.Chat) bool {
 	return chat.IsGroup() || chat.IsSuperGroup()
 }
 
-func splitIntoChunks(text string, chunkSize int) []string {
-	var chunks []string
-	for i := 0; i < len(text); i += chunkSize {
-		end := i + chunkSize
-		if end > len(text) {
-			end = len(text)
-		}
-		chunks = append(chunks, text[i:end])
-	}
-	return chunks
-}
-
-func wrapWithIndicator(bot *telegram.BotAPI, chatID int64, action string, coroutine func() error) error {
+func WrapWithIndicator(bot *telegram.BotAPI, chatID int64, action string, coroutine func() error) error {
 	ticker := time.NewTicker(4 * time.Second)
 	defer ticker.Stop()
 
@@ -107,18 +90,44 @@ func wrapWithIndicator(bot *telegram.BotAPI, chatID int64, action string, corout
 	}
 }
 
-func editMessageWithRetry(bot *telegram.BotAPI, chatID int64, messageID int, text string, markdown bool) error {
-	msg := telegram.NewEditMessageText(chatID, messageID, text)
-	if markdown {
-		msg.ParseMode = telegram.ModeMarkdown
+// EditInlineMessage edits a message sent in inline mode, which is identified by its inline message id
+// instead of a chat and message id, with Telegram HTML rendered by RenderTelegramHTML.
+// If Telegram rejects the markup, the message is sent again as plain text.
+func EditInlineMessage(bot *telegram.BotAPI, inlineMessageID string, text string) error {
+	msg := telegram.EditMessageTextConfig{
+		BaseEdit:  telegram.BaseEdit{InlineMessageID: inlineMessageID},
+		Text:      text,
+		ParseMode: telegram.ModeHTML,
 	}
+	return sendEditWithFallback(bot, msg, StripHTML(text))
+}
+
+// editMessageHTML edits a message with Telegram HTML rendered by RenderTelegramHTML.
+// If Telegram rejects the markup, the message is sent again as plain text.
+func editMessageHTML(bot *telegram.BotAPI, chatID int64, messageID int, text string) error {
+	msg := telegram.NewEditMessageText(chatID, messageID, text)
+	msg.ParseMode = telegram.ModeHTML
+	return sendEditWithFallback(bot, msg, StripHTML(text))
+}
+
+// sendEditWithFallback sends an edit and, if Telegram rejects its formatting, sends plain instead.
+func sendEditWithFallback(bot *telegram.BotAPI, msg telegram.EditMessageTextConfig, plain string) error {
+	markdown := msg.ParseMode != ""
 
 	_, err := bot.Send(msg)
 	if err != nil {
 		if strings.Contains(err.Error(), "Message is not modified") {
 			return nil
 		}
+		// при превышении лимита Telegram повтор без Markdown тоже не пройдет
+		if retryAfter(err) > 0 {
+			return err
+		}
 
+		if markdown {
+			log.Printf("Failed to edit message with formatting, retrying as plain text: %v", err)
+		}
+		msg.Text = plain
 		msg.ParseMode = ""
 		_, err = bot.Send(msg)
 		if err != nil {
@@ -130,45 +139,29 @@ func editMessageWithRetry(bot *telegram.BotAPI, chatID int64, messageID int, tex
 	return nil
 }
 
-func errorHandler(err error) {
+func ErrorHandler(err error) {
 	log.Printf("Exception while handling an update: %v", err)
 }
 
-func isAllowed(config conf.Config, update *telegram.Update, bot *telegram.BotAPI, isInline bool) (bool, error) {
-	if config.AllowedUserIDs == "*" {
+func IsAllowed(config conf.Config, update *telegram.Update, bot *telegram.BotAPI, isInline bool) (bool, error) {
+	users := config.UserRegistry()
+	if users.AllowAll() {
 		return true, nil
 	}
 
-	var userID int
-	if isInline {
-		userID = update.InlineQuery.From.ID
-	} else {
-		userID = update.Message.From.ID
-	}
-
-	if IsAdmin(config, userID) {
+	userID := UpdateUser(update, isInline).ID
+	if _, ok := users.Lookup(userID); ok {
 		return true, nil
 	}
 
-	allowedUserIDs := strings.Split(config.AllowedUserIDs, ",")
-	for _, id := range allowedUserIDs {
-		if id == fmt.Sprint(userID) {
-			return true, nil
-		}
-	}
-
-	if !isInline && isGroupChat(update.Message.Chat) {
-		adminUserIDs := strings.Split(config.AdminUserIDs, ",")
-		for _, id := range append(allowedUserIDs, adminUserIDs...) {
-			if id == "" {
-				continue
-			}
-			isMember, err := isUserInGroup(bot, update.Message.Chat.ID, userID)
+	if !isInline && IsGroupChat(update.Message.Chat) {
+		for _, user := range users.List() {
+			isMember, err := isUserInGroup(bot, update.Message.Chat.ID, user.ID)
 			if err != nil {
 				return false, err
 			}
 			if isMember {
-				log.Printf("%d is a member. Allowing group chat message...", userID)
+				log.Printf("%d is a member. Allowing group chat message...", user.ID)
 				return true, nil
 			}
 		}
@@ -179,107 +172,263 @@ func isAllowed(config conf.Config, update *telegram.Update, bot *telegram.BotAPI
 }
 
 func IsAdmin(config conf.Config, userID int) bool {
-	if config.AdminUserIDs == "-" {
-		log.Println("No admin user defined.")
-		return false
+	user, ok := config.UserRegistry().Lookup(userID)
+	return ok && user.Role == conf.RoleAdmin
+}
+
+func GetUserBudget(cfg conf.Config, userID int) float64 {
+	if IsAdmin(cfg, userID) {
+		return math.Inf(1)
 	}
 
-	adminUserIDs := strings.Split(config.AdminUserIDs, ",")
-	for _, id := range adminUserIDs {
-		if id == fmt.Sprint(userID) {
-			return true
+	users := cfg.UserRegistry()
+	user, ok := users.Lookup(userID)
+	if !ok {
+		// незарегистрированные пользователи открытого бота получают общий для всех бюджет из старых списков
+		if !users.AllowAll() {
+			return 0.0
 		}
+		user.Budget = users.DefaultBudget()
+	}
+	if user.Budget == nil {
+		return math.Inf(1)
 	}
+	return *user.Budget
+}
 
-	return false
+// GetUserBudgetPeriod returns the budget period of the user, falling back to the global BudgetPeriod.
+func GetUserBudgetPeriod(cfg conf.Config, userID int) string {
+	if user, ok := cfg.UserRegistry().Lookup(userID); ok && user.BudgetPeriod != "" {
+		return user.BudgetPeriod
+	}
+	return cfg.BudgetPeriod
 }
 
-func GetUserBudget(cfg conf.Config, userID int) float64 {
-	if IsAdmin(cfg, userID) || cfg.UserBudgets == "*" {
-		return math.Inf(1)
+// GetUserModel returns the model override of the user, falling back to the global Model.
+func GetUserModel(cfg conf.Config, userID int) string {
+	if user, ok := cfg.UserRegistry().Lookup(userID); ok && user.Model != "" {
+		return user.Model
+	}
+	return cfg.Model
+}
+
+// budgetCostMap maps a budget period to the matching key of UsageTracker.GetCurrentCost.
+var budgetCostMap = map[string]string{
+	"monthly":  "cost_month",
+	"daily":    "cost_today",
+	"all-time": "cost_all_time",
+}
+
+// UpdateUser returns the sender of an update. Inline updates are inline queries or chosen inline results.
+func UpdateUser(update *telegram.Update, isInline bool) *telegram.User {
+	if !isInline {
+		return update.Message.From
+	}
+	if update.InlineQuery != nil {
+		return update.InlineQuery.From
 	}
+	return update.ChosenInlineResult.From
+}
 
-	userBudgets := strings.Split(cfg.UserBudgets, ",")
-	allowedUserIDs := strings.Split(cfg.AllowedUserIDs, ",")
+func GetRemainingBudget(cfg conf.Config, usage map[string]*usagetracker.UsageTracker, update *telegram.Update, isInline bool) float64 {
+	user := UpdateUser(update, isInline)
+	return GetRemainingUserBudget(cfg, usage, user.ID, user.UserName)
+}
 
-	for idx, id := range allowedUserIDs {
-		if id == fmt.Sprint(userID) {
-			if idx >= len(userBudgets) {
-				log.Printf("No budget set for user id: %d. Budget list shorter than user list.", userID)
-				return 0.0
-			}
-			budget, err := strconv.ParseFloat(userBudgets[idx], 64)
-			if err != nil {
-				log.Printf("Error parsing budget for user id: %d", userID)
-				return 0.0
-			}
-			return budget
+// GetRemainingUserBudget returns the remaining budget of a user for their budget period.
+// If GuestBudget is set, guests share the "guests" tracker and that free tier. Otherwise,
+// as before roles existed, every guest has their own tracker and the default budget of the registry.
+func GetRemainingUserBudget(cfg conf.Config, usage map[string]*usagetracker.UsageTracker, userID int, userName string) float64 {
+	if cfg.GuestBudget > 0 && GetUserRole(cfg, userID) == conf.RoleGuest {
+		cost := GetGuestUsageTracker(cfg, usage).GetCurrentCost()[budgetCostMap[cfg.BudgetPeriod]]
+		return cfg.GuestBudget - cost
+	}
+
+	userTracker := GetUserUsageTracker(cfg, usage, userID, userName)
+	budgetPeriod := GetUserBudgetPeriod(cfg, userID)
+	cost := userTracker.GetCurrentCost()[budgetCostMap[budgetPeriod]]
+
+	return GetUserBudget(cfg, userID) - cost
+}
+
+// GetUserUsageTracker returns the tracker of a user, creating it on first use.
+func GetUserUsageTracker(cfg conf.Config, usage map[string]*usagetracker.UsageTracker, userID int, userName string) *usagetracker.UsageTracker {
+	userIDStr := fmt.Sprintf("%d", userID)
+	if _, ok := usage[userIDStr]; !ok {
+		usage[userIDStr] = newUsageTracker(cfg, userID, userName)
+	}
+	return usage[userIDStr]
+}
+
+// LoadUsage loads all trackers in LogsDir under the keys used by the tracker getters,
+// so totals over all users like the organisation cap can be computed in memory.
+func LoadUsage(cfg conf.Config) map[string]*usagetracker.UsageTracker {
+	usage := make(map[string]*usagetracker.UsageTracker)
+	trackers, err := usagetracker.LoadUsageTrackers(cfg.LogsDir)
+	if err != nil {
+		log.Printf("Error loading usage trackers: %v", err)
+		return usage
+	}
+	for _, tracker := range trackers {
+		tracker.InitializeMissingAllTimeCost(cfg.TokenPrice, cfg.ImagePrices, cfg.TranscriptionPrice, cfg.EmbeddingPrice)
+		switch tracker.UserID {
+		case -1:
+			usage["guests"] = tracker
+		case -2:
+			usage["reports"] = tracker
+		default:
+			usage[fmt.Sprint(tracker.UserID)] = tracker
 		}
 	}
+	return usage
+}
 
-	return 0.0
+// newUsageTracker loads a tracker and fills in all_time of tracker files that predate it.
+func newUsageTracker(cfg conf.Config, userID int, userName string) *usagetracker.UsageTracker {
+	tracker := usagetracker.NewUsageTracker(userID, userName, cfg.LogsDir)
+	tracker.InitializeMissingAllTimeCost(cfg.TokenPrice, cfg.ImagePrices, cfg.TranscriptionPrice, cfg.EmbeddingPrice)
+	return tracker
 }
 
-func GetRemainingBudget(cfg conf.Config, usage map[string]*usagetracker.UsageTracker, update *telegram.Update, isInline bool) float64 {
-	budgetCostMap := map[string]string{
-		"monthly":  "cost_month",
-		"daily":    "cost_today",
-		"all-time": "cost_all_time",
+// GetGuestUsageTracker returns the tracker shared by all guests.
+func GetGuestUsageTracker(cfg conf.Config, usage map[string]*usagetracker.UsageTracker) *usagetracker.UsageTracker {
+	if _, ok := usage["guests"]; !ok {
+		usage["guests"] = newUsageTracker(cfg, -1, "Guests")
 	}
+	return usage["guests"]
+}
 
-	var userID string
-	if isInline {
-		userID = fmt.Sprintf("%d", update.InlineQuery.From.ID)
-	} else {
-		userID = fmt.Sprintf("%d", update.Message.From.ID)
+// GetChatBudget returns the shared budget of a group chat. ChatBudgets holds "chatID:budget" pairs,
+// groups without an entry fall back to GroupBudget if it is set. Private chats have no shared budget,
+// in that case the second value is false.
+func GetChatBudget(cfg conf.Config, chat *telegram.Chat) (float64, bool) {
+	if chat == nil || !IsGroupChat(chat) {
+		return 0.0, false
+	}
+
+	chatIDStr := fmt.Sprint(chat.ID)
+	for _, entry := range strings.Split(cfg.ChatBudgets, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 || parts[0] != chatIDStr {
+			continue
+		}
+		budget, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			log.Printf("Error parsing budget for chat id: %d", chat.ID)
+			return 0.0, true
+		}
+		return budget, true
+	}
+
+	if cfg.GroupBudget > 0 {
+		return cfg.GroupBudget, true
 	}
+	return 0.0, false
+}
 
-	if _, ok := usage[userID]; !ok {
-		usage[userID] = usagetracker.NewUsageTracker(update.Message.From.ID, update.Message.From.UserName, "usage_logs")
+// GetChatUsageTracker returns the tracker shared by all members of a group chat.
+// Group chat IDs are negative, so the tracker never collides with a user tracker.
+func GetChatUsageTracker(cfg conf.Config, usage map[string]*usagetracker.UsageTracker, chat *telegram.Chat) *usagetracker.UsageTracker {
+	chatIDStr := fmt.Sprint(chat.ID)
+	if _, ok := usage[chatIDStr]; !ok {
+		usage[chatIDStr] = newUsageTracker(cfg, int(chat.ID), chat.Title)
 	}
+	return usage[chatIDStr]
+}
 
-	userBudget := GetUserBudget(cfg, update.Message.From.ID)
-	budgetPeriod := cfg.BudgetPeriod
-	cost := usage[userID].GetCurrentCost()[budgetCostMap[budgetPeriod]]
+// GetRemainingChatBudget returns the remaining shared budget of a group chat for the current budget period.
+// The second value is false if the chat has no shared budget.
+func GetRemainingChatBudget(cfg conf.Config, usage map[string]*usagetracker.UsageTracker, chat *telegram.Chat) (float64, bool) {
+	chatBudget, ok := GetChatBudget(cfg, chat)
+	if !ok {
+		return math.Inf(1), false
+	}
 
-	return userBudget - cost
+	cost := GetChatUsageTracker(cfg, usage, chat).GetCurrentCost()[budgetCostMap[cfg.BudgetPeriod]]
+	return chatBudget - cost, true
 }
 
 // IsWithinBudget checks if the user reached their usage limit.
+// In group chats with a shared budget BudgetPrecedence decides which limit applies:
+// "user" checks only the user budget, "chat" only the chat budget, anything else both of them.
+// Admins are never limited by a chat budget. Inline requests have no chat and only use the user budget.
 func IsWithinBudget(cfg conf.Config, usage map[string]*usagetracker.UsageTracker, update *telegram.Update, isInline bool) bool {
-	var _ string
-	if isInline {
-		_ = fmt.Sprintf("%d", update.InlineQuery.From.ID)
-	} else {
-		_ = fmt.Sprintf("%d", update.Message.From.ID)
+	remainingBudget := GetRemainingBudget(cfg, usage, update, isInline)
+	if isInline || IsAdmin(cfg, update.Message.From.ID) {
+		return remainingBudget > 0
 	}
 
-	remainingBudget := GetRemainingBudget(cfg, usage, update, isInline)
-	return remainingBudget > 0
+	remainingChatBudget, hasChatBudget := GetRemainingChatBudget(cfg, usage, update.Message.Chat)
+	if !hasChatBudget {
+		return remainingBudget > 0
+	}
+
+	switch cfg.BudgetPrecedence {
+	case "user":
+		return remainingBudget > 0
+	case "chat":
+		return remainingChatBudget > 0
+	default:
+		return remainingBudget > 0 && remainingChatBudget > 0
+	}
 }
 
-func AddChatRequestToUsageTracker(usage map[string]*usagetracker.UsageTracker, cfg conf.Config, userID int, usedTokens int) {
-	userIDStr := fmt.Sprintf("%d", userID)
-	logsDir := cfg.LogsDir // Убедитесь, что logsDir определен в структуре conf.Config
+// AddChatRequestToUsageTracker charges the used tokens to the user and, for group chats, to the chat tracker.
+// chat may be nil for requests that don't come from a chat. The user tracker also records the model.
+// It returns the budget alerts crossed by this request, the caller delivers them.
+func AddChatRequestToUsageTracker(usage map[string]*usagetracker.UsageTracker, cfg conf.Config, userID int, chat *telegram.Chat, model string, usedTokens int) []BudgetAlert {
+	userTracker := GetUserUsageTracker(cfg, usage, userID, fmt.Sprintf("User %d", userID))
+	userTracker.AddChatTokensForModel(usedTokens, cfg.TokenPrice, model)
 
-	if _, ok := usage[userIDStr]; !ok {
-		usage[userIDStr] = usagetracker.NewUsageTracker(userID, fmt.Sprintf("User %d", userID), logsDir)
+	if GetUserRole(cfg, userID) == conf.RoleGuest {
+		GetGuestUsageTracker(cfg, usage).AddChatTokens(usedTokens, cfg.TokenPrice)
 	}
 
-	userTracker := usage[userIDStr]
-	userTracker.AddChatTokens(usedTokens, cfg.TokenPrice)
+	if chat != nil && IsGroupChat(chat) {
+		GetChatUsageTracker(cfg, usage, chat).AddChatTokens(usedTokens, cfg.TokenPrice)
+	}
 
-	if !strings.Contains(cfg.AllowedUserIDs, userIDStr) {
-		if _, ok := usage["guests"]; !ok {
-			usage["guests"] = usagetracker.NewUsageTracker(-1, "Guests", logsDir)
-		}
-		guestTracker := usage["guests"]
-		guestTracker.AddChatTokens(usedTokens, cfg.TokenPrice)
+	return checkBudgetAlerts(cfg, usage, userID)
+}
+
+// AddCorrectionRequestToUsageTracker charges the tokens of a grammar correction like AddChatRequestToUsageTracker,
+// but the user tracker also records them in the correction_tokens category.
+func AddCorrectionRequestToUsageTracker(usage map[string]*usagetracker.UsageTracker, cfg conf.Config, userID int, chat *telegram.Chat, model string, usedTokens int) []BudgetAlert {
+	userTracker := GetUserUsageTracker(cfg, usage, userID, fmt.Sprintf("User %d", userID))
+	userTracker.AddCorrectionTokens(usedTokens, cfg.TokenPrice, model)
+
+	if GetUserRole(cfg, userID) == conf.RoleGuest {
+		GetGuestUsageTracker(cfg, usage).AddChatTokens(usedTokens, cfg.TokenPrice)
+	}
+
+	if chat != nil && IsGroupChat(chat) {
+		GetChatUsageTracker(cfg, usage, chat).AddChatTokens(usedTokens, cfg.TokenPrice)
+	}
+
+	return checkBudgetAlerts(cfg, usage, userID)
+}
+
+// AddEmbeddingRequestToUsageTracker charges the tokens of document embeddings at the embedding price
+// to the user and, for group chats, to the chat tracker.
+func AddEmbeddingRequestToUsageTracker(usage map[string]*usagetracker.UsageTracker, cfg conf.Config, userID int, chat *telegram.Chat, usedTokens int) []BudgetAlert {
+	userTracker := GetUserUsageTracker(cfg, usage, userID, fmt.Sprintf("User %d", userID))
+	userTracker.AddEmbeddingTokens(usedTokens, cfg.EmbeddingPrice)
+
+	if GetUserRole(cfg, userID) == conf.RoleGuest {
+		GetGuestUsageTracker(cfg, usage).AddEmbeddingTokens(usedTokens, cfg.EmbeddingPrice)
 	}
+
+	if chat != nil && IsGroupChat(chat) {
+		GetChatUsageTracker(cfg, usage, chat).AddEmbeddingTokens(usedTokens, cfg.EmbeddingPrice)
+	}
+
+	return checkBudgetAlerts(cfg, usage, userID)
 }
 
-func getReplyToMessageID(config conf.Config, message *telegram.Message) int {
-	if config.EnableQuoting || isGroupChat(message.Chat) {
+// GetReplyToMessageID returns the message to quote in a reply. Messages in groups are always quoted,
+// which also keeps the reply in the forum topic of the message.
+func GetReplyToMessageID(config conf.Config, message *telegram.Message) int {
+	if config.EnableQuoting || IsGroupChat(message.Chat) || GetThreadID(message) != 0 {
 		return message.MessageID
 	}
 	return 0